@@ -0,0 +1,76 @@
+package aci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+// RestartContainerGroup restarts all containers in a container group in place.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/restart
+func (c *Client) RestartContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	return c.containerGroupAction(ctx, resourceGroup, containerGroupName, "restart")
+}
+
+// StopContainerGroup stops all containers in a container group, compute
+// resources are deallocated and billing stops.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/stop
+func (c *Client) StopContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	return c.containerGroupAction(ctx, resourceGroup, containerGroupName, "stop")
+}
+
+// StartContainerGroup starts all containers in a stopped container group.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/start
+func (c *Client) StartContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	return c.containerGroupAction(ctx, resourceGroup, containerGroupName, "start")
+}
+
+// containerGroupAction sends a POST request for the action to the container group.
+func (c *Client) containerGroupAction(ctx context.Context, resourceGroup, containerGroupName, action string) error {
+	urlParams := url.Values{
+		"api-version": []string{apiVersion},
+	}
+
+	// Create the url.
+	uri := api.ResolveRelative(c.baseURI, containerGroupURLPath+"/"+action)
+	uri += "?" + url.Values(urlParams).Encode()
+
+	// Create the request.
+	req, err := http.NewRequest("POST", uri, nil)
+	if err != nil {
+		return fmt.Errorf("Creating %s container group uri request failed: %v", action, err)
+	}
+	req = req.WithContext(ctx)
+
+	// Add the parameters to the url.
+	if err := api.ExpandURL(req.URL, map[string]string{
+		"subscriptionId":     c.auth.SubscriptionID,
+		"resourceGroup":      resourceGroup,
+		"containerGroupName": containerGroupName,
+	}); err != nil {
+		return fmt.Errorf("Expanding URL with parameters failed: %v", err)
+	}
+
+	// Stopping a stopped group or starting a running one changes nothing, so
+	// only restarts must not be sent twice.
+	if action != "restart" {
+		req = markIdempotent(req)
+	}
+
+	// Send the request.
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("Sending %s container group request failed: %v", action, err)
+	}
+	defer resp.Body.Close()
+
+	// 202 (Accepted) and 204 (No Content) are successful responses.
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	return c.waitForOperation(ctx, resp)
+}
@@ -0,0 +1,103 @@
+package aci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Attach connects to the websocket of an exec session, authenticates with the
+// session password and copies stdin to the session and the session output to
+// stdout until the server closes the connection. ACI merges the stdout and
+// stderr of the command into a single stream. stdin may be nil.
+//
+// stdin is sent in text messages, and every terminal size received from resize
+// in a binary message holding the TerminalSize as JSON. resize may be nil.
+// The session is closed when ctx is done.
+func Attach(ctx context.Context, webSocketURI, password string, stdin io.Reader, stdout io.Writer, resize <-chan TerminalSize) error {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, webSocketURI, nil)
+	if err != nil {
+		return fmt.Errorf("Connecting to exec websocket failed: %v", err)
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-closed:
+		}
+	}()
+
+	// The connection supports one concurrent writer.
+	var mu sync.Mutex
+	write := func(messageType int, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return conn.WriteMessage(messageType, data)
+	}
+
+	// The first message authenticates the session.
+	if err := write(websocket.TextMessage, []byte(password)); err != nil {
+		return fmt.Errorf("Sending exec websocket password failed: %v", err)
+	}
+
+	if stdin != nil {
+		go func() {
+			buf := make([]byte, 1024)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					if err := write(websocket.TextMessage, buf[:n]); err != nil {
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	if resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-resize:
+					data, err := json.Marshal(size)
+					if err != nil {
+						return
+					}
+					if err := write(websocket.BinaryMessage, data); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("Reading from exec websocket failed: %v", err)
+		}
+
+		if _, err := stdout.Write(data); err != nil {
+			return err
+		}
+	}
+}
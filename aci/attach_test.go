@@ -0,0 +1,188 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// execServer is an in-process exec websocket. It checks the password, records
+// the stdin and terminal sizes it receives until it has received wantStdin and
+// wantSizes sizes, then sends output and closes the connection with closeCode.
+type execServer struct {
+	password  string
+	wantStdin string
+	wantSizes int
+	output    string
+	closeCode int
+
+	stdin chan string
+	sizes chan TerminalSize
+}
+
+func newExecServer(t *testing.T, s *execServer) *httptest.Server {
+	s.stdin = make(chan string, 1)
+	s.sizes = make(chan TerminalSize, 10)
+
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		_, password, err := conn.ReadMessage()
+		if err != nil || string(password) != s.password {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "bad password"))
+			return
+		}
+
+		var stdin string
+		sizes := 0
+		for stdin != s.wantStdin || sizes < s.wantSizes {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			switch messageType {
+			case websocket.TextMessage:
+				stdin += string(data)
+			case websocket.BinaryMessage:
+				var size TerminalSize
+				if err := json.Unmarshal(data, &size); err != nil {
+					t.Errorf("Decoding resize message %q failed: %v", data, err)
+				}
+				s.sizes <- size
+				sizes++
+			}
+		}
+		s.stdin <- stdin
+
+		conn.WriteMessage(websocket.TextMessage, []byte(s.output))
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(s.closeCode, ""))
+	}))
+}
+
+func webSocketURI(srv *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func TestAttach(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		stdin    string
+		resize   []TerminalSize
+		close    int
+		wantErr  bool
+	}{
+		{
+			name:     "output",
+			password: "secret",
+			close:    websocket.CloseNormalClosure,
+		},
+		{
+			name:     "stdin",
+			password: "secret",
+			stdin:    "ls -l\n",
+			close:    websocket.CloseNormalClosure,
+		},
+		{
+			name:     "resize",
+			password: "secret",
+			stdin:    "exit\n",
+			resize:   []TerminalSize{{Rows: 40, Cols: 120}},
+			close:    websocket.CloseGoingAway,
+		},
+		{
+			name:     "wrong password",
+			password: "wrong",
+			close:    websocket.CloseNormalClosure,
+			wantErr:  true,
+		},
+		{
+			name:     "abnormal close",
+			password: "secret",
+			close:    websocket.CloseInternalServerErr,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &execServer{password: "secret", wantStdin: test.stdin, wantSizes: len(test.resize), output: "total 0\n", closeCode: test.close}
+			srv := newExecServer(t, s)
+			defer srv.Close()
+
+			var stdin io.Reader
+			if test.stdin != "" {
+				stdin = strings.NewReader(test.stdin)
+			}
+
+			resize := make(chan TerminalSize, len(test.resize))
+			for _, size := range test.resize {
+				resize <- size
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var stdout bytes.Buffer
+			err := Attach(ctx, webSocketURI(srv), test.password, stdin, &stdout, resize)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Attach succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Attach failed: %v", err)
+			}
+
+			if got := <-s.stdin; got != test.stdin {
+				t.Errorf("Server received stdin %q, want %q", got, test.stdin)
+			}
+			if stdout.String() != s.output {
+				t.Errorf("Attach wrote %q, want %q", stdout.String(), s.output)
+			}
+
+			for _, want := range test.resize {
+				select {
+				case got := <-s.sizes:
+					if got != want {
+						t.Errorf("Server received terminal size %+v, want %+v", got, want)
+					}
+				default:
+					t.Errorf("Server did not receive terminal size %+v", want)
+				}
+			}
+		})
+	}
+}
+
+func TestAttachCanceled(t *testing.T) {
+	// The server never finishes, as it waits for stdin that is not sent.
+	s := &execServer{password: "secret", wantStdin: "never sent", closeCode: websocket.CloseNormalClosure}
+	srv := newExecServer(t, s)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := Attach(ctx, webSocketURI(srv), "secret", nil, &bytes.Buffer{}, nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Attach returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,121 @@
+package aci
+
+import (
+	"errors"
+	"os"
+
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+// Options select the credentials and endpoints of a client created with
+// NewClientFromEnvironment.
+type Options struct {
+	// AuthMode is where the credentials come from, one of AuthModes.
+	AuthMode string
+
+	// Cloud is the name of the Azure cloud, one of Clouds, and CloudFile a
+	// JSON file with the endpoints of a custom cloud. The endpoints of the
+	// authentication file are used when both are empty.
+	Cloud     string
+	CloudFile string
+
+	// SubscriptionID, TenantID, ClientID and AuthLocation, when not empty,
+	// override the AZURE_SUBSCRIPTION_ID, AZURE_TENANT_ID, AZURE_CLIENT_ID and
+	// AZURE_AUTH_LOCATION environment variables.
+	SubscriptionID string
+	TenantID       string
+	ClientID       string
+	AuthLocation   string
+
+	// Endpoint and ActiveDirectoryEndpoint override the Azure Resource
+	// Manager and Active Directory endpoints of the cloud, for example to use
+	// the emulator. Tokens are still requested for the resource of the cloud.
+	Endpoint                string
+	ActiveDirectoryEndpoint string
+}
+
+// NewClientFromEnvironment creates a client from the authentication file in
+// AZURE_AUTH_LOCATION, overridden by the AZURE_CLIENT_ID, AZURE_CLIENT_SECRET,
+// AZURE_TENANT_ID and AZURE_SUBSCRIPTION_ID environment variables, using the
+// credentials and endpoints of opts. The subscription defaults to the one
+// selected in the Azure CLI.
+func NewClientFromEnvironment(opts Options) (*Client, error) {
+	var azAuth *azure.Authentication
+
+	authFilepath := os.Getenv("AZURE_AUTH_LOCATION")
+	if opts.AuthLocation != "" {
+		authFilepath = opts.AuthLocation
+	}
+
+	if authFilepath != "" {
+		auth, err := azure.NewAuthenticationFromFile(authFilepath)
+		if err != nil {
+			return nil, err
+		}
+
+		azAuth = auth
+	} else {
+		azAuth = azure.NewAuthentication(azure.PublicCloud.Name, "", "", "", "")
+	}
+
+	if opts.Cloud != "" || opts.CloudFile != "" {
+		cloud, err := LoadCloud(opts.Cloud, opts.CloudFile)
+		if err != nil {
+			return nil, err
+		}
+		setCloud(azAuth, cloud)
+	}
+
+	if clientID := firstNonEmpty(opts.ClientID, os.Getenv("AZURE_CLIENT_ID")); clientID != "" {
+		azAuth.ClientID = clientID
+	}
+
+	if clientSecret := os.Getenv("AZURE_CLIENT_SECRET"); clientSecret != "" {
+		azAuth.ClientSecret = clientSecret
+	}
+
+	if tenantID := firstNonEmpty(opts.TenantID, os.Getenv("AZURE_TENANT_ID")); tenantID != "" {
+		azAuth.TenantID = tenantID
+	}
+
+	if subscriptionID := firstNonEmpty(opts.SubscriptionID, os.Getenv("AZURE_SUBSCRIPTION_ID")); subscriptionID != "" {
+		azAuth.SubscriptionID = subscriptionID
+	}
+
+	// The resource is taken before the endpoints are overridden.
+	resource := tokenResource(azAuth)
+	baseURI := azAuth.ResourceManagerEndpoint
+	if opts.Endpoint != "" {
+		baseURI = opts.Endpoint
+	}
+
+	if opts.ActiveDirectoryEndpoint != "" {
+		azAuth.ActiveDirectoryEndpoint = opts.ActiveDirectoryEndpoint
+	}
+
+	tp, err := newTokenProvider(opts.AuthMode, azAuth, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if azAuth.SubscriptionID == "" {
+		subscriptionID, _, err := cliDefaultSubscription()
+		if err != nil {
+			return nil, errors.New("Must have AZURE_SUBSCRIPTION_ID set, or a default subscription selected with 'az account set'.")
+		}
+		azAuth.SubscriptionID = subscriptionID
+	}
+
+	return newClient(azAuth, baseURI, tp), nil
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
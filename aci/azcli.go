@@ -0,0 +1,253 @@
+package aci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+// cliProfile is the azureProfile.json file of the Azure CLI, listing the
+// subscriptions of the signed in accounts.
+type cliProfile struct {
+	Subscriptions []struct {
+		ID        string `json:"id"`
+		TenantID  string `json:"tenantId"`
+		IsDefault bool   `json:"isDefault"`
+	} `json:"subscriptions"`
+}
+
+// cliAccessToken is an entry of the accessTokens.json token cache, written by
+// Azure CLI versions before 2.30.
+type cliAccessToken struct {
+	Authority    string `json:"_authority"`
+	ClientID     string `json:"_clientId"`
+	Resource     string `json:"resource"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresOn    string `json:"expiresOn"`
+}
+
+// msalTokenCache is the msal_token_cache.json token cache, written by Azure
+// CLI versions from 2.30. Refresh tokens belong to the home account of a user,
+// which has an account entry for every tenant, or realm, it signed in to.
+type msalTokenCache struct {
+	Account map[string]struct {
+		HomeAccountID string `json:"home_account_id"`
+		Environment   string `json:"environment"`
+		Realm         string `json:"realm"`
+	} `json:"Account"`
+	RefreshToken map[string]struct {
+		HomeAccountID string `json:"home_account_id"`
+		ClientID      string `json:"client_id"`
+		Secret        string `json:"secret"`
+		Environment   string `json:"environment"`
+	} `json:"RefreshToken"`
+}
+
+// cliConfigDir returns the configuration directory of the Azure CLI.
+func cliConfigDir() (string, error) {
+	if dir := os.Getenv("AZURE_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".azure"), nil
+}
+
+// readCLIFile decodes a JSON file of the Azure CLI, which may start with a
+// byte order mark.
+func readCLIFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), v); err != nil {
+		return fmt.Errorf("Decoding %s failed: %v", path, err)
+	}
+
+	return nil
+}
+
+// cliDefaultSubscription returns the default subscription selected with
+// 'az account set', and its tenant.
+func cliDefaultSubscription() (string, string, error) {
+	dir, err := cliConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	var profile cliProfile
+	if err := readCLIFile(filepath.Join(dir, "azureProfile.json"), &profile); err != nil {
+		return "", "", err
+	}
+
+	for _, subscription := range profile.Subscriptions {
+		if subscription.IsDefault {
+			return subscription.ID, subscription.TenantID, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("No default subscription, run 'az account set'")
+}
+
+func cliCredential(shared *azure.Authentication, resource string) (adal.OAuthTokenProvider, error) {
+	dir, err := cliConfigDir()
+	if err != nil {
+		return nil, unavailable(AuthModeCLI, "%v", err)
+	}
+
+	// The defaults of the Azure CLI only apply when its credentials are used,
+	// the next modes tried must not see them.
+	auth := *shared
+	if auth.TenantID == "" || auth.SubscriptionID == "" {
+		subscriptionID, tenantID, err := cliDefaultSubscription()
+		if err != nil {
+			return nil, unavailable(AuthModeCLI, "not signed in with 'az login': %v", err)
+		}
+
+		if auth.TenantID == "" {
+			auth.TenantID = tenantID
+		}
+		if auth.SubscriptionID == "" {
+			auth.SubscriptionID = subscriptionID
+		}
+	}
+
+	clientID, token, err := cliToken(dir, &auth, resource)
+	if err != nil {
+		return nil, unavailable(AuthModeCLI, "%v", err)
+	}
+
+	config, err := adal.NewOAuthConfig(auth.ActiveDirectoryEndpoint, auth.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new OAuth config for active directory failed: %v", err)
+	}
+
+	tp, err := adal.NewServicePrincipalTokenFromManualToken(*config, clientID, resource, token)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new token from the Azure CLI token cache failed: %v", err)
+	}
+
+	shared.TenantID = auth.TenantID
+	shared.SubscriptionID = auth.SubscriptionID
+
+	return tp, nil
+}
+
+// cliToken finds a refresh token for the tenant in the token caches of the
+// Azure CLI, with the cached access token when it is still valid for the
+// resource. The access token is refreshed on first use otherwise. Tokens of
+// other clouds, told apart by the host of their authority, are skipped.
+func cliToken(dir string, auth *azure.Authentication, resource string) (string, adal.Token, error) {
+	host, err := authorityHost(auth.ActiveDirectoryEndpoint)
+	if err != nil {
+		return "", adal.Token{}, err
+	}
+
+	var accessTokens []cliAccessToken
+	err = readCLIFile(filepath.Join(dir, "accessTokens.json"), &accessTokens)
+	if err != nil && !os.IsNotExist(err) {
+		return "", adal.Token{}, err
+	}
+
+	var fallback *cliAccessToken
+	for i, entry := range accessTokens {
+		if entry.RefreshToken == "" || !isAuthority(entry.Authority, host, auth.TenantID) {
+			continue
+		}
+
+		if sameResource(entry.Resource, resource) || sameResource(entry.Resource, auth.ManagementEndpoint) {
+			if expiresOn, ok := parseCLIExpiresOn(entry.ExpiresOn); ok && time.Now().Before(expiresOn) {
+				return entry.ClientID, adal.Token{
+					AccessToken:  entry.AccessToken,
+					RefreshToken: entry.RefreshToken,
+					ExpiresOn:    strconv.FormatInt(expiresOn.Unix(), 10),
+					Resource:     entry.Resource,
+					Type:         "Bearer",
+				}, nil
+			}
+		}
+
+		if fallback == nil {
+			fallback = &accessTokens[i]
+		}
+	}
+
+	if fallback != nil {
+		return fallback.ClientID, adal.Token{RefreshToken: fallback.RefreshToken, Resource: resource, Type: "Bearer"}, nil
+	}
+
+	var msalCache msalTokenCache
+	err = readCLIFile(filepath.Join(dir, "msal_token_cache.json"), &msalCache)
+	if err != nil && !os.IsNotExist(err) {
+		return "", adal.Token{}, err
+	}
+
+	// The accounts signed in to the tenant of this cloud.
+	accounts := map[string]bool{}
+	for _, account := range msalCache.Account {
+		if strings.EqualFold(account.Environment, host) && strings.EqualFold(account.Realm, auth.TenantID) {
+			accounts[account.HomeAccountID] = true
+		}
+	}
+
+	for _, entry := range msalCache.RefreshToken {
+		if entry.Secret != "" && entry.ClientID == azureCLIClientID && strings.EqualFold(entry.Environment, host) && accounts[entry.HomeAccountID] {
+			return entry.ClientID, adal.Token{RefreshToken: entry.Secret, Resource: resource, Type: "Bearer"}, nil
+		}
+	}
+
+	return "", adal.Token{}, fmt.Errorf("no token for tenant %s in the token cache of %s, run 'az login'", auth.TenantID, dir)
+}
+
+// authorityHost returns the host of the Active Directory endpoint, the
+// environment of the MSAL token cache.
+func authorityHost(activeDirectoryEndpoint string) (string, error) {
+	u, err := url.Parse(activeDirectoryEndpoint)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid active directory endpoint %q", activeDirectoryEndpoint)
+	}
+
+	return u.Host, nil
+}
+
+// isAuthority reports whether authority, such as
+// https://login.microsoftonline.com/{tenant}, is the tenant at host.
+func isAuthority(authority, host, tenantID string) bool {
+	u, err := url.Parse(authority)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, host) && strings.EqualFold(strings.Trim(u.Path, "/"), tenantID)
+}
+
+// parseCLIExpiresOn parses the local expiry time of an accessTokens.json entry.
+func parseCLIExpiresOn(value string) (time.Time, bool) {
+	expiresOn, err := time.ParseInLocation("2006-01-02 15:04:05.999999", value, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return expiresOn, true
+}
+
+// sameResource compares resources ignoring the trailing slash.
+func sameResource(a, b string) bool {
+	return a != "" && strings.TrimSuffix(a, "/") == strings.TrimSuffix(b, "/")
+}
@@ -0,0 +1,77 @@
+// Package aci is a client for the Azure Container Instances operations acictl
+// needs, built on the types of the virtual-kubelet ACI client.
+package aci
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+const (
+	// BaseURI is the URI used for compute services when the authentication
+	// has no Resource Manager endpoint.
+	BaseURI   = "https://management.azure.com"
+	userAgent = "acictl"
+
+	// apiVersion is the first version of the container instance API with
+	// both the stop and start operations.
+	apiVersion = "2018-10-01"
+
+	containerGroupURLPath                    = "subscriptions/{{.subscriptionId}}/resourceGroups/{{.resourceGroup}}/providers/Microsoft.ContainerInstance/containerGroups/{{.containerGroupName}}"
+	containerGroupListURLPath                = "subscriptions/{{.subscriptionId}}/providers/Microsoft.ContainerInstance/containerGroups"
+	containerGroupListByResourceGroupURLPath = "subscriptions/{{.subscriptionId}}/resourceGroups/{{.resourceGroup}}/providers/Microsoft.ContainerInstance/containerGroups"
+	containerLogsURLPath                     = containerGroupURLPath + "/containers/{{.containerName}}/logs"
+)
+
+// Client is a client for interacting with Azure Container Instances.
+//
+// Clients should be reused instead of created as needed.
+// The methods of Client are safe for concurrent use by multiple goroutines.
+type Client struct {
+	hc      *http.Client
+	auth    *azure.Authentication
+	baseURI string
+}
+
+// NewClient creates a new Azure Container Instances client sending requests to
+// baseURI, or to the Resource Manager endpoint of the authentication when
+// baseURI is empty, authenticated
+// with the client secret of a service principal.
+func NewClient(auth *azure.Authentication, baseURI string) (*Client, error) {
+	if auth == nil {
+		return nil, fmt.Errorf("Authentication is not supplied for the Azure client")
+	}
+
+	tp, err := clientSecretCredential(auth, tokenResource(auth))
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(auth, baseURI, tp), nil
+}
+
+// newClient creates a new Azure Container Instances client sending requests
+// with the tokens of tp.
+func newClient(auth *azure.Authentication, baseURI string, tp adal.OAuthTokenProvider) *Client {
+	if baseURI == "" {
+		baseURI = auth.ResourceManagerEndpoint
+	}
+	if baseURI == "" {
+		baseURI = BaseURI
+	}
+
+	// Retries wrap the bearer transport so that a retry after a long wait
+	// gets a fresh token.
+	hc := &http.Client{
+		Transport: newRetryTransport(&bearerTransport{
+			base:          http.DefaultTransport,
+			userAgent:     userAgent,
+			tokenProvider: tp,
+		}, MaxRetries, RetryTimeout, RequestTimeout),
+	}
+
+	return &Client{hc: hc, auth: auth, baseURI: baseURI}
+}
@@ -0,0 +1,90 @@
+package aci
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+// Clouds are the Azure clouds known by name.
+var Clouds = map[string]azure.Environment{
+	azure.PublicCloud.Name:       azure.PublicCloud,
+	azure.USGovernmentCloud.Name: usGovernmentCloud(),
+	azure.ChinaCloud.Name:        azure.ChinaCloud,
+	azure.GermanCloud.Name:       azure.GermanCloud,
+}
+
+// usGovernmentCloud returns the US Government cloud, which signs in at its own
+// Active Directory endpoint since Azure AD Government was split from the
+// public Azure AD.
+func usGovernmentCloud() azure.Environment {
+	cloud := azure.USGovernmentCloud
+	cloud.ActiveDirectoryEndpoint = "https://login.microsoftonline.us/"
+	return cloud
+}
+
+// CloudNames returns the names of the known Azure clouds, sorted.
+func CloudNames() []string {
+	names := make([]string, 0, len(Clouds))
+	for name := range Clouds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// LoadCloud returns the endpoints of the Azure cloud in the JSON file at path
+// when path is not empty, or of the cloud called name otherwise. Names are
+// case insensitive.
+func LoadCloud(name string, path string) (azure.Environment, error) {
+	if path != "" {
+		return loadCloudFile(path)
+	}
+
+	for cloudName, cloud := range Clouds {
+		if strings.EqualFold(name, cloudName) {
+			return cloud, nil
+		}
+	}
+
+	return azure.Environment{}, fmt.Errorf("Unknown Azure cloud %q, must be one of %s, or a file with --cloud-file", name, strings.Join(CloudNames(), ", "))
+}
+
+// loadCloudFile reads the endpoints of a custom cloud, such as Azure Stack,
+// in the format of the environment files of go-autorest.
+func loadCloudFile(path string) (azure.Environment, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return azure.Environment{}, fmt.Errorf("Reading cloud file %q failed: %v", path, err)
+	}
+
+	var cloud azure.Environment
+	if err := json.Unmarshal(data, &cloud); err != nil {
+		return azure.Environment{}, fmt.Errorf("Decoding cloud file %q failed: %v", path, err)
+	}
+
+	if cloud.ResourceManagerEndpoint == "" || cloud.ActiveDirectoryEndpoint == "" {
+		return azure.Environment{}, fmt.Errorf("Cloud file %q must set both resourceManagerEndpoint and activeDirectoryEndpoint", path)
+	}
+
+	if cloud.Name == "" {
+		cloud.Name = path
+	}
+
+	return cloud, nil
+}
+
+// setCloud points the authentication at the endpoints of the cloud.
+func setCloud(auth *azure.Authentication, cloud azure.Environment) {
+	auth.ActiveDirectoryEndpoint = cloud.ActiveDirectoryEndpoint
+	auth.ResourceManagerEndpoint = cloud.ResourceManagerEndpoint
+	auth.GraphResourceID = cloud.GraphEndpoint
+	auth.SQLManagementEndpoint = cloud.SQLDatabaseDNSSuffix
+	auth.GalleryEndpoint = cloud.GalleryEndpoint
+	auth.ManagementEndpoint = cloud.ServiceManagementEndpoint
+}
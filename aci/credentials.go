@@ -0,0 +1,326 @@
+package aci
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+// Authentication modes, selecting where the credentials come from.
+const (
+	// AuthModeAuto tries every other mode in order and uses the first one
+	// with credentials available, ending with the device code flow when
+	// stdin is a terminal.
+	AuthModeAuto = "auto"
+
+	// AuthModeClientSecret uses a service principal with the client secret
+	// in AZURE_CLIENT_SECRET or the AZURE_AUTH_LOCATION file.
+	AuthModeClientSecret = "client-secret"
+
+	// AuthModeClientCertificate uses a service principal with the PEM
+	// certificate and private key in the AZURE_CERTIFICATE_PATH file.
+	AuthModeClientCertificate = "client-certificate"
+
+	// AuthModeCLI uses the tokens cached by 'az login'.
+	AuthModeCLI = "cli"
+
+	// AuthModeMSI uses the managed identity of the Azure VM or container
+	// acictl runs on.
+	AuthModeMSI = "msi"
+
+	// AuthModeDeviceCode signs in interactively with a code entered in a
+	// browser.
+	AuthModeDeviceCode = "device-code"
+)
+
+// AuthModes lists the authentication modes in the order AuthModeAuto tries them.
+var AuthModes = []string{AuthModeAuto, AuthModeClientSecret, AuthModeClientCertificate, AuthModeCLI, AuthModeMSI, AuthModeDeviceCode}
+
+// azureCLIClientID is the public client ID of the Azure CLI, used by the
+// device code flow when no client ID is set.
+const azureCLIClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+
+// imdsProbeTimeout bounds the request checking for a managed identity endpoint
+// in the auto mode, which must fail fast outside of Azure.
+var imdsProbeTimeout = 1 * time.Second
+
+// credential creates a token provider for resource from one source of
+// credentials. It returns a *credentialUnavailableError when the source has
+// no credentials to offer.
+type credential func(auth *azure.Authentication, resource string) (adal.OAuthTokenProvider, error)
+
+// credentialUnavailableError explains why a source of credentials was skipped.
+type credentialUnavailableError struct {
+	mode   string
+	reason string
+}
+
+func (e *credentialUnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s", e.mode, e.reason)
+}
+
+func unavailable(mode string, format string, a ...interface{}) error {
+	return &credentialUnavailableError{mode: mode, reason: fmt.Sprintf(format, a...)}
+}
+
+var credentials = map[string]credential{
+	AuthModeClientSecret:      clientSecretCredential,
+	AuthModeClientCertificate: clientCertificateCredential,
+	AuthModeCLI:               cliCredential,
+	AuthModeMSI:               msiCredential,
+	AuthModeDeviceCode:        deviceCodeCredential,
+}
+
+// ValidateAuthMode returns an error if mode is not one of AuthModes.
+func ValidateAuthMode(mode string) error {
+	for _, m := range AuthModes {
+		if mode == m {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unknown authentication mode %q, must be one of %s", mode, strings.Join(AuthModes, ", "))
+}
+
+// newTokenProvider creates a token provider for the resource with the
+// credentials of mode, trying every mode in order for AuthModeAuto.
+func newTokenProvider(mode string, auth *azure.Authentication, resource string) (adal.OAuthTokenProvider, error) {
+	if mode != AuthModeAuto {
+		if err := ValidateAuthMode(mode); err != nil {
+			return nil, err
+		}
+		return credentials[mode](auth, resource)
+	}
+
+	reasons := []string{"No Azure credentials found:"}
+	for _, mode := range AuthModes[1:] {
+		if mode == AuthModeDeviceCode && !isTerminal(os.Stdin) {
+			reasons = append(reasons, "  "+unavailable(mode, "stdin is not a terminal").Error())
+			continue
+		}
+
+		tp, err := credentials[mode](auth, resource)
+		if unavailableErr, ok := err.(*credentialUnavailableError); ok {
+			reasons = append(reasons, "  "+unavailableErr.Error())
+			continue
+		}
+
+		return tp, err
+	}
+
+	return nil, fmt.Errorf("%s", strings.Join(reasons, "\n"))
+}
+
+// tokenResource returns the resource tokens are requested for, the Azure
+// Resource Manager endpoint with a trailing slash.
+func tokenResource(auth *azure.Authentication) string {
+	resource := auth.ResourceManagerEndpoint
+	if resource == "" {
+		resource = BaseURI
+	}
+
+	return strings.TrimSuffix(resource, "/") + "/"
+}
+
+func clientSecretCredential(auth *azure.Authentication, resource string) (adal.OAuthTokenProvider, error) {
+	if auth.ClientID == "" || auth.ClientSecret == "" || auth.TenantID == "" {
+		return nil, unavailable(AuthModeClientSecret, "AZURE_CLIENT_ID, AZURE_CLIENT_SECRET and AZURE_TENANT_ID must be set")
+	}
+
+	config, err := adal.NewOAuthConfig(auth.ActiveDirectoryEndpoint, auth.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new OAuth config for active directory failed: %v", err)
+	}
+
+	tp, err := adal.NewServicePrincipalToken(*config, auth.ClientID, auth.ClientSecret, resource)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new service principal token failed: %v", err)
+	}
+
+	return tp, nil
+}
+
+func clientCertificateCredential(auth *azure.Authentication, resource string) (adal.OAuthTokenProvider, error) {
+	certificatePath := os.Getenv("AZURE_CERTIFICATE_PATH")
+	if auth.ClientID == "" || certificatePath == "" || auth.TenantID == "" {
+		return nil, unavailable(AuthModeClientCertificate, "AZURE_CLIENT_ID, AZURE_CERTIFICATE_PATH and AZURE_TENANT_ID must be set")
+	}
+
+	data, err := ioutil.ReadFile(certificatePath)
+	if err != nil {
+		return nil, fmt.Errorf("Reading certificate file %q failed: %v", certificatePath, err)
+	}
+
+	certificate, privateKey, err := decodeCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("Decoding certificate file %q failed: %v", certificatePath, err)
+	}
+
+	config, err := adal.NewOAuthConfig(auth.ActiveDirectoryEndpoint, auth.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new OAuth config for active directory failed: %v", err)
+	}
+
+	tp, err := adal.NewServicePrincipalTokenFromCertificate(*config, auth.ClientID, certificate, privateKey, resource)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new service principal token from certificate failed: %v", err)
+	}
+
+	return tp, nil
+}
+
+// decodeCertificate returns the first certificate and the RSA private key of
+// a PEM file.
+func decodeCertificate(data []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	var certificate *x509.Certificate
+	var privateKey *rsa.PrivateKey
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			if certificate != nil {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			certificate = cert
+		case "RSA PRIVATE KEY":
+			key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			privateKey = key
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+			rsaKey, ok := key.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("The private key must be an RSA key")
+			}
+			privateKey = rsaKey
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, nil, fmt.Errorf("Encrypted private keys are not supported, decrypt it with 'openssl rsa'")
+		}
+	}
+
+	if certificate == nil || privateKey == nil {
+		return nil, nil, fmt.Errorf("The file must be PEM encoded and hold both the certificate and its private key, convert a PFX file with 'openssl pkcs12 -in cert.pfx -out cert.pem -nodes'")
+	}
+
+	return certificate, privateKey, nil
+}
+
+func msiCredential(auth *azure.Authentication, resource string) (adal.OAuthTokenProvider, error) {
+	// MSI_ENDPOINT is set in Azure Cloud Shell, and can point to a stub.
+	endpoint := os.Getenv("MSI_ENDPOINT")
+	if endpoint == "" {
+		endpoint, _ = adal.GetMSIVMEndpoint()
+		if err := probeIMDS(endpoint); err != nil {
+			return nil, unavailable(AuthModeMSI, "no managed identity endpoint at %s: %v", endpoint, err)
+		}
+	}
+
+	var tp *adal.ServicePrincipalToken
+	var err error
+	if auth.ClientID != "" {
+		// A user assigned identity.
+		tp, err = adal.NewServicePrincipalTokenFromMSIWithUserAssignedID(endpoint, resource, auth.ClientID)
+	} else {
+		tp, err = adal.NewServicePrincipalTokenFromMSI(endpoint, resource)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Creating new managed identity token failed: %v", err)
+	}
+
+	return tp, nil
+}
+
+// probeIMDS checks that the instance metadata service answers at endpoint.
+func probeIMDS(endpoint string) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := (&http.Client{Timeout: imdsProbeTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func deviceCodeCredential(auth *azure.Authentication, resource string) (adal.OAuthTokenProvider, error) {
+	tenantID := auth.TenantID
+	if tenantID == "" {
+		tenantID = "common"
+	}
+
+	clientID := auth.ClientID
+	if clientID == "" {
+		clientID = azureCLIClientID
+	}
+
+	config, err := adal.NewOAuthConfig(auth.ActiveDirectoryEndpoint, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new OAuth config for active directory failed: %v", err)
+	}
+
+	sender := &http.Client{}
+	code, err := adal.InitiateDeviceAuth(sender, *config, clientID, resource)
+	if err != nil {
+		return nil, fmt.Errorf("Starting the device code sign in failed: %v", err)
+	}
+
+	if code.Message != nil {
+		fmt.Fprintln(os.Stderr, *code.Message)
+	}
+
+	token, err := adal.WaitForUserCompletion(sender, code)
+	if err != nil {
+		return nil, fmt.Errorf("Device code sign in failed: %v", err)
+	}
+
+	tp, err := adal.NewServicePrincipalTokenFromManualToken(*config, clientID, resource, *token)
+	if err != nil {
+		return nil, fmt.Errorf("Creating new token from the device code sign in failed: %v", err)
+	}
+
+	return tp, nil
+}
+
+// isTerminal reports whether f is a character device other than the null
+// device, such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+
+	return true
+}
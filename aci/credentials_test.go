@@ -0,0 +1,251 @@
+package aci
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+const (
+	testTenant   = "tenant"
+	testResource = "https://management.azure.com/"
+)
+
+// tokenServer is a stub of the Active Directory token endpoint and of a
+// managed identity endpoint. It issues an access token naming the grant it
+// was requested with.
+func tokenServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var accessToken string
+		switch {
+		case r.URL.Path == "/msi/token":
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != testResource {
+				http.Error(w, "bad managed identity request", http.StatusBadRequest)
+				return
+			}
+			accessToken = "msi"
+		case r.URL.Path == "/"+testTenant+"/oauth2/token" && r.Method == http.MethodPost:
+			if err := r.ParseForm(); err != nil || r.PostForm.Get("resource") != testResource {
+				http.Error(w, "bad token request", http.StatusBadRequest)
+				return
+			}
+			switch r.PostForm.Get("grant_type") {
+			case "client_credentials":
+				if r.PostForm.Get("client_secret") != "secret" {
+					http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+					return
+				}
+				accessToken = "client-secret"
+			case "refresh_token":
+				accessToken = "refreshed-" + r.PostForm.Get("refresh_token")
+			}
+		}
+
+		if accessToken == "" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": accessToken,
+			"expires_in":   "3600",
+			"expires_on":   "4102444800",
+			"resource":     testResource,
+			"token_type":   "Bearer",
+		})
+	}))
+}
+
+// writeCLIFiles writes the files of an Azure CLI configuration directory and
+// points AZURE_CONFIG_DIR to it.
+func writeCLIFiles(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("AZURE_CONFIG_DIR", dir)
+}
+
+// msalCache returns an MSAL token cache with a refresh token of the Azure CLI
+// for the account signed in to realm at environment.
+func msalCache(environment, realm, secret string) string {
+	account := "oid." + realm
+	return `{
+  "Account": {
+    "` + account + `-` + environment + `-` + realm + `": {"home_account_id": "` + account + `", "environment": "` + environment + `", "realm": "` + realm + `"}
+  },
+  "RefreshToken": {
+    "` + account + `-` + environment + `-refreshtoken-` + azureCLIClientID + `--": {"home_account_id": "` + account + `", "environment": "` + environment + `", "client_id": "` + azureCLIClientID + `", "secret": "` + secret + `"}
+  }
+}`
+}
+
+func TestTokenProvider(t *testing.T) {
+	srv := tokenServer(t)
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	profile := `{"subscriptions": [{"id": "sub", "tenantId": "` + testTenant + `", "isDefault": true}]}`
+
+	tests := []struct {
+		name         string
+		mode         string
+		clientID     string
+		secret       string
+		tenantID     string
+		msiEndpoint  bool
+		cliFiles     map[string]string
+		wantToken    string
+		wantErr      bool
+		wantTenantID string
+	}{
+		{
+			name:         "client secret",
+			mode:         AuthModeClientSecret,
+			clientID:     "app",
+			secret:       "secret",
+			tenantID:     testTenant,
+			wantToken:    "client-secret",
+			wantTenantID: testTenant,
+		},
+		{
+			name:         "wrong client secret",
+			mode:         AuthModeClientSecret,
+			clientID:     "app",
+			secret:       "wrong",
+			tenantID:     testTenant,
+			wantErr:      true,
+			wantTenantID: testTenant,
+		},
+		{
+			name: "cli msal cache",
+			mode: AuthModeCLI,
+			cliFiles: map[string]string{
+				"azureProfile.json":     profile,
+				"msal_token_cache.json": msalCache(host, testTenant, "rt"),
+			},
+			wantToken:    "refreshed-rt",
+			wantTenantID: testTenant,
+		},
+		{
+			name: "cli msal cache of another tenant",
+			mode: AuthModeCLI,
+			cliFiles: map[string]string{
+				"azureProfile.json":     profile,
+				"msal_token_cache.json": msalCache(host, "other", "rt"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "cli msal cache of another cloud",
+			mode: AuthModeCLI,
+			cliFiles: map[string]string{
+				"azureProfile.json":     profile,
+				"msal_token_cache.json": msalCache("login.microsoftonline.com", testTenant, "rt"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "cli access tokens",
+			mode: AuthModeCLI,
+			cliFiles: map[string]string{
+				"azureProfile.json": profile,
+				"accessTokens.json": `[
+  {"_authority": "https://login.microsoftonline.com/` + testTenant + `", "_clientId": "` + azureCLIClientID + `", "resource": "https://management.core.windows.net/", "refreshToken": "public-rt", "expiresOn": "2001-01-01 00:00:00.000000"},
+  {"_authority": "` + srv.URL + `/` + testTenant + `", "_clientId": "` + azureCLIClientID + `", "resource": "https://management.core.windows.net/", "refreshToken": "rt", "expiresOn": "2001-01-01 00:00:00.000000"}
+]`,
+			},
+			wantToken:    "refreshed-rt",
+			wantTenantID: testTenant,
+		},
+		{
+			name:        "msi",
+			mode:        AuthModeMSI,
+			msiEndpoint: true,
+			wantToken:   "msi",
+		},
+		{
+			// The Azure CLI has no token for the tenant of its default
+			// subscription, its tenant must not leak to the next modes.
+			name:        "auto falls back from cli",
+			mode:        AuthModeAuto,
+			msiEndpoint: true,
+			cliFiles: map[string]string{
+				"azureProfile.json":     profile,
+				"msal_token_cache.json": msalCache(host, "other", "rt"),
+			},
+			wantToken: "msi",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeCLIFiles(t, test.cliFiles)
+			t.Setenv("AZURE_CERTIFICATE_PATH", "")
+			t.Setenv("MSI_ENDPOINT", "")
+			if test.msiEndpoint {
+				t.Setenv("MSI_ENDPOINT", srv.URL+"/msi/token")
+			}
+
+			auth := &azure.Authentication{
+				ClientID:                test.clientID,
+				ClientSecret:            test.secret,
+				TenantID:                test.tenantID,
+				ActiveDirectoryEndpoint: srv.URL + "/",
+			}
+
+			tp, err := newTokenProvider(test.mode, auth, testResource)
+			if err == nil {
+				err = tp.(adal.Refresher).Refresh()
+			}
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Token provider returned token %q, want an error", tp.OAuthToken())
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Token provider failed: %v", err)
+				}
+				if got := tp.OAuthToken(); got != test.wantToken {
+					t.Errorf("Token provider returned token %q, want %q", got, test.wantToken)
+				}
+			}
+
+			if auth.TenantID != test.wantTenantID {
+				t.Errorf("Authentication has tenant %q, want %q", auth.TenantID, test.wantTenantID)
+			}
+		})
+	}
+}
+
+func TestIsAuthority(t *testing.T) {
+	tests := []struct {
+		authority string
+		want      bool
+	}{
+		{authority: "https://login.microsoftonline.com/tenant", want: true},
+		{authority: "https://login.microsoftonline.com/tenant/", want: true},
+		{authority: "https://login.microsoftonline.com/TENANT", want: true},
+		{authority: "https://login.microsoftonline.us/tenant", want: false},
+		{authority: "https://login.microsoftonline.com/other-tenant", want: false},
+		{authority: "https://login.microsoftonline.com/common", want: false},
+	}
+
+	for _, test := range tests {
+		if got := isAuthority(test.authority, "login.microsoftonline.com", "tenant"); got != test.want {
+			t.Errorf("isAuthority(%q) = %t, want %t", test.authority, got, test.want)
+		}
+	}
+}
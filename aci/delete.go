@@ -0,0 +1,69 @@
+package aci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+// DeleteContainerGroup deletes an Azure Container Instance in the provided
+// resource group with the given container group name.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/delete
+func (c *Client) DeleteContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	urlParams := url.Values{
+		"api-version": []string{apiVersion},
+	}
+
+	// Create the url.
+	uri := api.ResolveRelative(c.baseURI, containerGroupURLPath)
+	uri += "?" + url.Values(urlParams).Encode()
+
+	// Create the request.
+	req, err := http.NewRequest("DELETE", uri, nil)
+	if err != nil {
+		return fmt.Errorf("Creating delete container group uri request failed: %v", err)
+	}
+	var uncertain bool
+	req = trackUncertain(req.WithContext(ctx), &uncertain)
+
+	// Add the parameters to the url.
+	if err := api.ExpandURL(req.URL, map[string]string{
+		"subscriptionId":     c.auth.SubscriptionID,
+		"resourceGroup":      resourceGroup,
+		"containerGroupName": containerGroupName,
+	}); err != nil {
+		return fmt.Errorf("Expanding URL with parameters failed: %v", err)
+	}
+
+	// Send the request.
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("Sending delete container group request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	// 204 No Content means the specified container group was not found. A
+	// retried deletion also finds nothing when an earlier attempt, whose
+	// response was lost, deleted the container group.
+	if resp.StatusCode == http.StatusNoContent {
+		if uncertain {
+			return nil
+		}
+		return &Error{
+			StatusCode: http.StatusNotFound,
+			Code:       "ResourceNotFound",
+			Message:    fmt.Sprintf("Container group with name %q was not found", containerGroupName),
+			URL:        req.URL.String(),
+		}
+	}
+
+	// 202 (Accepted) means the deletion is still in progress.
+	return c.waitForOperation(ctx, resp)
+}
@@ -0,0 +1,210 @@
+package aci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Error is an error response of Azure Resource Manager.
+// From: https://github.com/Azure/azure-resource-manager-rpc/blob/master/v1.0/common-api-details.md#error-response-content
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code identifies the error, for example ContainerGroupQuotaReached.
+	Code string
+	// Message describes the error.
+	Message string
+	// Target is the property the error is about, if any.
+	Target string
+	// Details holds the errors that led to this one.
+	Details []ErrorDetail
+	// URL is the URL of the request.
+	URL string
+}
+
+// ErrorDetail is a nested error of an Azure Resource Manager error response.
+type ErrorDetail struct {
+	Code    string        `json:"code"`
+	Target  string        `json:"target,omitempty"`
+	Message string        `json:"message"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("Azure returned HTTP status %d", e.StatusCode)
+	if e.Code != "" {
+		msg += fmt.Sprintf(" with error code %q", e.Code)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	for _, detail := range flattenDetails(e.Details) {
+		msg += fmt.Sprintf("\n  %s: %s", detail.Code, detail.Message)
+	}
+
+	return msg
+}
+
+// flattenDetails lists the nested details depth first.
+func flattenDetails(details []ErrorDetail) []ErrorDetail {
+	var flat []ErrorDetail
+	for _, detail := range details {
+		flat = append(flat, detail)
+		flat = append(flat, flattenDetails(detail.Details)...)
+	}
+
+	return flat
+}
+
+// checkResponse returns an *Error if the status code of the response is not
+// 2xx, decoding the error response body when there is one.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	armErr := &Error{StatusCode: resp.StatusCode}
+	if resp.Request != nil {
+		armErr.URL = resp.Request.URL.String()
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		armErr.Message = fmt.Sprintf("Reading the error response body failed: %v", err)
+		return armErr
+	}
+
+	// Most errors are wrapped in an error property, some are not.
+	var reply struct {
+		Error *ErrorDetail `json:"error"`
+	}
+	var detail ErrorDetail
+	switch {
+	case json.Unmarshal(body, &reply) == nil && reply.Error != nil:
+		detail = *reply.Error
+	case json.Unmarshal(body, &detail) == nil && detail.Code != "":
+	default:
+		detail.Message = strings.TrimSpace(string(body))
+	}
+
+	armErr.Code = detail.Code
+	armErr.Message = detail.Message
+	armErr.Target = detail.Target
+	armErr.Details = detail.Details
+
+	return armErr
+}
+
+// ErrorClass groups errors by what the user can do about them.
+type ErrorClass int
+
+// Error classes, from ErrorClassUnknown for errors without an Azure error code.
+const (
+	ErrorClassUnknown ErrorClass = iota
+	ErrorClassInvalidRequest
+	ErrorClassAuthorization
+	ErrorClassNotFound
+	ErrorClassConflict
+	ErrorClassQuota
+	ErrorClassImage
+	ErrorClassThrottled
+	ErrorClassServer
+)
+
+var (
+	errorCodeClasses = map[string]ErrorClass{
+		"InvalidContainerGroupName":           ErrorClassInvalidRequest,
+		"ResourceRequestsNotSupported":        ErrorClassInvalidRequest,
+		"InvalidRequestContent":               ErrorClassInvalidRequest,
+		"LocationNotAvailableForResourceType": ErrorClassInvalidRequest,
+		"AuthenticationFailed":                ErrorClassAuthorization,
+		"AuthorizationFailed":                 ErrorClassAuthorization,
+		"InvalidAuthenticationToken":          ErrorClassAuthorization,
+		"ResourceNotFound":                    ErrorClassNotFound,
+		"ResourceGroupNotFound":               ErrorClassNotFound,
+		"ContainerGroupQuotaReached":          ErrorClassQuota,
+		"InaccessibleImage":                   ErrorClassImage,
+		"RegistryErrorResponse":               ErrorClassImage,
+	}
+
+	errorCodeHints = map[string]string{
+		"InvalidContainerGroupName":    "Container group names must be 1 to 63 lowercase letters, numbers and '-', starting and ending with a letter or number. Shorten the deployment name or pick another --naming scheme.",
+		"ResourceRequestsNotSupported": "The region can not satisfy the CPU, memory or GPU requests of the containers. Lower the resource requests or pick another region with -r.",
+		"InaccessibleImage":            "Check the image name and tag, and that the image is public or the registry credentials are set in imagePullSecrets.",
+		"ContainerGroupQuotaReached":   "Delete unused container groups, deploy to another region with -r, or request a quota increase from Azure support.",
+		"RegistryErrorResponse":        "The container registry returned an error. Check the registry credentials and that the registry is reachable, then try again.",
+		"ResourceGroupNotFound":        "Create the resource group first with 'az group create', or pass an existing one with -g.",
+		"AuthorizationFailed":          "The service principal needs the Contributor role on the resource group or subscription.",
+	}
+)
+
+// ClassifyError returns the class of the first Azure error found in err.
+func ClassifyError(err error) ErrorClass {
+	code, statusCode := errorCode(err)
+	if class, ok := errorCodeClasses[code]; ok {
+		return class
+	}
+
+	switch {
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity:
+		return ErrorClassInvalidRequest
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorClassAuthorization
+	case statusCode == http.StatusNotFound:
+		return ErrorClassNotFound
+	case statusCode == http.StatusConflict:
+		return ErrorClassConflict
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorClassThrottled
+	case statusCode >= 500:
+		return ErrorClassServer
+	}
+
+	return ErrorClassUnknown
+}
+
+// ErrorHint returns how to fix the first Azure error found in err, or an empty
+// string when there is no known remediation.
+func ErrorHint(err error) string {
+	code, _ := errorCode(err)
+	return errorCodeHints[code]
+}
+
+// codedError is implemented by the Azure errors and failed operations that
+// carry an error code.
+type codedError interface {
+	error
+	errorCode() (string, int)
+}
+
+// errorCode returns the error code and HTTP status code of the first Azure
+// error or failed operation in the chain of err.
+func errorCode(err error) (string, int) {
+	var coded codedError
+	if errors.As(err, &coded) {
+		return coded.errorCode()
+	}
+
+	return "", 0
+}
+
+func (e *Error) errorCode() (string, int) {
+	// The details are more specific, for example a bad request caused by an
+	// inaccessible image.
+	for _, detail := range flattenDetails(e.Details) {
+		if _, ok := errorCodeClasses[detail.Code]; ok {
+			return detail.Code, e.StatusCode
+		}
+	}
+
+	return e.Code, e.StatusCode
+}
+
+func (e *OperationError) errorCode() (string, int) {
+	return e.Code, 0
+}
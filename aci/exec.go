@@ -0,0 +1,93 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+const containerExecURLPath = containerGroupURLPath + "/containers/{{.containerName}}/exec"
+
+// TerminalSize is the size of the terminal of an exec session.
+type TerminalSize struct {
+	Rows int `json:"rows,omitempty"`
+	Cols int `json:"cols,omitempty"`
+}
+
+// ExecRequest is the request body of the executeCommand operation.
+type ExecRequest struct {
+	Command      string       `json:"command,omitempty"`
+	TerminalSize TerminalSize `json:"terminalSize,omitempty"`
+}
+
+// ExecResponse holds the websocket URI and password of an exec session.
+type ExecResponse struct {
+	api.ResponseMetadata `json:"-"`
+	WebSocketURI         string `json:"webSocketUri,omitempty"`
+	Password             string `json:"password,omitempty"`
+}
+
+// ExecuteCommand starts an exec session running command in a container of the
+// container group. The terminal size is fixed when the session is created.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containers/executecommand
+func (c *Client) ExecuteCommand(ctx context.Context, resourceGroup, containerGroupName, containerName string, execRequest ExecRequest) (*ExecResponse, error) {
+	urlParams := url.Values{
+		"api-version": []string{apiVersion},
+	}
+
+	// Create the url.
+	uri := api.ResolveRelative(c.baseURI, containerExecURLPath)
+	uri += "?" + url.Values(urlParams).Encode()
+
+	// Create the body for the request.
+	b := new(bytes.Buffer)
+	if err := json.NewEncoder(b).Encode(execRequest); err != nil {
+		return nil, fmt.Errorf("Encoding execute command body request failed: %v", err)
+	}
+
+	// Create the request.
+	req, err := http.NewRequest("POST", uri, b)
+	if err != nil {
+		return nil, fmt.Errorf("Creating execute command uri request failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+
+	// Add the parameters to the url.
+	if err := api.ExpandURL(req.URL, map[string]string{
+		"subscriptionId":     c.auth.SubscriptionID,
+		"resourceGroup":      resourceGroup,
+		"containerGroupName": containerGroupName,
+		"containerName":      containerName,
+	}); err != nil {
+		return nil, fmt.Errorf("Expanding URL with parameters failed: %v", err)
+	}
+
+	// Send the request.
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Sending execute command request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 200 (OK) is a success response.
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	// Decode the body from the response.
+	if resp.Body == nil {
+		return nil, errors.New("Execute command returned an empty body in the response")
+	}
+	var execResponse ExecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&execResponse); err != nil {
+		return nil, fmt.Errorf("Decoding execute command response body failed: %v", err)
+	}
+
+	return &execResponse, nil
+}
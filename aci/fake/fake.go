@@ -0,0 +1,586 @@
+// Package fake provides an in-memory implementation of aci.ContainerGroupClient
+// for testing acictl without an Azure subscription.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+// Client is an in-memory aci.ContainerGroupClient.
+//
+// New container groups start in the Creating provisioning state and advance
+// one step towards Succeeded and Running every time they are read, so callers
+// polling for readiness see the same transitions as against ACI. Like ACI, the
+// content of secret volumes and the registry passwords are never returned.
+// The methods of Client are safe for concurrent use by multiple goroutines.
+type Client struct {
+	// SubscriptionID is used to build the resource IDs of container groups.
+	SubscriptionID string
+
+	// ProvisioningSteps is the number of reads a new container group stays
+	// in the Creating state for.
+	ProvisioningSteps int
+
+	// Quota is the maximum number of container groups per resource group,
+	// zero means unlimited.
+	Quota int
+
+	// FailingImages lists images that fail to pull, container groups using
+	// them end up in the Failed state.
+	FailingImages map[string]bool
+
+	// RunSteps is the number of reads the containers of a provisioned
+	// container group with the Never or OnFailure restart policy run for
+	// before they exit, zero means they run until stopped.
+	RunSteps int
+
+	// ExitCodes are the exit codes of the containers running an image, the
+	// other containers exit with 0. With the OnFailure restart policy,
+	// containers exiting with another code are restarted.
+	ExitCodes map[string]int32
+
+	// ExecURI and ExecPassword are the websocket URI and password of exec
+	// sessions, such as those of a test server. Executing commands fails
+	// with NotImplemented when ExecURI is empty.
+	ExecURI      string
+	ExecPassword string
+
+	mu     sync.Mutex
+	groups map[string]map[string]*storedGroup
+}
+
+type storedGroup struct {
+	cg    client.ContainerGroup
+	steps int
+	logs  map[string]string
+
+	// runSteps is the number of reads the containers run for, and running
+	// the number of reads left before they exit.
+	runSteps int
+	running  int
+}
+
+var _ aci.ContainerGroupClient = &Client{}
+
+// NewClient creates an empty fake client.
+func NewClient() *Client {
+	return &Client{
+		SubscriptionID:    "00000000-0000-0000-0000-000000000000",
+		ProvisioningSteps: 1,
+		FailingImages:     map[string]bool{},
+		ExitCodes:         map[string]int32{},
+		groups:            map[string]map[string]*storedGroup{},
+	}
+}
+
+// SetLogs sets the logs returned for a container of a container group.
+func (c *Client) SetLogs(resourceGroup, containerGroupName, containerName, logs string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	group.logs[containerName] = logs
+
+	return nil
+}
+
+// CreateContainerGroup creates or replaces a container group.
+func (c *Client) CreateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.groups[resourceGroup] == nil {
+		c.groups[resourceGroup] = map[string]*storedGroup{}
+	}
+
+	existing, ok := c.groups[resourceGroup][containerGroupName]
+	if ok && existing.steps > 0 {
+		return nil, newError(http.StatusConflict, "Conflict", fmt.Sprintf("The container group '%s' is still being provisioned.", containerGroupName))
+	}
+
+	if !ok && c.Quota > 0 && len(c.groups[resourceGroup]) >= c.Quota {
+		return nil, newError(http.StatusConflict, "ContainerGroupQuotaReached", fmt.Sprintf("Resource type 'Microsoft.ContainerInstance/containerGroups' container group quota '%d' exceeded in region '%s'.", c.Quota, containerGroup.Location))
+	}
+
+	cg := deepCopy(&containerGroup)
+	cg.ID = fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.ContainerInstance/containerGroups/%s", c.SubscriptionID, resourceGroup, containerGroupName)
+	cg.Name = containerGroupName
+	cg.Type = "Microsoft.ContainerInstance/containerGroups"
+
+	group := &storedGroup{cg: *cg, logs: map[string]string{}, runSteps: c.RunSteps}
+	if ok {
+		group.logs = existing.logs
+	}
+	group.provision(c.ProvisioningSteps)
+	c.groups[resourceGroup][containerGroupName] = group
+
+	if aci.OperationWaitRequested(ctx) {
+		if err := group.finish(c.FailingImages); err != nil {
+			return nil, err
+		}
+	}
+
+	return response(&group.cg), nil
+}
+
+// GetContainerGroup returns a container group, advancing its provisioning and
+// the containers of run to completion container groups.
+func (c *Client) GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*client.ContainerGroup, error, *int) {
+	if err := ctx.Err(); err != nil {
+		return nil, err, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return nil, err, &err.StatusCode
+	}
+
+	group.step(c.FailingImages)
+	group.run(c.ExitCodes)
+
+	status := http.StatusOK
+	return response(&group.cg), nil, &status
+}
+
+// ListContainerGroups lists the container groups of the resource group, or of
+// every resource group when it is empty. Like ACI, the instance views are
+// not included.
+func (c *Client) ListContainerGroups(ctx context.Context, resourceGroup string) (*client.ContainerGroupListResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	list := &client.ContainerGroupListResult{Value: []client.ContainerGroup{}}
+	for rg, groups := range c.groups {
+		if resourceGroup != "" && rg != resourceGroup {
+			continue
+		}
+
+		for _, group := range groups {
+			cg := response(&group.cg)
+			cg.InstanceView = client.ContainerGroupPropertiesInstanceView{}
+			for i := range cg.Containers {
+				cg.Containers[i].InstanceView = client.ContainerPropertiesInstanceView{}
+			}
+			list.Value = append(list.Value, *cg)
+		}
+	}
+
+	sort.Slice(list.Value, func(i, j int) bool {
+		return list.Value[i].ID < list.Value[j].ID
+	})
+
+	return list, nil
+}
+
+// UpdateContainerGroup updates a container group.
+func (c *Client) UpdateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error) {
+	return c.CreateContainerGroup(ctx, resourceGroup, containerGroupName, containerGroup)
+}
+
+// UpdateContainerGroupTags replaces the tags of a container group.
+func (c *Client) UpdateContainerGroupTags(ctx context.Context, resourceGroup, containerGroupName string, tags map[string]string) (*client.ContainerGroup, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	group.cg.Tags = map[string]string{}
+	for k, v := range tags {
+		group.cg.Tags[k] = v
+	}
+
+	return response(&group.cg), nil
+}
+
+// DeleteContainerGroup deletes a container group.
+func (c *Client) DeleteContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.lookup(resourceGroup, containerGroupName); err != nil {
+		return err
+	}
+
+	delete(c.groups[resourceGroup], containerGroupName)
+
+	return nil
+}
+
+// GetContainerLogs returns the logs set with SetLogs, limited to the last tail lines.
+func (c *Client) GetContainerLogs(ctx context.Context, resourceGroup, containerGroupName, containerName string, tail int) (*client.Logs, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !group.hasContainer(containerName) {
+		return nil, newError(http.StatusNotFound, "ContainerNotFound", fmt.Sprintf("The container '%s' is not found in container group '%s'.", containerName, containerGroupName))
+	}
+
+	lines := strings.SplitAfter(group.logs[containerName], "\n")
+	if tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+
+	return &client.Logs{Content: strings.Join(lines, "")}, nil
+}
+
+// RestartContainerGroup restarts the containers of a running container group.
+func (c *Client) RestartContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	for i := range group.cg.Containers {
+		view := &group.cg.Containers[i].InstanceView
+		view.RestartCount++
+		view.PreviousState = view.CurrentState
+		view.CurrentState = client.ContainerState{State: "Running", StartTime: api.JSONTime(time.Now())}
+		view.Events = append(view.Events, newEvent("Started", "Restarted container"))
+	}
+
+	return nil
+}
+
+// StopContainerGroup stops a container group.
+func (c *Client) StopContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	group.steps = 0
+	group.running = 0
+	group.cg.InstanceView.State = "Stopped"
+	for i := range group.cg.Containers {
+		view := &group.cg.Containers[i].InstanceView
+		view.PreviousState = view.CurrentState
+		view.CurrentState = client.ContainerState{State: "Terminated", FinishTime: api.JSONTime(time.Now()), DetailStatus: "Stopped"}
+		view.Events = append(view.Events, newEvent("Killing", "Killing container"))
+	}
+
+	return nil
+}
+
+// StartContainerGroup starts a stopped container group, it provisions again
+// like a new container group.
+func (c *Client) StartContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return err
+	}
+
+	if group.cg.InstanceView.State != "Stopped" {
+		return newError(http.StatusConflict, "ContainerGroupNotStopped", fmt.Sprintf("The container group '%s' is not stopped.", containerGroupName))
+	}
+
+	group.provision(c.ProvisioningSteps)
+
+	if aci.OperationWaitRequested(ctx) {
+		return group.finish(c.FailingImages)
+	}
+
+	return nil
+}
+
+// ExecuteCommand returns a session at ExecURI for a container of a running
+// container group.
+func (c *Client) ExecuteCommand(ctx context.Context, resourceGroup, containerGroupName, containerName string, execRequest aci.ExecRequest) (*aci.ExecResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.ExecURI == "" {
+		return nil, newError(http.StatusNotImplemented, "NotImplemented", "The fake client has no ExecURI to execute commands.")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	group, err := c.lookup(resourceGroup, containerGroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !group.hasContainer(containerName) {
+		return nil, newError(http.StatusNotFound, "ContainerNotFound", fmt.Sprintf("The container '%s' is not found in container group '%s'.", containerName, containerGroupName))
+	}
+
+	if group.cg.InstanceView.State != "Running" {
+		return nil, newError(http.StatusConflict, "ContainerGroupNotRunning", fmt.Sprintf("The container group '%s' is not running.", containerGroupName))
+	}
+
+	return &aci.ExecResponse{WebSocketURI: c.ExecURI, Password: c.ExecPassword}, nil
+}
+
+func (c *Client) lookup(resourceGroup, containerGroupName string) (*storedGroup, *aci.Error) {
+	group, ok := c.groups[resourceGroup][containerGroupName]
+	if !ok {
+		return nil, newError(http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The Resource 'Microsoft.ContainerInstance/containerGroups/%s' under resource group '%s' was not found.", containerGroupName, resourceGroup))
+	}
+
+	return group, nil
+}
+
+// provision resets the container group to the start of provisioning.
+func (g *storedGroup) provision(steps int) {
+	g.steps = steps
+	g.cg.ProvisioningState = "Creating"
+	g.cg.InstanceView = client.ContainerGroupPropertiesInstanceView{State: "Pending"}
+	for i := range g.cg.Containers {
+		g.cg.Containers[i].InstanceView = client.ContainerPropertiesInstanceView{
+			CurrentState: client.ContainerState{State: "Waiting"},
+			Events:       []client.Event{newEvent("Pulling", "pulling image \""+g.cg.Containers[i].Image+"\"")},
+		}
+	}
+
+	if steps <= 0 {
+		g.steps = 1
+		g.step(nil)
+	}
+}
+
+// step advances provisioning, finishing it when no steps are left.
+func (g *storedGroup) step(failingImages map[string]bool) {
+	if g.steps == 0 {
+		return
+	}
+
+	g.steps--
+	if g.steps > 0 {
+		return
+	}
+
+	g.cg.ProvisioningState = "Succeeded"
+	g.cg.InstanceView.State = "Running"
+	for i, container := range g.cg.Containers {
+		view := &g.cg.Containers[i].InstanceView
+		if failingImages[container.Image] {
+			g.cg.ProvisioningState = "Failed"
+			g.cg.InstanceView.State = "Failed"
+			view.CurrentState = client.ContainerState{State: "Waiting", DetailStatus: "ErrImagePull"}
+			view.Events = append(view.Events, newEvent("Failed", "Failed to pull image \""+container.Image+"\""))
+			continue
+		}
+
+		view.CurrentState = client.ContainerState{State: "Running", StartTime: api.JSONTime(time.Now())}
+		view.Events = append(view.Events,
+			newEvent("Pulled", "Successfully pulled image \""+container.Image+"\""),
+			newEvent("Created", "Created container"),
+			newEvent("Started", "Started container"),
+		)
+	}
+
+	if g.cg.ProvisioningState == "Succeeded" && g.cg.RestartPolicy != client.Always && g.cg.RestartPolicy != "" {
+		g.running = g.runSteps
+	}
+}
+
+// run advances the running containers of a container group with the Never or
+// OnFailure restart policy, and makes them exit when no steps are left. The
+// container group succeeds once every container exited with 0, and fails once
+// a container exited with another code it is not restarted for.
+func (g *storedGroup) run(exitCodes map[string]int32) {
+	if g.running == 0 {
+		return
+	}
+
+	g.running--
+	if g.running > 0 {
+		return
+	}
+
+	now := api.JSONTime(time.Now())
+	succeeded, terminated := true, true
+	for i, container := range g.cg.Containers {
+		view := &g.cg.Containers[i].InstanceView
+		if view.CurrentState.State != "Running" {
+			continue
+		}
+
+		exited := client.ContainerState{State: "Terminated", StartTime: view.CurrentState.StartTime, FinishTime: now, ExitCode: exitCodes[container.Image], DetailStatus: "Completed"}
+		if exited.ExitCode != 0 {
+			exited.DetailStatus = "Error"
+		}
+
+		g.logs[container.Name] += fmt.Sprintf("Container %s exited with code %d.\n", container.Name, exited.ExitCode)
+
+		if exited.ExitCode != 0 && g.cg.RestartPolicy == client.OnFailure {
+			view.RestartCount++
+			view.PreviousState = exited
+			view.CurrentState = client.ContainerState{State: "Running", StartTime: now}
+			view.Events = append(view.Events, newEvent("Started", "Restarted container"))
+			terminated = false
+			continue
+		}
+
+		view.CurrentState = exited
+		view.Events = append(view.Events, newEvent("Killing", "Container exited"))
+		succeeded = succeeded && exited.ExitCode == 0
+	}
+
+	switch {
+	case !terminated:
+		g.running = g.runSteps
+	case succeeded:
+		g.cg.InstanceView.State = "Succeeded"
+	default:
+		g.cg.InstanceView.State = "Failed"
+	}
+}
+
+// finish completes provisioning like waiting for the create operation does,
+// returning the operation error when provisioning failed.
+func (g *storedGroup) finish(failingImages map[string]bool) error {
+	for g.steps > 0 {
+		g.step(failingImages)
+	}
+
+	if g.cg.ProvisioningState != "Failed" {
+		return nil
+	}
+
+	for _, container := range g.cg.Containers {
+		if failingImages[container.Image] {
+			return &aci.OperationError{
+				Status:  "Failed",
+				Code:    "InaccessibleImage",
+				Message: fmt.Sprintf("The image '%s' in container group '%s' is not accessible. Please check the image and registry credential.", container.Image, g.cg.Name),
+			}
+		}
+	}
+
+	return &aci.OperationError{Status: "Failed", Code: "Failed", Message: fmt.Sprintf("The container group '%s' failed to provision.", g.cg.Name)}
+}
+
+func (g *storedGroup) hasContainer(name string) bool {
+	for _, container := range g.cg.Containers {
+		if container.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newEvent(name, message string) client.Event {
+	now := api.JSONTime(time.Now())
+	eventType := "Normal"
+	if name == "Failed" {
+		eventType = "Warning"
+	}
+
+	return client.Event{
+		Count:          1,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Name:           name,
+		Message:        message,
+		Type:           eventType,
+	}
+}
+
+func newError(statusCode int, code, message string) *aci.Error {
+	return &aci.Error{
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    message,
+	}
+}
+
+// response copies the container group as ACI returns it, without the content
+// of its secret volumes and its registry passwords.
+func response(cg *client.ContainerGroup) *client.ContainerGroup {
+	copied := deepCopy(cg)
+	for _, volume := range copied.Volumes {
+		for file := range volume.Secret {
+			volume.Secret[file] = ""
+		}
+	}
+	for i := range copied.ImageRegistryCredentials {
+		copied.ImageRegistryCredentials[i].Password = ""
+	}
+
+	return copied
+}
+
+// deepCopy copies the container group so callers can't modify the stored state.
+func deepCopy(cg *client.ContainerGroup) *client.ContainerGroup {
+	data, err := json.Marshal(cg)
+	if err != nil {
+		panic(err)
+	}
+
+	var copied client.ContainerGroup
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(err)
+	}
+
+	return &copied
+}
@@ -0,0 +1,42 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+func TestNotFound(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient()
+
+	_, getErr, status := c.GetContainerGroup(ctx, "rg", "missing")
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{name: "get", err: getErr},
+		{name: "delete", err: c.DeleteContainerGroup(ctx, "rg", "missing")},
+		{name: "restart", err: c.RestartContainerGroup(ctx, "rg", "missing")},
+		{name: "stop", err: c.StopContainerGroup(ctx, "rg", "missing")},
+	}
+
+	if status == nil || *status != http.StatusNotFound {
+		t.Errorf("Get returned status %v, want %d", status, http.StatusNotFound)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var armErr *aci.Error
+			if !errors.As(test.err, &armErr) || armErr.StatusCode != http.StatusNotFound {
+				t.Fatalf("Got %v, want an *aci.Error with status %d", test.err, http.StatusNotFound)
+			}
+			if class := aci.ClassifyError(test.err); class != aci.ErrorClassNotFound {
+				t.Errorf("Error class is %d, want %d", class, aci.ErrorClassNotFound)
+			}
+		})
+	}
+}
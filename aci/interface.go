@@ -0,0 +1,27 @@
+package aci
+
+import (
+	"context"
+
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// ContainerGroupClient is the set of container group operations acictl uses.
+// It is implemented by Client and by the in-memory fake in the fake package.
+// Every operation is abandoned when its context is done.
+type ContainerGroupClient interface {
+	CreateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error)
+	GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*client.ContainerGroup, error, *int)
+	ListContainerGroups(ctx context.Context, resourceGroup string) (*client.ContainerGroupListResult, error)
+	UpdateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error)
+	UpdateContainerGroupTags(ctx context.Context, resourceGroup, containerGroupName string, tags map[string]string) (*client.ContainerGroup, error)
+	DeleteContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error
+	GetContainerLogs(ctx context.Context, resourceGroup, containerGroupName, containerName string, tail int) (*client.Logs, error)
+
+	RestartContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error
+	StopContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error
+	StartContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error
+	ExecuteCommand(ctx context.Context, resourceGroup, containerGroupName, containerName string, execRequest ExecRequest) (*ExecResponse, error)
+}
+
+var _ ContainerGroupClient = &Client{}
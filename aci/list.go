@@ -0,0 +1,98 @@
+package aci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+// ListContainerGroups lists an Azure Container Instance Groups, if a resource
+// group is given it will list by resource group.
+// It optionally accepts a resource group name and will filter based off of it
+// if it is not empty. Every page of the result is fetched by following the
+// nextLink of the response.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/list
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/listbyresourcegroup
+func (c *Client) ListContainerGroups(ctx context.Context, resourceGroup string) (*client.ContainerGroupListResult, error) {
+	urlParams := url.Values{
+		"api-version": []string{apiVersion},
+	}
+
+	// Create the url.
+	uri := api.ResolveRelative(c.baseURI, containerGroupListURLPath)
+	// List by resource group if they passed one.
+	if resourceGroup != "" {
+		uri = api.ResolveRelative(c.baseURI, containerGroupListByResourceGroupURLPath)
+	}
+	uri += "?" + url.Values(urlParams).Encode()
+
+	// Create the request.
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Creating get container group list uri request failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+
+	// Add the parameters to the url.
+	if err := api.ExpandURL(req.URL, map[string]string{
+		"subscriptionId": c.auth.SubscriptionID,
+		"resourceGroup":  resourceGroup,
+	}); err != nil {
+		return nil, fmt.Errorf("Expanding URL with parameters failed: %v", err)
+	}
+
+	list := &client.ContainerGroupListResult{}
+	for {
+		page, err := c.listContainerGroupsPage(req)
+		if err != nil {
+			return nil, err
+		}
+
+		list.ResponseMetadata = page.ResponseMetadata
+		list.Value = append(list.Value, page.Value...)
+
+		if page.NextLink == "" {
+			return list, nil
+		}
+
+		req, err = http.NewRequest("GET", page.NextLink, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Creating get container group list next page request failed: %v", err)
+		}
+		req = req.WithContext(ctx)
+	}
+}
+
+func (c *Client) listContainerGroupsPage(req *http.Request) (*client.ContainerGroupListResult, error) {
+	// Send the request.
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Sending get container group list request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 200 (OK) is a success response.
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	// Decode the body from the response.
+	if resp.Body == nil {
+		return nil, errors.New("Get container group list returned an empty body in the response")
+	}
+	var list client.ContainerGroupListResult
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("Decoding get container group list response body failed: %v", err)
+	}
+
+	list.HTTPStatusCode = resp.StatusCode
+	list.Header = resp.Header
+
+	return &list, nil
+}
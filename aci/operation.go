@@ -0,0 +1,172 @@
+package aci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// operationPollInterval is the time between operation status requests when
+// the response has no Retry-After header.
+var operationPollInterval = 5 * time.Second
+
+type operationWaitKey struct{}
+
+// WithOperationWait returns a context that makes creates, deletes, starts and
+// restarts wait for the long-running operation they start to reach a terminal
+// state, and return its error.
+func WithOperationWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, operationWaitKey{}, true)
+}
+
+// OperationWaitRequested reports whether ctx was created by WithOperationWait.
+func OperationWaitRequested(ctx context.Context) bool {
+	wait, _ := ctx.Value(operationWaitKey{}).(bool)
+	return wait
+}
+
+// OperationError is the error of a long-running operation that failed or was
+// cancelled.
+type OperationError struct {
+	Status  string
+	Code    string
+	Message string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("Operation %s with error code %q: %s", strings.ToLower(e.Status), e.Code, e.Message)
+}
+
+// operationStatus is the body returned by an Azure-AsyncOperation URL.
+// From: https://docs.microsoft.com/en-us/azure/azure-resource-manager/resource-manager-async-operations
+type operationStatus struct {
+	Status string `json:"status"`
+	Error  *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// waitForOperation follows the long-running operation started by the request
+// resp answers, when ctx asks for it. The Azure-AsyncOperation header is
+// preferred over the Location header of accepted requests.
+func (c *Client) waitForOperation(ctx context.Context, resp *http.Response) error {
+	if !OperationWaitRequested(ctx) {
+		return nil
+	}
+
+	if statusURL := resp.Header.Get("Azure-AsyncOperation"); statusURL != "" {
+		return c.pollAsyncOperation(ctx, statusURL, pollDelay(resp))
+	}
+
+	if location := resp.Header.Get("Location"); location != "" && resp.StatusCode == http.StatusAccepted {
+		return c.pollLocation(ctx, location, pollDelay(resp))
+	}
+
+	return nil
+}
+
+// pollAsyncOperation polls the operation status URL until the operation
+// succeeds, fails or is cancelled.
+func (c *Client) pollAsyncOperation(ctx context.Context, statusURL string, delay time.Duration) error {
+	for {
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+
+		resp, err := c.getOperation(ctx, statusURL)
+		if err != nil {
+			return err
+		}
+
+		var status operationStatus
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("Decoding operation status response body failed: %v", err)
+		}
+
+		switch {
+		case strings.EqualFold(status.Status, "Succeeded"):
+			return nil
+		case strings.EqualFold(status.Status, "Failed"), strings.EqualFold(status.Status, "Canceled"):
+			opErr := &OperationError{Status: status.Status}
+			if status.Error != nil {
+				opErr.Code = status.Error.Code
+				opErr.Message = status.Error.Message
+			}
+			return opErr
+		}
+
+		delay = pollDelay(resp)
+	}
+}
+
+// pollLocation polls the Location URL of an accepted request until it stops
+// answering 202 (Accepted).
+func (c *Client) pollLocation(ctx context.Context, location string, delay time.Duration) error {
+	for {
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+
+		resp, err := c.getOperation(ctx, location)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusAccepted {
+			return nil
+		}
+
+		delay = pollDelay(resp)
+	}
+}
+
+// getOperation sends a GET request to an operation URL and checks the response.
+func (c *Client) getOperation(ctx context.Context, operationURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", operationURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Creating operation status request failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Sending operation status request failed: %v", err)
+	}
+
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// pollDelay returns the Retry-After duration of the response, or the default
+// poll interval.
+func pollDelay(resp *http.Response) time.Duration {
+	if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return delay
+	}
+
+	return operationPollInterval
+}
+
+// sleepContext waits for d, returning early with the error of ctx when it is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,265 @@
+package aci
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// MaxRetries is the number of times a request failing with a throttling
+	// or transient error is retried.
+	MaxRetries = 4
+
+	// RetryTimeout bounds the total time spent on a request and its retries,
+	// zero means no limit.
+	RetryTimeout = 2 * time.Minute
+
+	// RequestTimeout bounds every attempt of a request, zero means no limit.
+	RequestTimeout = 1 * time.Minute
+
+	// minRetryDelay and maxRetryDelay bound the exponential backoff between
+	// attempts when the response has no Retry-After header.
+	minRetryDelay = 1 * time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+type idempotentKey struct{}
+
+// markIdempotent marks a request as safe to retry after it may have reached
+// the server, even though its method is not idempotent.
+func markIdempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+type uncertainKey struct{}
+
+// trackUncertain returns the request with uncertain set by the retry transport
+// when an earlier attempt of the request may have been processed by the
+// server, its response being lost or a server error.
+func trackUncertain(req *http.Request, uncertain *bool) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), uncertainKey{}, uncertain))
+}
+
+// isIdempotent reports whether sending the request twice has the same effect
+// as sending it once.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// retryTransport retries requests that are throttled or fail with a transient
+// error, waiting for the Retry-After duration of the response or a jittered
+// exponential backoff between attempts.
+//
+// Throttled requests were rejected before being processed, so they are
+// retried for every method. Server errors and connection resets are only
+// retried for idempotent requests.
+//
+// Every attempt is abandoned after requestTimeout, and attempts of idempotent
+// requests that time out are retried like connection resets.
+type retryTransport struct {
+	base           http.RoundTripper
+	maxRetries     int
+	timeout        time.Duration
+	requestTimeout time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newRetryTransport(base http.RoundTripper, maxRetries int, timeout time.Duration, requestTimeout time.Duration) *retryTransport {
+	return &retryTransport{
+		base:           base,
+		maxRetries:     maxRetries,
+		timeout:        timeout,
+		requestTimeout: requestTimeout,
+		rand:           rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.base == nil {
+		return nil, errors.New("RoundTrip: no Transport specified")
+	}
+
+	var deadline time.Time
+	if t.timeout > 0 {
+		deadline = time.Now().Add(t.timeout)
+	}
+
+	// A request with a body can only be retried if the body can be read again.
+	canRewind := req.Body == nil || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			newReq := *req
+			newReq.Body = body
+			attemptReq = &newReq
+		}
+
+		resp, timedOut, err := t.roundTripAttempt(attemptReq)
+
+		retry := shouldRetry(req, resp, err) || (timedOut && isIdempotent(req))
+		if attempt >= t.maxRetries || !canRewind || !retry {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		// Throttled requests were rejected before being processed.
+		if uncertain, ok := req.Context().Value(uncertainKey{}).(*bool); ok && (resp == nil || resp.StatusCode != http.StatusTooManyRequests) {
+			*uncertain = true
+		}
+
+		if resp != nil {
+			// Drain the body so the connection can be reused.
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// roundTripAttempt sends a single attempt, bounded by the request timeout. It
+// reports whether the attempt failed because the timeout expired.
+func (t *retryTransport) roundTripAttempt(req *http.Request) (*http.Response, bool, error) {
+	if t.requestTimeout <= 0 {
+		resp, err := t.base.RoundTrip(req)
+		return resp, false, err
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.requestTimeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		timedOut := ctx.Err() == context.DeadlineExceeded && req.Context().Err() == nil
+		cancel()
+		return nil, timedOut, err
+	}
+
+	// The timeout also covers reading the body, so cancel it once the body
+	// is closed.
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+
+	return resp, false, nil
+}
+
+// cancelOnClose cancels the context of a request when its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// backoff returns the delay before the retry following attempt, half of it
+// fixed and half of it random.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 16 {
+		if d := minRetryDelay << uint(attempt); d < maxRetryDelay {
+			delay = d
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return delay/2 + time.Duration(t.rand.Int63n(int64(delay/2)+1))
+}
+
+// shouldRetry reports whether the outcome of an attempt is worth retrying.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return isIdempotent(req) && isConnectionReset(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		// ARM sets Retry-After when it rejects the request before processing it.
+		return isIdempotent(req) || resp.Header.Get("Retry-After") != ""
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	}
+
+	return false
+}
+
+// isConnectionReset reports whether err is a connection closed by the server
+// or a network element in between.
+func isConnectionReset(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.ECONNRESET || sysErr.Err == syscall.ECONNABORTED || sysErr.Err == syscall.EPIPE
+		}
+	}
+
+	return strings.Contains(err.Error(), "connection reset by peer")
+}
+
+// parseRetryAfter parses the Retry-After header, given either in seconds or
+// as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
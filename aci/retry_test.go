@@ -0,0 +1,246 @@
+package aci
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
+)
+
+// reset makes the fake server reset the connection instead of responding.
+const reset = -1
+
+// staticToken is a token provider returning the same token forever.
+type staticToken string
+
+func (t staticToken) OAuthToken() string {
+	return string(t)
+}
+
+// retryServer answers the requests it receives with the next of statuses,
+// repeating the last one, and counts them.
+type retryServer struct {
+	statuses   []int
+	retryAfter string
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (s *retryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status := s.statuses[len(s.statuses)-1]
+	if s.requests < len(s.statuses) {
+		status = s.statuses[s.requests]
+	}
+	s.requests++
+	s.mu.Unlock()
+
+	if status == reset {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+		return
+	}
+
+	if s.retryAfter != "" {
+		w.Header().Set("Retry-After", s.retryAfter)
+	}
+	w.WriteHeader(status)
+}
+
+func (s *retryServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// fastBackoff shortens the backoff between attempts for the duration of the
+// test.
+func fastBackoff(t *testing.T) {
+	minDelay, maxDelay := minRetryDelay, maxRetryDelay
+	minRetryDelay, maxRetryDelay = time.Millisecond, 4*time.Millisecond
+	t.Cleanup(func() {
+		minRetryDelay, maxRetryDelay = minDelay, maxDelay
+	})
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		idempotent   bool
+		statuses     []int
+		retryAfter   string
+		wantRequests int
+		wantStatus   int
+		wantErr      bool
+		wantDelay    time.Duration
+	}{
+		{name: "success", method: "GET", statuses: []int{200}, wantRequests: 1, wantStatus: 200},
+		{name: "throttled", method: "POST", statuses: []int{429, 429, 200}, wantRequests: 3, wantStatus: 200},
+		{name: "retry after", method: "POST", statuses: []int{429, 200}, retryAfter: "1", wantRequests: 2, wantStatus: 200, wantDelay: time.Second},
+		{name: "server errors", method: "GET", statuses: []int{500, 502, 504, 200}, wantRequests: 4, wantStatus: 200},
+		{name: "server error not idempotent", method: "POST", statuses: []int{500, 200}, wantRequests: 1, wantStatus: 500},
+		{name: "server error marked idempotent", method: "POST", idempotent: true, statuses: []int{502, 200}, wantRequests: 2, wantStatus: 200},
+		{name: "unavailable with retry after", method: "POST", statuses: []int{503, 200}, retryAfter: "0", wantRequests: 2, wantStatus: 200},
+		{name: "client error", method: "GET", statuses: []int{400, 200}, wantRequests: 1, wantStatus: 400},
+		{name: "max retries", method: "GET", statuses: []int{503}, wantRequests: 4, wantStatus: 503},
+		{name: "connection reset", method: "DELETE", statuses: []int{reset, 200}, wantRequests: 2, wantStatus: 200},
+		{name: "connection reset not idempotent", method: "POST", statuses: []int{reset, 200}, wantRequests: 1, wantErr: true},
+		{name: "connection reset every time", method: "PUT", statuses: []int{reset}, wantRequests: 4, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastBackoff(t)
+			server := &retryServer{statuses: test.statuses, retryAfter: test.retryAfter}
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+
+			req, err := http.NewRequest(test.method, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.idempotent {
+				req = markIdempotent(req)
+			}
+
+			start := time.Now()
+			resp, err := newRetryTransport(http.DefaultTransport, 3, time.Minute, 0).RoundTrip(req)
+			elapsed := time.Since(start)
+
+			if test.wantErr != (err != nil) {
+				t.Fatalf("RoundTrip returned %v, want an error: %t", err, test.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != test.wantStatus {
+					t.Errorf("RoundTrip returned status %d, want %d", resp.StatusCode, test.wantStatus)
+				}
+			}
+
+			if got := server.count(); got != test.wantRequests {
+				t.Errorf("Server received %d requests, want %d", got, test.wantRequests)
+			}
+			if elapsed < test.wantDelay {
+				t.Errorf("RoundTrip returned after %s, want at least the Retry-After delay of %s", elapsed, test.wantDelay)
+			}
+		})
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	server := &retryServer{statuses: []int{429}, retryAfter: "5"}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting 5s for the retry would exceed the retry timeout, so the
+	// throttled response is returned right away.
+	start := time.Now()
+	resp, err := newRetryTransport(http.DefaultTransport, 3, time.Second, 0).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests || server.count() != 1 {
+		t.Errorf("RoundTrip returned status %d after %d requests, want 429 after 1", resp.StatusCode, server.count())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RoundTrip returned after %s, want no wait", elapsed)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	server := &retryServer{statuses: []int{503}, retryAfter: "5"}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newRetryTransport(http.DefaultTransport, 3, time.Minute, 0).RoundTrip(req.WithContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("RoundTrip returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "0", want: 0, wantOK: true},
+		{value: "30", want: 30 * time.Second, wantOK: true},
+		{value: "-1", wantOK: false},
+		{value: "soon", wantOK: false},
+		{value: "Mon, 01 Jan 2001 00:00:00 GMT", want: 0, wantOK: true},
+	}
+
+	for _, test := range tests {
+		got, ok := parseRetryAfter(test.value)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %t, want %s, %t", test.value, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestDeleteContainerGroupRetried(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantNotFound bool
+	}{
+		{name: "deleted", statuses: []int{200}},
+		{name: "not found", statuses: []int{204}, wantNotFound: true},
+		{name: "throttled then not found", statuses: []int{429, 204}, wantNotFound: true},
+		{name: "lost response", statuses: []int{reset, 204}},
+		{name: "gateway timeout", statuses: []int{504, 204}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastBackoff(t)
+			server := &retryServer{statuses: test.statuses}
+			srv := httptest.NewServer(server)
+			defer srv.Close()
+
+			c := newClient(&azure.Authentication{SubscriptionID: "sub"}, srv.URL, staticToken("token"))
+			err := c.DeleteContainerGroup(context.Background(), "rg", "web-0")
+
+			var armErr *Error
+			switch {
+			case test.wantNotFound && (!errors.As(err, &armErr) || ClassifyError(err) != ErrorClassNotFound):
+				t.Fatalf("DeleteContainerGroup returned %v, want a not found error", err)
+			case !test.wantNotFound && err != nil:
+				t.Fatalf("DeleteContainerGroup failed: %v", err)
+			}
+
+			if server.count() != len(test.statuses) {
+				t.Errorf("Server received %d requests, want %d", server.count(), len(test.statuses))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package aci
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// bearerTransport adds the user agent, content type and a fresh bearer token
+// to every request.
+type bearerTransport struct {
+	base          http.RoundTripper
+	userAgent     string
+	tokenProvider adal.OAuthTokenProvider
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.base == nil {
+		return nil, errors.New("RoundTrip: no Transport specified")
+	}
+
+	newReq := *req
+	newReq.Header = make(http.Header)
+	for k, vv := range req.Header {
+		newReq.Header[k] = vv
+	}
+
+	// Add the user agent header.
+	newReq.Header["User-Agent"] = []string{t.userAgent}
+
+	// Add the content-type header.
+	newReq.Header["Content-Type"] = []string{"application/json"}
+
+	// Refresh the token if necessary.
+	if refresher, ok := t.tokenProvider.(adal.Refresher); ok {
+		if err := refresher.EnsureFresh(); err != nil {
+			return nil, fmt.Errorf("Failed to refresh the authorization token for request to %s: %v", newReq.URL, err)
+		}
+	}
+
+	// Add the authorization header.
+	newReq.Header["Authorization"] = []string{fmt.Sprintf("Bearer %s", t.tokenProvider.OAuthToken())}
+
+	return t.base.RoundTrip(&newReq)
+}
@@ -0,0 +1,79 @@
+package aci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+// UpdateContainerGroup updates an Azure Container Instance with the
+// provided properties.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/createorupdate
+func (c *Client) UpdateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error) {
+	return c.CreateContainerGroup(ctx, resourceGroup, containerGroupName, containerGroup)
+}
+
+// UpdateContainerGroupTags replaces the tags of an Azure Container Instance
+// without touching its containers.
+// From: https://docs.microsoft.com/en-us/rest/api/container-instances/containergroups/update
+func (c *Client) UpdateContainerGroupTags(ctx context.Context, resourceGroup, containerGroupName string, tags map[string]string) (*client.ContainerGroup, error) {
+	urlParams := url.Values{
+		"api-version": []string{apiVersion},
+	}
+
+	// Create the url.
+	uri := api.ResolveRelative(c.baseURI, containerGroupURLPath)
+	uri += "?" + url.Values(urlParams).Encode()
+
+	// Create the body for the request.
+	b := new(bytes.Buffer)
+	if err := json.NewEncoder(b).Encode(client.Resource{Tags: tags}); err != nil {
+		return nil, fmt.Errorf("Encoding update container group body request failed: %v", err)
+	}
+
+	// Create the request.
+	req, err := http.NewRequest("PATCH", uri, b)
+	if err != nil {
+		return nil, fmt.Errorf("Creating update container group uri request failed: %v", err)
+	}
+	req = req.WithContext(ctx)
+
+	// Add the parameters to the url.
+	if err := api.ExpandURL(req.URL, map[string]string{
+		"subscriptionId":     c.auth.SubscriptionID,
+		"resourceGroup":      resourceGroup,
+		"containerGroupName": containerGroupName,
+	}); err != nil {
+		return nil, fmt.Errorf("Expanding URL with parameters failed: %v", err)
+	}
+
+	// Send the request.
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Sending update container group request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// 200 (OK) is a success response.
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	// Decode the body from the response.
+	if resp.Body == nil {
+		return nil, errors.New("Update container group returned an empty body in the response")
+	}
+	var cg client.ContainerGroup
+	if err := json.NewDecoder(resp.Body).Decode(&cg); err != nil {
+		return nil, fmt.Errorf("Decoding update container group response body failed: %v", err)
+	}
+
+	return &cg, nil
+}
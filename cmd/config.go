@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/samkreter/acictl/aci"
+	"github.com/samkreter/acictl/config"
+	"github.com/spf13/cobra"
+)
+
+var configOutput string
+
+var contextSettings config.Context
+var credentialSettings config.Credential
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the contexts of the acictl config file.",
+	Long: `Manage the contexts of the acictl config file, ~/.acictl/config by default.
+
+A context holds the subscription, resource group, region, cloud, credential and
+output format used when they are not given by a flag or an environment
+variable. Switching between environments is one command:
+
+  acictl config set-context prod --subscription <id> --resource-group prod-rg --region eastus
+  acictl config use-context prod`,
+	// The config commands only read the config file, so that a broken
+	// context can be fixed.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := loadConfig(); err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var configView = &cobra.Command{
+	Use:   "view",
+	Short: "Print the config file.",
+	Long:  `Print the config file, as YAML or as JSON with -o json.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := configOutput
+		if output == "" {
+			if current, _, err := acictlConfig.Resolve(contextName); err == nil && current != nil {
+				output = current.Output
+			}
+		}
+
+		var data []byte
+		var err error
+		switch output {
+		case "", "yaml":
+			data, err = yaml.Marshal(acictlConfig)
+		case "json":
+			data, err = json.MarshalIndent(acictlConfig, "", "  ")
+			data = append(data, '\n')
+		default:
+			fatal(fmt.Errorf("Unknown output format %q, must be yaml or json.", output))
+		}
+		if err != nil {
+			fatal(err)
+		}
+
+		os.Stdout.Write(data)
+	},
+}
+
+var getContexts = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List the contexts of the config file.",
+	Long:  `List the contexts of the config file, the current one is marked with a *.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		current := firstNonEmpty(contextName, acictlConfig.CurrentContext)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tNAME\tSUBSCRIPTION\tRESOURCE GROUP\tREGION\tCLOUD\tCREDENTIAL")
+		for _, named := range acictlConfig.Contexts {
+			marker := ""
+			if named.Name == current {
+				marker = "*"
+			}
+
+			c := named.Context
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", marker, named.Name, c.Subscription, c.ResourceGroup, c.Region, c.Cloud, c.Credential)
+		}
+		w.Flush()
+	},
+}
+
+var useContext = &cobra.Command{
+	Use:   "use-context <name>",
+	Short: "Make a context the current one.",
+	Long:  `Make a context the current one, used when --context is not given.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if acictlConfig.Context(args[0]) == nil {
+			fatal(fmt.Errorf("Context %q is not in the config file, create it with 'acictl config set-context'.", args[0]))
+		}
+
+		acictlConfig.CurrentContext = args[0]
+		if err := acictlConfig.Save(configPath); err != nil {
+			fatal(err)
+		}
+
+		fmt.Printf("Switched to context %q.\n", args[0])
+	},
+}
+
+var setContext = &cobra.Command{
+	Use:   "set-context <name>",
+	Short: "Create or change a context.",
+	Long: `Create a context, or change the settings given as flags of an existing one.
+
+An empty value removes a setting from the context.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.Flags().Changed("cloud") && contextSettings.Cloud != "" {
+			if _, err := aci.LoadCloud(contextSettings.Cloud, ""); err != nil {
+				fatal(err)
+			}
+		}
+
+		exists := acictlConfig.Context(args[0]) != nil
+		c := acictlConfig.SetContext(args[0])
+		flags := cmd.Flags()
+		setIfChanged(flags.Changed("subscription"), &c.Subscription, contextSettings.Subscription)
+		setIfChanged(flags.Changed("resource-group"), &c.ResourceGroup, contextSettings.ResourceGroup)
+		setIfChanged(flags.Changed("region"), &c.Region, contextSettings.Region)
+		setIfChanged(flags.Changed("cloud"), &c.Cloud, contextSettings.Cloud)
+		setIfChanged(flags.Changed("credential"), &c.Credential, contextSettings.Credential)
+		setIfChanged(flags.Changed("output"), &c.Output, contextSettings.Output)
+
+		if err := acictlConfig.Save(configPath); err != nil {
+			fatal(err)
+		}
+
+		if exists {
+			fmt.Printf("Context %q modified.\n", args[0])
+		} else {
+			fmt.Printf("Context %q created.\n", args[0])
+		}
+	},
+}
+
+var setCredential = &cobra.Command{
+	Use:   "set-credential <name>",
+	Short: "Create or change a credential referred to by contexts.",
+	Long: `Create a credential, or change the settings given as flags of an existing one.
+
+Credentials select how to authenticate, secrets stay in the environment, the
+authentication file or the token cache of the Azure CLI.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.Flags().Changed("auth-mode") && credentialSettings.AuthMode != "" {
+			if err := aci.ValidateAuthMode(credentialSettings.AuthMode); err != nil {
+				fatal(err)
+			}
+		}
+
+		c := acictlConfig.SetCredential(args[0])
+		flags := cmd.Flags()
+		setIfChanged(flags.Changed("auth-mode"), &c.AuthMode, credentialSettings.AuthMode)
+		setIfChanged(flags.Changed("tenant-id"), &c.TenantID, credentialSettings.TenantID)
+		setIfChanged(flags.Changed("client-id"), &c.ClientID, credentialSettings.ClientID)
+		setIfChanged(flags.Changed("auth-location"), &c.AuthLocation, credentialSettings.AuthLocation)
+
+		if err := acictlConfig.Save(configPath); err != nil {
+			fatal(err)
+		}
+
+		fmt.Printf("Credential %q set.\n", args[0])
+	},
+}
+
+// setIfChanged sets the setting to value if its flag was given.
+func setIfChanged(changed bool, setting *string, value string) {
+	if changed {
+		*setting = value
+	}
+}
+
+func init() {
+	configView.Flags().StringVarP(&configOutput, "output", "o", "", "output format: yaml or json, defaults to the output of the context.")
+
+	setContext.Flags().StringVar(&contextSettings.Subscription, "subscription", "", "azure subscription ID.")
+	setContext.Flags().StringVarP(&contextSettings.ResourceGroup, "resource-group", "g", "", "azure resource group for aci.")
+	setContext.Flags().StringVarP(&contextSettings.Region, "region", "r", "", "region for aci.")
+	setContext.Flags().StringVar(&contextSettings.Cloud, "cloud", "", "Azure cloud: AzurePublicCloud, AzureUSGovernmentCloud, AzureChinaCloud or AzureGermanCloud.")
+	setContext.Flags().StringVar(&contextSettings.Credential, "credential", "", "name of the credential, created with 'acictl config set-credential'.")
+	setContext.Flags().StringVarP(&contextSettings.Output, "output", "o", "", "default output format.")
+
+	setCredential.Flags().StringVar(&credentialSettings.AuthMode, "auth-mode", "", "where Azure credentials come from: auto, client-secret, client-certificate, cli, msi or device-code.")
+	setCredential.Flags().StringVar(&credentialSettings.TenantID, "tenant-id", "", "azure active directory tenant ID.")
+	setCredential.Flags().StringVar(&credentialSettings.ClientID, "client-id", "", "client ID of the service principal or user assigned identity.")
+	setCredential.Flags().StringVar(&credentialSettings.AuthLocation, "auth-location", "", "authentication file of the service principal, like AZURE_AUTH_LOCATION.")
+
+	configCmd.AddCommand(configView)
+	configCmd.AddCommand(getContexts)
+	configCmd.AddCommand(useContext)
+	configCmd.AddCommand(setContext)
+	configCmd.AddCommand(setCredential)
+
+	RootCmd.AddCommand(configCmd)
+}
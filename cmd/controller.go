@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var controller = &util.Controller{}
+
+var controllerCmd = &cobra.Command{
+	Use:   "controller",
+	Short: "Keep the replicas of deployments running until interrupted.",
+	Long: `Keep the replicas of the deployments in the resource group running until
+interrupted. Every --interval, replicas that were deleted are created again,
+and replicas that failed, terminated or are crash looping are replaced. A
+replica is crash looping when its containers restarted --crash-loop-restarts
+times within --crash-loop-window. Replicas stopped with 'acictl stop' are left
+alone.
+
+The replica count of a deployment is recorded on its container groups by
+create, apply, scale and sync. With -f, only the deployments of the manifest
+file, or of the manifests in the directory, are controlled, with the replica
+count of their manifest. New replicas copy the spec of a live replica, or are
+built from the manifest when no replica is left.
+
+A replica replaced again is backed off exponentially, from 10s to 5m, and at
+most --max-replacements replicas are created per minute.
+
+Finished jobs are deleted once their ttlSecondsAfterFinished has passed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		if deploymentFile != "" {
+			manifests, err := util.ReadDeploymentManifests(deploymentFile)
+			if err != nil {
+				fatal(err)
+			}
+			controller.Manifests = manifests
+		}
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		controller.Client = aciClient
+		controller.ResourceGroup = resourceGroup
+		controller.Region = region
+		controller.Clock = util.RealClock
+
+		if err := controller.Run(ctx); err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	controllerCmd.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	controllerCmd.Flags().DurationVar(&controller.Interval, "interval", util.DefaultControllerInterval, "how often the replicas are checked.")
+	controllerCmd.Flags().IntVar(&controller.CrashLoopRestarts, "crash-loop-restarts", util.DefaultCrashLoopRestarts, "restarts within --crash-loop-window after which a replica is replaced.")
+	controllerCmd.Flags().DurationVar(&controller.CrashLoopWindow, "crash-loop-window", util.DefaultCrashLoopWindow, "window over which container restarts are counted.")
+	controllerCmd.Flags().IntVar(&controller.ReplacementsPerMinute, "max-replacements", util.DefaultReplacementsPerMinute, "maximum number of replicas created per minute.")
+
+	RootCmd.AddCommand(controllerCmd)
+}
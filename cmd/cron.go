@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var cronCmd = &cobra.Command{
+	Use:   "cron",
+	Short: "Run Kubernetes CronJobs on Azure Container Instance.",
+	Long:  `Run Kubernetes CronJobs on Azure Container Instance.`,
+}
+
+var cronRun = &cobra.Command{
+	Use:   "run",
+	Short: "Run the jobs of CronJobs on their schedule until interrupted.",
+	Long: `Run the jobs of the batch/v1beta1 CronJob in the -f file, or of the CronJobs in
+the -f directory, on their schedule until interrupted.
+
+Schedules use the cron format, in the time zone of spec.timeZone, a CRON_TZ=
+prefix of the schedule or the local time zone. The jobs run like with
+'acictl create -f job.yaml', following the concurrencyPolicy of the CronJob:
+Allow runs them concurrently, Forbid skips a schedule while a job is running
+and Replace deletes the running job. A schedule missed while acictl was not
+running is run late, unless startingDeadlineSeconds have passed since. The
+finished jobs beyond successfulJobsHistoryLimit and failedJobsHistoryLimit are
+deleted.
+
+The state of the scheduler is kept in the tags of the container groups, so it
+can be stopped and started again: unfinished jobs are resumed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDeploymentFile()
+		requireResourceGroup()
+
+		cronJobs, err := util.ReadCronJobs(deploymentFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		scheduler := &util.CronScheduler{
+			Client:        aciClient,
+			ResourceGroup: resourceGroup,
+			Region:        region,
+			Clock:         util.RealClock,
+		}
+
+		if err := scheduler.Run(ctx, cronJobs); err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	cronCmd.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+
+	cronCmd.AddCommand(cronRun)
+
+	RootCmd.AddCommand(cronCmd)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+// diffDriftExitCode is the exit code of 'acictl diff' when the deployment
+// drifted, errors that would exit with it exit with diffErrorExitCode instead.
+const (
+	diffDriftExitCode = 1
+	diffErrorExitCode = 2
+)
+
+var diffOutput string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how the live replicas of a deployment differ from its manifest.",
+	Long: `Compare the container group the -f deployment file translates to with every
+live replica of the deployment, and print a unified diff for each replica that
+differs. The fields Azure populates, such as the instance view, the
+provisioning state and the IP address, are ignored, so the diff shows the
+changes made outside of acictl, for example in the portal. Missing replicas,
+and replicas beyond the replica count of the manifest, are reported too.
+
+-o json or yaml prints the changed fields of every replica instead.
+
+The exit code is 0 when the replicas match the manifest, 1 when they drifted,
+and the exit code of the error otherwise, 2 instead of 1.`,
+	// Errors in the settings must not exit with the exit code of a drift
+	// either.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := initConfig(); err != nil {
+			diffFatal(err)
+		}
+	},
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output := firstNonEmpty(diffOutput, contextOutput)
+		switch {
+		case deploymentFile == "":
+			diffFatal(fmt.Errorf("Must supply a deployment file with the -f flag."))
+		case resourceGroup == "":
+			diffFatal(fmt.Errorf("Must supply an Azure resource group with the -g flag, AZURE_DEFAULTS_GROUP or the context."))
+		case output != "" && output != "json" && output != "yaml":
+			diffFatal(fmt.Errorf("Unknown output format %q, must be json or yaml.", output))
+		}
+
+		aciClient, err := newClient()
+		if err != nil {
+			diffFatal(err)
+		}
+
+		diff, err := util.Diff(ctx, aciClient, deploymentFile, resourceGroup, region)
+		if err != nil {
+			diffFatal(err)
+		}
+
+		switch output {
+		case "json":
+			data, err := json.MarshalIndent(diff, "", "  ")
+			if err != nil {
+				diffFatal(err)
+			}
+			fmt.Println(string(data))
+		case "yaml":
+			data, err := yaml.Marshal(diff)
+			if err != nil {
+				diffFatal(err)
+			}
+			os.Stdout.Write(data)
+		default:
+			util.PrintDiff(os.Stdout, diff)
+		}
+
+		if diff.Drifted {
+			os.Exit(diffDriftExitCode)
+		}
+	},
+}
+
+// diffFatal logs err like fatal, but never exits with the exit code of a
+// drift.
+func diffFatal(err error) {
+	logError(err)
+
+	if code := exitCode(err); code != diffDriftExitCode {
+		os.Exit(code)
+	}
+	os.Exit(diffErrorExitCode)
+}
+
+func init() {
+	diffCmd.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "output format: json or yaml, defaults to a unified diff or the output of the context.")
+
+	RootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samkreter/acictl/emulator"
+	"github.com/spf13/cobra"
+)
+
+var emulatorAddress string
+var emulatorLatency time.Duration
+var emulatorFailureRate float64
+var emulatorFailureStatus int
+var emulatorPageSize int
+var emulatorProvisioningSteps int
+var emulatorQuota int
+var emulatorFailingImages []string
+var emulatorRunSteps int
+var emulatorExitCodes []string
+var emulatorVerbose bool
+
+var emulatorCmd = &cobra.Command{
+	Use:   "emulator",
+	Short: "Run a local Azure Container Instance emulator.",
+	Long: `Run a local emulator of the Azure Container Instance and Azure Active Directory
+APIs used by acictl, keeping container groups in memory.
+
+Point acictl at the emulator with the --endpoint and --active-directory-endpoint
+flags to try deployments without an Azure subscription.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if emulatorFailureRate < 0 || emulatorFailureRate > 1 {
+			fatal(fmt.Errorf("The failure rate must be between 0 and 1."))
+		}
+
+		server := emulator.NewServer()
+		server.Latency = emulatorLatency
+		server.FailureRate = emulatorFailureRate
+		server.FailureStatusCode = emulatorFailureStatus
+		server.PageSize = emulatorPageSize
+		server.Backend.ProvisioningSteps = emulatorProvisioningSteps
+		server.Backend.Quota = emulatorQuota
+		for _, image := range emulatorFailingImages {
+			server.Backend.FailingImages[image] = true
+		}
+		server.Backend.RunSteps = emulatorRunSteps
+		for _, exitCode := range emulatorExitCodes {
+			parts := strings.SplitN(exitCode, "=", 2)
+			code, err := strconv.Atoi(parts[len(parts)-1])
+			if len(parts) != 2 || err != nil {
+				fatal(fmt.Errorf("Invalid exit code %q, must be image=code.", exitCode))
+			}
+			server.Backend.ExitCodes[parts[0]] = int32(code)
+		}
+		if emulatorVerbose {
+			server.Logger = log.New(os.Stderr, "", log.LstdFlags)
+		}
+
+		listener, err := net.Listen("tcp", emulatorAddress)
+		if err != nil {
+			fatal(err)
+		}
+
+		url := "http://" + listener.Addr().String()
+		fmt.Printf("ACI emulator listening on %s\n\n", url)
+		fmt.Printf("Use it from another shell with:\n\n")
+		fmt.Printf("  export AZURE_CLIENT_ID=emulator AZURE_CLIENT_SECRET=emulator AZURE_TENANT_ID=emulator AZURE_SUBSCRIPTION_ID=%s\n", server.Backend.SubscriptionID)
+		fmt.Printf("  acictl --endpoint %s --active-directory-endpoint %s/ create -g emulator -f deployment.yaml\n\n", url, url)
+		fmt.Printf("To use a managed identity instead of the client secret, set MSI_ENDPOINT=%s/%s and pass --auth-mode msi.\n\n", url, emulator.ManagedIdentityPath)
+
+		go func() {
+			<-ctx.Done()
+			listener.Close()
+		}()
+
+		if err := http.Serve(listener, server); err != nil && ctx.Err() == nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	emulatorCmd.Flags().StringVar(&emulatorAddress, "listen", "127.0.0.1:8080", "address to listen on.")
+	emulatorCmd.Flags().DurationVar(&emulatorLatency, "latency", 0, "latency added to every request.")
+	emulatorCmd.Flags().Float64Var(&emulatorFailureRate, "failure-rate", 0, "fraction of requests, between 0 and 1, that fail.")
+	emulatorCmd.Flags().IntVar(&emulatorFailureStatus, "failure-status", http.StatusInternalServerError, "status code of failed requests.")
+	emulatorCmd.Flags().IntVar(&emulatorPageSize, "page-size", emulator.DefaultPageSize, "number of container groups per list page.")
+	emulatorCmd.Flags().IntVar(&emulatorProvisioningSteps, "provisioning-steps", 1, "number of reads a new container group stays in the Creating state for.")
+	emulatorCmd.Flags().IntVar(&emulatorQuota, "quota", 0, "maximum number of container groups per resource group, 0 for unlimited.")
+	emulatorCmd.Flags().StringSliceVar(&emulatorFailingImages, "failing-image", nil, "image that fails to pull, can be repeated.")
+	emulatorCmd.Flags().IntVar(&emulatorRunSteps, "run-steps", 0, "number of reads the containers of a group with the Never or OnFailure restart policy run for before exiting, 0 to run until stopped.")
+	emulatorCmd.Flags().StringArrayVar(&emulatorExitCodes, "exit-code", nil, "image=code, the exit code of the containers running the image, can be repeated.")
+	emulatorCmd.Flags().BoolVarP(&emulatorVerbose, "verbose", "v", false, "log every request.")
+
+	RootCmd.AddCommand(emulatorCmd)
+}
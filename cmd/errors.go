@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+// exitCodes are the exit codes for each class of Azure error, so scripts can
+// tell failures worth retrying from ones that need a fix.
+var exitCodes = map[aci.ErrorClass]int{
+	aci.ErrorClassUnknown:        1,
+	aci.ErrorClassInvalidRequest: 3,
+	aci.ErrorClassAuthorization:  4,
+	aci.ErrorClassNotFound:       5,
+	aci.ErrorClassConflict:       6,
+	aci.ErrorClassQuota:          7,
+	aci.ErrorClassImage:          8,
+	aci.ErrorClassThrottled:      9,
+	aci.ErrorClassServer:         10,
+}
+
+// usageExitCode is the exit code of invalid arguments and flags. It differs
+// from the exit code 1 of a drift found by 'acictl diff', so that a mistyped
+// invocation is not taken for a drift.
+const usageExitCode = 2
+
+// fatal logs err with the remediation hints of the Azure errors it holds, and
+// exits with the exit code of its error class, or 130 if acictl was interrupted.
+func fatal(err error) {
+	logError(err)
+	os.Exit(exitCode(err))
+}
+
+// logError logs err with the remediation hints of the Azure errors it holds.
+func logError(err error) {
+	log.Print(err)
+
+	for _, hint := range errorHints(err) {
+		fmt.Fprintf(os.Stderr, "Hint: %s\n", hint)
+	}
+}
+
+// exitCode returns the exit code of the error class of err, or 130 if acictl
+// was interrupted.
+func exitCode(err error) int {
+	if ctx.Err() != nil {
+		return 130
+	}
+
+	return exitCodes[aci.ClassifyError(err)]
+}
+
+// errorHints returns the distinct remediation hints of every error wrapped by
+// err, in order.
+func errorHints(err error) []string {
+	var hints []string
+	seen := map[string]bool{}
+
+	var walk func(err error)
+	walk = func(err error) {
+		if multi, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range multi.Unwrap() {
+				walk(e)
+			}
+			return
+		}
+
+		if hint := aci.ErrorHint(err); hint != "" && !seen[hint] {
+			seen[hint] = true
+			hints = append(hints, hint)
+		}
+	}
+	walk(err)
+
+	return hints
+}
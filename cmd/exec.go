@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var execContainer string
+var execStdin bool
+var execTTY bool
+
+var execCmd = &cobra.Command{
+	Use:   "exec <group> [-c container] -- <command> [args...]",
+	Short: "Execute a command in a container.",
+	Long: `Execute a command in a container of a container group.
+
+Use -it to run an interactive shell, for example:
+
+  acictl exec -g ResourceGroup nginx-deployment-0 -it -- /bin/sh`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.Exec(ctx, aciClient, args[0], execContainer, resourceGroup, args[1:], execStdin, execTTY)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	execCmd.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	execCmd.Flags().StringVarP(&execContainer, "container", "c", "", "container name, defaults to the only container of the group.")
+	execCmd.Flags().BoolVarP(&execStdin, "stdin", "i", false, "pass stdin to the container.")
+	execCmd.Flags().BoolVarP(&execTTY, "tty", "t", false, "stdin is a TTY.")
+
+	RootCmd.AddCommand(execCmd)
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var getOutput string
+
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Display resources managed by acictl.",
+	Long:  `Display resources managed by acictl.`,
+}
+
+var getJobs = &cobra.Command{
+	Use:   "jobs",
+	Short: "List the jobs of the resource group and their status.",
+	Long: `List the jobs of the resource group, created with 'acictl create -f job.yaml',
+with the number of active, succeeded and failed container groups. Failed counts
+the failed container groups and the restarts of containers with the OnFailure
+restart policy.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		output := firstNonEmpty(getOutput, contextOutput)
+		if output != "" && output != "json" && output != "yaml" {
+			fatal(fmt.Errorf("Unknown output format %q, must be json or yaml.", output))
+		}
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		jobs, err := util.GetJobs(ctx, aciClient, resourceGroup)
+		if err != nil {
+			fatal(err)
+		}
+
+		switch output {
+		case "json":
+			data, err := json.MarshalIndent(jobs, "", "  ")
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Println(string(data))
+			return
+		case "yaml":
+			data, err := yaml.Marshal(jobs)
+			if err != nil {
+				fatal(err)
+			}
+			os.Stdout.Write(data)
+			return
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCOMPLETIONS\tACTIVE\tFAILED\tDURATION\tAGE\tSTATUS")
+		for _, job := range jobs {
+			completions := "-"
+			if job.Completions != nil {
+				completions = strconv.Itoa(int(*job.Completions))
+			}
+
+			duration, age := "-", "-"
+			if job.StartTime != nil {
+				end := now
+				if job.CompletionTime != nil {
+					end = *job.CompletionTime
+				}
+				duration = end.Sub(*job.StartTime).Round(time.Second).String()
+				age = now.Sub(*job.StartTime).Round(time.Second).String()
+			}
+
+			status := "Running"
+			if job.Condition != "" {
+				status = job.Condition
+				if job.Reason != "" {
+					status += " (" + job.Reason + ")"
+				}
+			}
+
+			fmt.Fprintf(w, "%s\t%d/%s\t%d\t%d\t%s\t%s\t%s\n", job.Name, job.Succeeded, completions, job.Active, job.Failed, duration, age, status)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	getCmd.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	getJobs.Flags().StringVarP(&getOutput, "output", "o", "", "output format: json or yaml, defaults to a table or the output of the context.")
+
+	getCmd.AddCommand(getJobs)
+
+	RootCmd.AddCommand(getCmd)
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var restartRolling bool
+var restartTimeout time.Duration
+
+var restart = &cobra.Command{
+	Use:   "restart <deployment|group>",
+	Short: "Restart the containers of a deployment or container group.",
+	Long:  `Restart the containers of every replica of a deployment, or of a single container group.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.Restart(ctx, aciClient, args[0], resourceGroup, restartRolling, restartTimeout)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var stop = &cobra.Command{
+	Use:   "stop <deployment|group>",
+	Short: "Stop a deployment or container group.",
+	Long:  `Stop every replica of a deployment, or a single container group. Stopped groups are not billed.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.Stop(ctx, aciClient, args[0], resourceGroup)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var start = &cobra.Command{
+	Use:   "start <deployment|group>",
+	Short: "Start a stopped deployment or container group.",
+	Long:  `Start every replica of a stopped deployment, or a single stopped container group.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.Start(ctx, aciClient, args[0], resourceGroup)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	restart.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	restart.Flags().BoolVar(&restartRolling, "rolling", false, "restart one replica at a time, waiting for it to be running before the next.")
+	restart.Flags().DurationVar(&restartTimeout, "timeout", 0, "time to wait for each replica to be running in a rolling restart, defaults to 10m.")
+	stop.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	start.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+
+	RootCmd.AddCommand(restart)
+	RootCmd.AddCommand(stop)
+	RootCmd.AddCommand(start)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var rolloutTimeout time.Duration
+var rolloutWatch bool
+var undoToRevision int
+
+var apply = &cobra.Command{
+	Use:   "apply",
+	Short: "Create or update Azure Container Instances from a Kubernetes deployment spec.",
+	Long: `Create or update Azure Container Instances from a Kubernetes deployment spec.
+
+Existing replicas are replaced following the deployment strategy, either
+RollingUpdate honoring maxSurge and maxUnavailable or Recreate.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		requireDeploymentFile()
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.Apply(ctx, aciClient, deploymentFile, resourceGroup, region, rolloutTimeout)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var rollout = &cobra.Command{
+	Use:   "rollout",
+	Short: "Manage the rollout of a deployment.",
+	Long:  `Manage the rollout of a deployment.`,
+}
+
+var rolloutStatus = &cobra.Command{
+	Use:   "status <deployment>",
+	Short: "Show the status of the rollout.",
+	Long:  `Show the status of the rollout.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.RolloutStatus(ctx, aciClient, args[0], resourceGroup, rolloutWatch, rolloutTimeout)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var rolloutHistory = &cobra.Command{
+	Use:   "history <deployment>",
+	Short: "View the rollout history of a deployment.",
+	Long:  `View the rollout history of a deployment.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.RolloutHistory(ctx, aciClient, args[0], resourceGroup)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+var rolloutUndo = &cobra.Command{
+	Use:   "undo <deployment>",
+	Short: "Roll back to a previous revision of a deployment.",
+	Long: `Roll back to a previous revision of a deployment.
+
+Revisions only record the images, the rest of the spec is copied from a
+running replica, or taken from the deployment file given with -f. Replicas
+with secret volumes or registry credentials need the deployment file, Azure
+doesn't return their secrets.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.RolloutUndo(ctx, aciClient, args[0], deploymentFile, resourceGroup, region, undoToRevision, rolloutTimeout)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	apply.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	apply.PersistentFlags().DurationVar(&rolloutTimeout, "timeout", 0, "time to wait for new replicas to become available, defaults to the deployment's progressDeadlineSeconds or 10m.")
+
+	rollout.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	rollout.PersistentFlags().DurationVar(&rolloutTimeout, "timeout", 0, "time to wait for the rollout, defaults to 10m.")
+	rolloutStatus.Flags().BoolVarP(&rolloutWatch, "watch", "w", true, "watch the status of the rollout until it's done.")
+	rolloutUndo.Flags().IntVar(&undoToRevision, "to-revision", 0, "the revision to roll back to, defaults to the previous revision.")
+
+	rollout.AddCommand(rolloutStatus)
+	rollout.AddCommand(rolloutHistory)
+	rollout.AddCommand(rolloutUndo)
+
+	RootCmd.AddCommand(apply)
+	RootCmd.AddCommand(rollout)
+}
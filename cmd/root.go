@@ -1,23 +1,50 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/samkreter/acictl/aci"
+	"github.com/samkreter/acictl/config"
 	"github.com/samkreter/acictl/util"
 	"github.com/spf13/cobra"
+	azure "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client"
 )
 
 var deploymentFile string
 var resourceGroup string
 var region string
+var clientOptions aci.Options
+var configPath string
+var contextName string
+var acictlConfig *config.Config
+var contextOutput string
+var createWait bool
+var valuesFiles []string
+var setValues []string
+var kustomizeDir string
+var chartPath string
+var deleteWait bool
+
+// ctx is cancelled when acictl is interrupted, abandoning in-flight requests.
+var ctx = context.Background()
 
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "acictl",
 	Short: "acictl provides a simple way to interact with Azure Container Instance.",
 	Long:  `acictl provides a simple way to interact with Azure Container Instance.`,
+	CompletionOptions: cobra.CompletionOptions{
+		DisableDefaultCmd: true,
+	},
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := initConfig(); err != nil {
+			fatal(err)
+		}
+	},
 }
 
 var convert = &cobra.Command{
@@ -25,9 +52,11 @@ var convert = &cobra.Command{
 	Short: "Convert a Kubernetes deployment spec into and ACI Template.",
 	Long:  `Convert a Kubernetes deployment spec into and ACI Template.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		requireDeploymentFile()
+
 		err := util.Convert(deploymentFile, resourceGroup, region)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 	},
 }
@@ -37,13 +66,17 @@ var create = &cobra.Command{
 	Short: "Create an Azure Container Instance from a Kubernetes deployment spec.",
 	Long:  `Create an Azure Container Instance from a Kubernetes deployment spec.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if resourceGroup == "" {
-			log.Fatal("Must supply an Azure resource group with the -g flag.")
+		requireDeploymentFile()
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
 		}
 
-		err := util.Create(deploymentFile, resourceGroup, region)
+		err = util.Create(ctx, aciClient, deploymentFile, resourceGroup, region, createWait)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 	},
 }
@@ -53,13 +86,17 @@ var delete = &cobra.Command{
 	Short: "Delete an Azure Container Instance from a Kubernetes deployment spec.",
 	Long:  `Delete an Azure Container Instance from a Kubernetes deployment spec.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if resourceGroup == "" {
-			log.Fatal("Must supply an Azure resource group with the -g flag.")
+		requireDeploymentFile()
+		requireResourceGroup()
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
 		}
 
-		err := util.Delete(deploymentFile, resourceGroup)
+		err = util.Delete(ctx, aciClient, deploymentFile, resourceGroup, deleteWait)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 	},
 }
@@ -67,26 +104,69 @@ var delete = &cobra.Command{
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	var cancel context.CancelFunc
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first interrupt cancels the running operation so it can report its
+	// progress, a second one exits right away.
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "Interrupted, cancelling. Interrupt again to exit immediately.")
+		cancel()
+		<-signals
+		os.Exit(130)
+	}()
+
+	os.Exit(execute(os.Args[1:]))
+}
+
+// execute runs the command line and returns usageExitCode when its arguments
+// or flags are invalid, cobra has printed the error and the usage then. The
+// commands exit by themselves on the other errors.
+func execute(args []string) int {
+	RootCmd.SetArgs(args)
 	if err := RootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return usageExitCode
 	}
+
+	return 0
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
-	RootCmd.PersistentFlags().StringVarP(&region, "region", "r", "westus", "region for aci.")
-	RootCmd.PersistentFlags().StringVarP(&deploymentFile, "deployment-file", "f", "", "the kubernetes deployment file (required).")
-	RootCmd.MarkFlagRequired("deployment-file")
+	RootCmd.PersistentFlags().StringVar(&configPath, "config", config.DefaultPath(), "the acictl config file.")
+	RootCmd.PersistentFlags().StringVar(&contextName, "context", os.Getenv("ACICTL_CONTEXT"), "the context of the config file to use, instead of the current one.")
+	RootCmd.PersistentFlags().StringVar(&clientOptions.SubscriptionID, "subscription", "", "azure subscription ID, overrides AZURE_SUBSCRIPTION_ID.")
+	RootCmd.PersistentFlags().StringVarP(&region, "region", "r", "", "region for aci, defaults to westus.")
+	RootCmd.PersistentFlags().StringVarP(&deploymentFile, "deployment-file", "f", "", "the kubernetes deployment file.")
+	RootCmd.PersistentFlags().StringVarP(&kustomizeDir, "kustomize", "k", "", "build the manifests from the kustomization of the directory, -f then selects a workload by name.")
+	RootCmd.PersistentFlags().StringVar(&chartPath, "chart", "", "render the manifests from the Helm chart directory or .tgz archive, -f then selects a workload by name.")
+	RootCmd.PersistentFlags().StringVar(&util.ChartRelease, "release", "", "release name the chart is rendered with, defaults to the chart name.")
+	RootCmd.PersistentFlags().StringArrayVar(&valuesFiles, "values", nil, "YAML file of values for the Go templates of manifests or the chart, can be repeated.")
+	RootCmd.PersistentFlags().StringArrayVar(&setValues, "set", nil, "key=value for the Go templates of manifests or the chart, a dotted key sets a nested value, can be repeated.")
+	RootCmd.PersistentFlags().BoolVar(&util.ExpandEnv, "expand-env", false, "replace ${VAR} and ${VAR:-default} in manifests with environment variables.")
+	RootCmd.PersistentFlags().BoolVar(&util.StrictEnv, "strict-env", false, "like --expand-env, but fail on undefined environment variables.")
+	RootCmd.PersistentFlags().StringVar(&clientOptions.Cloud, "cloud", "", "Azure cloud: AzurePublicCloud, AzureUSGovernmentCloud, AzureChinaCloud or AzureGermanCloud.")
+	RootCmd.PersistentFlags().StringVar(&clientOptions.CloudFile, "cloud-file", os.Getenv(azure.EnvironmentFilepathName), "JSON file with the endpoints of a custom Azure cloud.")
+	RootCmd.PersistentFlags().StringVar(&clientOptions.Endpoint, "endpoint", "", "override the Azure Resource Manager endpoint, for example to use the emulator.")
+	RootCmd.PersistentFlags().StringVar(&clientOptions.ActiveDirectoryEndpoint, "active-directory-endpoint", "", "override the Azure Active Directory endpoint used to get tokens.")
+	RootCmd.PersistentFlags().StringVar(&clientOptions.AuthMode, "auth-mode", "", "where Azure credentials come from: auto, client-secret, client-certificate, cli, msi or device-code.")
+	RootCmd.PersistentFlags().IntVar(&aci.MaxRetries, "max-retries", aci.MaxRetries, "number of retries for throttled or transient Azure API errors.")
+	RootCmd.PersistentFlags().DurationVar(&aci.RetryTimeout, "retry-timeout", aci.RetryTimeout, "maximum time spent on an Azure API request and its retries, 0 for no limit.")
+	RootCmd.PersistentFlags().DurationVar(&aci.RequestTimeout, "request-timeout", aci.RequestTimeout, "maximum time for a single Azure API request, 0 for no limit.")
+	RootCmd.PersistentFlags().IntVar(&util.Parallelism, "parallelism", util.Parallelism, "number of container groups created, deleted or changed concurrently.")
+	RootCmd.PersistentFlags().BoolVar(&util.FailFast, "fail-fast", false, "stop changing further container groups after the first failure.")
+	RootCmd.PersistentFlags().StringVar(&util.ReplicaNaming, "naming", util.NamingOrdinal, "naming scheme for new replicas: ordinal, hash or random.")
 
 	create.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
-	create.MarkFlagRequired("resource-group")
+	create.Flags().BoolVar(&createWait, "wait", false, "wait until the container groups finished provisioning.")
 	delete.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
-	delete.MarkFlagRequired("resource-group")
+	delete.Flags().BoolVar(&deleteWait, "wait", false, "wait until the container groups are deleted.")
 
 	//Add the sub commands
 	RootCmd.AddCommand(convert)
@@ -94,15 +174,128 @@ func init() {
 	RootCmd.AddCommand(delete)
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
+// initConfig reads the config file, and fills the settings given neither by a
+// flag nor by an environment variable from the selected context.
+func initConfig() error {
+	if err := loadConfig(); err != nil {
+		return err
+	}
 
-	if deploymentFile == "" {
-		log.Fatal("Must supply a deployment file with the -f flag.")
+	current, credential, err := acictlConfig.Resolve(contextName)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		current = &config.Context{}
+	}
+	if credential == nil {
+		credential = &config.Credential{}
+	}
+
+	resourceGroup = firstNonEmpty(resourceGroup, os.Getenv("AZURE_DEFAULTS_GROUP"), current.ResourceGroup)
+	region = firstNonEmpty(region, os.Getenv("AZURE_DEFAULTS_LOCATION"), current.Region)
+	contextOutput = current.Output
+	clientOptions.Cloud = firstNonEmpty(clientOptions.Cloud, current.Cloud)
+	clientOptions.AuthMode = firstNonEmpty(clientOptions.AuthMode, credential.AuthMode, aci.AuthModeAuto)
+
+	if os.Getenv("AZURE_SUBSCRIPTION_ID") == "" {
+		clientOptions.SubscriptionID = firstNonEmpty(clientOptions.SubscriptionID, current.Subscription)
+	}
+	if os.Getenv("AZURE_TENANT_ID") == "" {
+		clientOptions.TenantID = credential.TenantID
+	}
+	if os.Getenv("AZURE_CLIENT_ID") == "" {
+		clientOptions.ClientID = credential.ClientID
+	}
+	if os.Getenv("AZURE_AUTH_LOCATION") == "" {
+		clientOptions.AuthLocation = credential.AuthLocation
 	}
 
 	//Make westus the default region
 	if region == "" {
 		region = "westus"
 	}
+
+	if err := util.ValidateNamingScheme(util.ReplicaNaming); err != nil {
+		return err
+	}
+
+	if err := util.ValidateParallelism(util.Parallelism); err != nil {
+		return err
+	}
+
+	if util.ManifestValues, err = util.LoadManifestValues(valuesFiles, setValues); err != nil {
+		return err
+	}
+
+	// With -k or --chart, -f names a workload of the kustomization or chart,
+	// and is replaced by the reference reading its manifest.
+	switch {
+	case kustomizeDir != "" && chartPath != "":
+		return fmt.Errorf("Must supply either a kustomization with -k or a chart with --chart, not both.")
+	case kustomizeDir != "":
+		if deploymentFile, err = util.LoadKustomization(kustomizeDir, deploymentFile); err != nil {
+			return err
+		}
+	case chartPath != "":
+		if deploymentFile, err = util.LoadChart(chartPath, deploymentFile); err != nil {
+			return err
+		}
+	}
+
+	if err := aci.ValidateAuthMode(clientOptions.AuthMode); err != nil {
+		return err
+	}
+
+	if clientOptions.Cloud != "" && clientOptions.CloudFile == "" {
+		if _, err := aci.LoadCloud(clientOptions.Cloud, ""); err != nil {
+			return err
+		}
+	}
+
+	if aci.MaxRetries < 0 {
+		return fmt.Errorf("The --max-retries flag must not be negative.")
+	}
+
+	return nil
+}
+
+func requireDeploymentFile() {
+	if deploymentFile == "" {
+		fatal(fmt.Errorf("Must supply a deployment file with the -f flag."))
+	}
+}
+
+func requireResourceGroup() {
+	if resourceGroup == "" {
+		fatal(fmt.Errorf("Must supply an Azure resource group with the -g flag, AZURE_DEFAULTS_GROUP or the context."))
+	}
+}
+
+// newClient creates the ACI client from the Azure credentials of the
+// authentication mode.
+func newClient() (aci.ContainerGroupClient, error) {
+	return aci.NewClientFromEnvironment(clientOptions)
+}
+
+// loadConfig reads the config file.
+func loadConfig() error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return err
+	}
+
+	acictlConfig = cfg
+	return nil
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
 }
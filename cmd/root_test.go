@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestExecuteUsageErrors(t *testing.T) {
+	tests := [][]string{
+		{"diff", "extra-arg"},
+		{"diff", "--bogus"},
+		{"get", "--bogus"},
+		{"bogus"},
+	}
+
+	if usageExitCode == diffDriftExitCode {
+		t.Fatalf("Usage errors exit with %d, the exit code of a drift", usageExitCode)
+	}
+
+	RootCmd.SetOutput(ioutil.Discard)
+	defer RootCmd.SetOutput(nil)
+
+	for _, args := range tests {
+		if code := execute(args); code != usageExitCode {
+			t.Errorf("acictl %s exited with %d, want %d", strings.Join(args, " "), code, usageExitCode)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var runWorkFile string
+var runOptions util.RunOptions
+var workOptions util.WorkOptions
+
+// runContainerFlags are the flags of single container runs, which the work
+// file mode does not take.
+var runContainerFlags = []string{"port", "env", "cpu", "memory", "command", "restart", "dns-label", "rm", "attach"}
+
+var run = &cobra.Command{
+	Use:   "run [name]",
+	Short: "Run a container group of an image, once or for every work item of a file.",
+	Long: `Run a single container group of --image called name, like 'kubectl run'. It
+is created like the replica of a deployment of the same name, with its tags.
+With --attach, the logs of the container are printed until it exits and
+acictl exits with the exit code of the container, --rm then deletes the
+container group:
+
+  acictl run -g rg hello --image busybox --restart Never --command "echo hello" --attach --rm
+
+With --work-file, run a container group of --image for every line of the file
+instead, passing the line to the container in the KIRIX_WORK environment
+variable, like Kirix workers expect. At most --parallelism work items run at a
+time. A work item succeeds when its container exits with 0, failed items are
+run again up to --retries times, and so are attempts running longer than
+--timeout. Once every item has run, the exit code and
+logs of each of them are written to the --report JSON file, and acictl exits
+with an error if any item failed.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+		if runOptions.Image == "" {
+			fatal(fmt.Errorf("Must supply an image with the --image flag."))
+		}
+
+		if runWorkFile != "" {
+			runWork(cmd, args)
+			return
+		}
+
+		if len(args) != 1 {
+			fatal(fmt.Errorf("Must supply the name of the container group, or a work file with the --work-file flag."))
+		}
+		if runOptions.Remove && !runOptions.Attach {
+			fatal(fmt.Errorf("The --rm flag needs --attach."))
+		}
+
+		runOptions.Name = args[0]
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		exitCode, err := util.RunContainer(ctx, aciClient, resourceGroup, region, runOptions)
+		if err != nil {
+			fatal(err)
+		}
+
+		os.Exit(int(exitCode))
+	},
+}
+
+// runWork runs the image for every work item of the work file.
+func runWork(cmd *cobra.Command, args []string) {
+	for _, name := range runContainerFlags {
+		if cmd.Flags().Changed(name) {
+			fatal(fmt.Errorf("The --%s flag can not be used with --work-file.", name))
+		}
+	}
+	if len(args) == 1 {
+		workOptions.Name = args[0]
+	}
+	if workOptions.Retries < 0 {
+		fatal(fmt.Errorf("The --retries flag must not be negative."))
+	}
+	if err := util.ValidateContainerGroupName(workOptions.Name); err != nil {
+		fatal(err)
+	}
+
+	items, err := util.ReadWorkFile(runWorkFile)
+	if err != nil {
+		fatal(err)
+	}
+
+	workOptions.Image = runOptions.Image
+	aciClient, err := newClient()
+	if err != nil {
+		fatal(err)
+	}
+
+	if err := util.RunWork(ctx, aciClient, items, resourceGroup, region, workOptions); err != nil {
+		fatal(err)
+	}
+}
+
+func init() {
+	run.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	run.Flags().StringVar(&runOptions.Image, "image", "", "container image to run (required).")
+	run.Flags().IntSliceVar(&runOptions.Ports, "port", nil, "port to expose on a public IP address, can be repeated.")
+	run.Flags().StringArrayVar(&runOptions.Env, "env", nil, "KEY=VALUE environment variable of the container, can be repeated.")
+	run.Flags().StringVar(&runOptions.CPU, "cpu", "", "CPU cores of the container, such as 0.5, defaults to 1.")
+	run.Flags().StringVar(&runOptions.Memory, "memory", "", "memory of the container, such as 1.5Gi, defaults to 1G.")
+	run.Flags().StringVar(&runOptions.Command, "command", "", "command line replacing the entrypoint of the image, split into words like a shell does.")
+	run.Flags().StringVar(&runOptions.RestartPolicy, "restart", "Always", "restart policy: Always, OnFailure or Never.")
+	run.Flags().StringVar(&runOptions.DNSLabel, "dns-label", "", "DNS name label of the public IP address, needs --port.")
+	run.Flags().BoolVar(&runOptions.Remove, "rm", false, "delete the container group once the container exited, needs --attach.")
+	run.Flags().BoolVar(&runOptions.Attach, "attach", false, "print the logs until the container exits, and exit with its exit code.")
+
+	run.Flags().StringVar(&runWorkFile, "work-file", "", "file with one work item per line, passed to the container in KIRIX_WORK.")
+	run.Flags().StringVar(&workOptions.Name, "name", "work", "prefix of the container group names of the work items.")
+	run.Flags().IntVar(&workOptions.Retries, "retries", 2, "number of times a failed work item is run again.")
+	run.Flags().DurationVar(&workOptions.Timeout, "timeout", 0, "time an attempt of a work item may run for, defaults to 30m.")
+	run.Flags().StringVar(&workOptions.ReportFile, "report", "work-report.json", "file the JSON report of the work items is written to.")
+
+	RootCmd.AddCommand(run)
+}
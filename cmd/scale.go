@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var scaleReplicas int
+var scaleCurrentReplicas int
+
+var scale = &cobra.Command{
+	Use:   "scale <deployment>",
+	Short: "Set a new number of replicas for a deployment.",
+	Long: `Set a new number of replicas for a deployment.
+
+New replicas are created from the deployment file given with -f, or else from
+the spec of a running replica. Replicas with secret volumes or registry
+credentials need the deployment file, Azure doesn't return their secrets.
+When scaling down, failed replicas are removed first, then the newest ones.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		if !cmd.Flags().Changed("replicas") {
+			fatal(fmt.Errorf("Must supply the number of replicas with the --replicas flag."))
+		}
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		err = util.Scale(ctx, aciClient, args[0], deploymentFile, resourceGroup, region, scaleReplicas, scaleCurrentReplicas)
+		if err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	scale.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	scale.Flags().IntVar(&scaleReplicas, "replicas", 0, "the new number of replicas (required).")
+	scale.Flags().IntVar(&scaleCurrentReplicas, "current-replicas", -1, "precondition for the current number of replicas, the scale fails if it doesn't match.")
+
+	RootCmd.AddCommand(scale)
+}
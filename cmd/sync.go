@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/samkreter/acictl/util"
+	"github.com/spf13/cobra"
+)
+
+var syncOptions util.SyncOptions
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [dir]",
+	Short: "Make the deployments match the manifests of a directory, optionally watching it.",
+	Long: `Make the deployments in the resource group match the Deployment manifests of
+the directory and its subdirectories, like 'acictl apply -f' on each of them.
+Changed deployments are rolled out, and replicas that were deleted or failed
+are created again. Other kinds of manifests are skipped.
+
+The container groups are tagged with the source of the manifests, the name of
+the directory unless --source is given. A deployment synced from the source
+whose manifest was removed is reported as orphaned, and deleted with --prune.
+Deployments from other sources or created by 'acictl create' are never pruned,
+nor is anything pruned while a manifest can not be read.
+
+With --watch, the directory is synced again when its manifests change, once
+they stayed unchanged for --debounce, and every --interval to heal replicas
+that were deleted or failed, until interrupted. Failures are then reported
+without stopping. The result of the last sync is written to --status-file.
+
+With -k, the Deployments built from the kustomization of the directory are
+synced instead, and every file of the directory is watched. Changes to bases
+outside of it are synced at the next --interval. Likewise with --chart, the
+Deployments rendered from the chart directory are synced.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		requireResourceGroup()
+
+		dir := firstNonEmpty(kustomizeDir, chartPath)
+		switch {
+		case dir != "" && len(args) > 0:
+			fatal(fmt.Errorf("Must supply either a manifest directory, a kustomization with -k or a chart with --chart."))
+		case dir == "" && len(args) == 0:
+			fatal(fmt.Errorf("Must supply a manifest directory, a kustomization with -k or a chart with --chart."))
+		case len(args) > 0:
+			dir = args[0]
+		}
+		syncOptions.Kustomize = kustomizeDir != ""
+		syncOptions.Chart = chartPath != ""
+
+		aciClient, err := newClient()
+		if err != nil {
+			fatal(err)
+		}
+
+		if err := util.Sync(ctx, aciClient, dir, resourceGroup, region, syncOptions); err != nil {
+			fatal(err)
+		}
+	},
+}
+
+func init() {
+	syncCmd.PersistentFlags().StringVarP(&resourceGroup, "resource-group", "g", "", "azure resource group for aci (required).")
+	syncCmd.Flags().BoolVarP(&syncOptions.Watch, "watch", "w", false, "keep syncing when the manifests change and every --interval.")
+	syncCmd.Flags().BoolVar(&syncOptions.Prune, "prune", false, "delete the deployments synced from the source whose manifest was removed.")
+	syncCmd.Flags().StringVar(&syncOptions.Source, "source", "", "name of the manifest source recorded on the container groups, defaults to the directory name.")
+	syncCmd.Flags().DurationVar(&syncOptions.Debounce, "debounce", util.DefaultSyncDebounce, "how long the manifests must stay unchanged before a sync.")
+	syncCmd.Flags().DurationVar(&syncOptions.Interval, "interval", util.DefaultSyncInterval, "how often the live state is checked with --watch, 0 to only sync on changes.")
+	syncCmd.Flags().StringVar(&syncOptions.StatusFile, "status-file", "", "write the JSON result of the last sync to this file.")
+	syncCmd.Flags().DurationVar(&syncOptions.Timeout, "timeout", 0, "time to wait for the replicas of a deployment to become available, defaults to its progressDeadlineSeconds or 10m.")
+
+	RootCmd.AddCommand(syncCmd)
+}
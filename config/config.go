@@ -0,0 +1,185 @@
+// Package config reads and writes the acictl configuration file, which holds
+// named contexts selecting a subscription, resource group, region, cloud and
+// credential, like the contexts of kubeconfig files.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghodss/yaml"
+)
+
+// Config is the content of the configuration file.
+type Config struct {
+	CurrentContext string            `json:"current-context,omitempty"`
+	Contexts       []NamedContext    `json:"contexts,omitempty"`
+	Credentials    []NamedCredential `json:"credentials,omitempty"`
+}
+
+// NamedContext is a context and its name.
+type NamedContext struct {
+	Name    string  `json:"name"`
+	Context Context `json:"context"`
+}
+
+// Context holds the defaults of the flags and environment variables that
+// select where acictl works.
+type Context struct {
+	Subscription  string `json:"subscription,omitempty"`
+	ResourceGroup string `json:"resource-group,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Cloud         string `json:"cloud,omitempty"`
+	// Credential is the name of an entry of the credentials.
+	Credential string `json:"credential,omitempty"`
+	// Output is the default output format of commands with an --output flag.
+	Output string `json:"output,omitempty"`
+}
+
+// NamedCredential is a credential and its name.
+type NamedCredential struct {
+	Name       string     `json:"name"`
+	Credential Credential `json:"credential"`
+}
+
+// Credential selects how to authenticate. Secrets are not stored in the
+// configuration file, but in the authentication file it refers to, the
+// environment or the token cache of the Azure CLI.
+type Credential struct {
+	AuthMode     string `json:"auth-mode,omitempty"`
+	TenantID     string `json:"tenant-id,omitempty"`
+	ClientID     string `json:"client-id,omitempty"`
+	AuthLocation string `json:"auth-location,omitempty"`
+}
+
+// DefaultPath returns the path of the configuration file, from ACICTL_CONFIG
+// or ~/.acictl/config.
+func DefaultPath() string {
+	if path := os.Getenv("ACICTL_CONFIG"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".acictl", "config")
+}
+
+// Load reads the configuration file at path, a missing file is an empty
+// configuration.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Reading config file %q failed: %v", path, err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Decoding config file %q failed: %v", path, err)
+	}
+
+	return &config, nil
+}
+
+// Save writes the configuration file at path, creating its directory. The
+// file is only readable by the user as it names their subscriptions.
+func (c *Config) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("Encoding config failed: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Creating config directory failed: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("Writing config file %q failed: %v", path, err)
+	}
+
+	return nil
+}
+
+// Context returns the context called name, or nil if there is none.
+func (c *Config) Context(name string) *Context {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i].Context
+		}
+	}
+
+	return nil
+}
+
+// SetContext adds the context called name, or returns the existing one, to
+// be changed in place.
+func (c *Config) SetContext(name string) *Context {
+	if context := c.Context(name); context != nil {
+		return context
+	}
+
+	c.Contexts = append(c.Contexts, NamedContext{Name: name})
+	sort.Slice(c.Contexts, func(i, j int) bool { return c.Contexts[i].Name < c.Contexts[j].Name })
+
+	return c.Context(name)
+}
+
+// Credential returns the credential called name, or nil if there is none.
+func (c *Config) Credential(name string) *Credential {
+	for i := range c.Credentials {
+		if c.Credentials[i].Name == name {
+			return &c.Credentials[i].Credential
+		}
+	}
+
+	return nil
+}
+
+// SetCredential adds the credential called name, or returns the existing one,
+// to be changed in place.
+func (c *Config) SetCredential(name string) *Credential {
+	if credential := c.Credential(name); credential != nil {
+		return credential
+	}
+
+	c.Credentials = append(c.Credentials, NamedCredential{Name: name})
+	sort.Slice(c.Credentials, func(i, j int) bool { return c.Credentials[i].Name < c.Credentials[j].Name })
+
+	return c.Credential(name)
+}
+
+// Resolve returns the context called name, the current context when name is
+// empty, and the credential it refers to. Both are nil when no context is
+// selected.
+func (c *Config) Resolve(name string) (*Context, *Credential, error) {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return nil, nil, nil
+	}
+
+	context := c.Context(name)
+	if context == nil {
+		return nil, nil, fmt.Errorf("Context %q is not in the config file, list the contexts with 'acictl config get-contexts'", name)
+	}
+
+	if context.Credential == "" {
+		return context, nil, nil
+	}
+
+	credential := c.Credential(context.Credential)
+	if credential == nil {
+		return nil, nil, fmt.Errorf("Credential %q of context %q is not in the config file", context.Credential, name)
+	}
+
+	return context, credential, nil
+}
@@ -0,0 +1,593 @@
+// Package emulator serves the subset of the Azure Resource Manager
+// Microsoft.ContainerInstance REST API that acictl uses, plus fake Azure
+// Active Directory token and device code endpoints and a fake managed identity
+// endpoint, backed by the in-memory fake client.
+package emulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samkreter/acictl/aci"
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+const (
+	containerGroupsResourceType = "microsoft.containerinstance/containergroups"
+
+	// DefaultPageSize is the number of container groups per list page.
+	DefaultPageSize = 100
+
+	// ManagedIdentityPath is the path of the managed identity token endpoint,
+	// set MSI_ENDPOINT to it to test the msi authentication mode.
+	ManagedIdentityPath = "metadata/identity/oauth2/token"
+
+	emulatorRefreshToken = "emulator-refresh-token"
+
+	// operationTTL is how long an operation whose status is never read to
+	// completion is kept.
+	operationTTL = time.Hour
+)
+
+// Server is an http.Handler emulating Azure Container Instances.
+type Server struct {
+	// Backend holds the container groups, its provisioning steps, quota and
+	// failing images can be configured directly.
+	Backend *fake.Client
+
+	// Latency is added to every request.
+	Latency time.Duration
+
+	// FailureRate is the fraction of resource manager requests, between 0
+	// and 1, that fail with FailureStatusCode.
+	FailureRate float64
+
+	// FailureStatusCode is the status code of injected failures, 429
+	// responses carry a Retry-After header.
+	FailureStatusCode int
+
+	// PageSize is the number of container groups returned per list page.
+	PageSize int
+
+	// Logger logs every request when it is not nil.
+	Logger *log.Logger
+
+	mu            sync.Mutex
+	rand          *rand.Rand
+	operations    map[string]operation
+	lastOperation int
+}
+
+// operation is a long-running operation started by a request.
+type operation struct {
+	// deletion operations are tracked through the Location header, others
+	// through the Azure-AsyncOperation header.
+	deletion      bool
+	resourceGroup string
+	name          string
+	started       time.Time
+}
+
+// NewServer creates an emulator with an empty backend.
+func NewServer() *Server {
+	return &Server{
+		Backend:           fake.NewClient(),
+		FailureStatusCode: http.StatusInternalServerError,
+		PageSize:          DefaultPageSize,
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		operations:        map[string]operation{},
+	}
+}
+
+// ServeHTTP routes a request to the token endpoint or a container group operation.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Logger != nil {
+		s.Logger.Printf("%s %s", r.Method, r.URL)
+	}
+
+	if s.Latency > 0 {
+		time.Sleep(s.Latency)
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	// Active Directory: /{tenant}/oauth2/token and /{tenant}/oauth2/devicecode
+	if len(segments) == 3 && strings.EqualFold(segments[1], "oauth2") {
+		switch strings.ToLower(segments[2]) {
+		case "token":
+			s.serveToken(w, r)
+			return
+		case "devicecode":
+			s.serveDeviceCode(w, r)
+			return
+		}
+	}
+
+	// Managed identity: /metadata/identity/oauth2/token
+	if strings.EqualFold(strings.Trim(r.URL.Path, "/"), ManagedIdentityPath) {
+		s.serveManagedIdentityToken(w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusUnauthorized, "AuthenticationFailed", "Authentication failed. The 'Authorization' header is missing.")
+		return
+	}
+
+	if s.shouldFail() {
+		if s.FailureStatusCode == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeError(w, s.FailureStatusCode, "InjectedFailure", "The emulator injected a failure for this request.")
+		return
+	}
+
+	// Operations: /subscriptions/{subscription}/providers/Microsoft.ContainerInstance/locations/{location}/operations/{id}
+	if len(segments) == 8 && strings.EqualFold(segments[4], "locations") && strings.EqualFold(segments[6], "operations") && r.Method == http.MethodGet {
+		s.serveOperation(w, r, segments[7])
+		return
+	}
+
+	resourceGroup, name, rest, ok := parseContainerGroupPath(segments)
+	if !ok {
+		writeError(w, http.StatusNotFound, "InvalidResourceType", fmt.Sprintf("The resource path '%s' is not supported by the emulator.", r.URL.Path))
+		return
+	}
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		s.serveList(w, r, resourceGroup)
+	case name != "" && len(rest) == 0:
+		s.serveContainerGroup(w, r, resourceGroup, name)
+	case name != "" && len(rest) == 1 && r.Method == http.MethodPost:
+		s.serveAction(w, r, resourceGroup, name, strings.ToLower(rest[0]))
+	case name != "" && len(rest) == 3 && strings.EqualFold(rest[0], "containers") && strings.EqualFold(rest[2], "logs") && r.Method == http.MethodGet:
+		s.serveLogs(w, r, resourceGroup, name, rest[1])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("The method '%s' is not supported for '%s'.", r.Method, r.URL.Path))
+	}
+}
+
+// parseContainerGroupPath splits a resource manager path into the resource
+// group, container group name and the remaining segments. The resource group
+// is empty for subscription wide lists and the name is empty for lists.
+func parseContainerGroupPath(segments []string) (string, string, []string, bool) {
+	if len(segments) < 2 || !strings.EqualFold(segments[0], "subscriptions") {
+		return "", "", nil, false
+	}
+	segments = segments[2:]
+
+	resourceGroup := ""
+	if len(segments) >= 2 && strings.EqualFold(segments[0], "resourceGroups") {
+		resourceGroup = segments[1]
+		segments = segments[2:]
+	}
+
+	if len(segments) < 3 || !strings.EqualFold(segments[0], "providers") || !strings.EqualFold(segments[1]+"/"+segments[2], containerGroupsResourceType) {
+		return "", "", nil, false
+	}
+	segments = segments[3:]
+
+	if len(segments) == 0 {
+		return resourceGroup, "", nil, true
+	}
+
+	// Operations on a container group need its resource group.
+	if resourceGroup == "" {
+		return "", "", nil, false
+	}
+
+	return resourceGroup, segments[0], segments[1:], true
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The token endpoint only supports POST.")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// Every grant needs its credential, but any value is accepted.
+	form := r.PostForm
+	var credential, refreshToken string
+	switch grantType := form.Get("grant_type"); grantType {
+	case "client_credentials":
+		credential = form.Get("client_secret") + form.Get("client_assertion")
+	case "refresh_token":
+		credential = form.Get("refresh_token")
+		refreshToken = emulatorRefreshToken
+	case "device_code":
+		credential = form.Get("code")
+		refreshToken = emulatorRefreshToken
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", fmt.Sprintf("The grant type %q is not supported.", grantType))
+		return
+	}
+
+	if credential == "" {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "The request has no client secret, client assertion, refresh token or device code.")
+		return
+	}
+
+	writeToken(w, form.Get("resource"), refreshToken)
+}
+
+// serveDeviceCode starts a device code sign in, which completes as soon as the
+// token endpoint is polled.
+func (s *Server) serveDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	verificationURL := requestURL(r, "/devicelogin", nil)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"device_code":      "emulator-device-code",
+		"user_code":        "EMULATOR",
+		"verification_url": verificationURL,
+		"expires_in":       "900",
+		"interval":         "1",
+		"message":          fmt.Sprintf("To sign in to the emulator, open %s and enter the code EMULATOR, or just wait.", verificationURL),
+	})
+}
+
+// serveManagedIdentityToken answers like the instance metadata service of an
+// Azure VM with a managed identity.
+func (s *Server) serveManagedIdentityToken(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Metadata") != "true" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Required metadata header not specified.")
+		return
+	}
+
+	resource := r.URL.Query().Get("resource")
+	if resource == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "Required query variable 'resource' is missing.")
+		return
+	}
+
+	writeToken(w, resource, "")
+}
+
+// writeToken writes an hour long access token for resource, with the refresh
+// token if it is not empty.
+func writeToken(w http.ResponseWriter, resource string, refreshToken string) {
+	now := time.Now()
+	token := map[string]string{
+		"access_token": "emulator-token",
+		"expires_in":   "3600",
+		"expires_on":   strconv.FormatInt(now.Add(time.Hour).Unix(), 10),
+		"not_before":   strconv.FormatInt(now.Unix(), 10),
+		"resource":     resource,
+		"token_type":   "Bearer",
+	}
+	if refreshToken != "" {
+		token["refresh_token"] = refreshToken
+	}
+
+	writeJSON(w, http.StatusOK, token)
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, resourceGroup string) {
+	ctx := r.Context()
+	list, err := s.Backend.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("$skipToken"))
+	if start < 0 || start > len(list.Value) {
+		start = len(list.Value)
+	}
+
+	pageSize := s.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	end := start + pageSize
+	page := client.ContainerGroupListResult{}
+	if end < len(list.Value) {
+		page.NextLink = nextLink(r, end)
+	} else {
+		end = len(list.Value)
+	}
+	page.Value = list.Value[start:end]
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) serveContainerGroup(w http.ResponseWriter, r *http.Request, resourceGroup, name string) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		cg, err, _ := s.Backend.GetContainerGroup(ctx, resourceGroup, name)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, cg)
+	case http.MethodPut:
+		var containerGroup client.ContainerGroup
+		if err := json.NewDecoder(r.Body).Decode(&containerGroup); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidRequestContent", fmt.Sprintf("The request content was invalid and could not be deserialized: %v", err))
+			return
+		}
+
+		status := http.StatusCreated
+		if s.exists(r.Context(), resourceGroup, name) {
+			status = http.StatusOK
+		}
+
+		cg, err := s.Backend.CreateContainerGroup(ctx, resourceGroup, name, containerGroup)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		s.startOperation(w, r, "Azure-AsyncOperation", cg.Location, operation{resourceGroup: resourceGroup, name: name})
+		writeJSON(w, status, cg)
+	case http.MethodPatch:
+		var resource client.Resource
+		if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidRequestContent", fmt.Sprintf("The request content was invalid and could not be deserialized: %v", err))
+			return
+		}
+
+		cg, err := s.Backend.UpdateContainerGroupTags(ctx, resourceGroup, name, resource.Tags)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, cg)
+	case http.MethodDelete:
+		if !s.exists(r.Context(), resourceGroup, name) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		location := ""
+		if cg, err, _ := s.Backend.GetContainerGroup(ctx, resourceGroup, name); err == nil {
+			location = cg.Location
+		}
+
+		if err := s.Backend.DeleteContainerGroup(ctx, resourceGroup, name); err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		s.startOperation(w, r, "Location", location, operation{deletion: true, resourceGroup: resourceGroup, name: name})
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("The method '%s' is not supported for container groups.", r.Method))
+	}
+}
+
+func (s *Server) serveAction(w http.ResponseWriter, r *http.Request, resourceGroup, name, action string) {
+	ctx := r.Context()
+
+	var err error
+	status := http.StatusNoContent
+	switch action {
+	case "restart":
+		err = s.Backend.RestartContainerGroup(ctx, resourceGroup, name)
+	case "stop":
+		err = s.Backend.StopContainerGroup(ctx, resourceGroup, name)
+	case "start":
+		err = s.Backend.StartContainerGroup(ctx, resourceGroup, name)
+		status = http.StatusAccepted
+	default:
+		writeError(w, http.StatusNotFound, "InvalidResourceType", fmt.Sprintf("The action '%s' is not supported by the emulator.", action))
+		return
+	}
+
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+
+	// Starts and restarts provision the container group again.
+	if action != "stop" {
+		s.startOperation(w, r, "Azure-AsyncOperation", "", operation{resourceGroup: resourceGroup, name: name})
+	}
+	w.WriteHeader(status)
+}
+
+// serveOperation reports the status of a long-running operation, following
+// the provisioning state of its container group.
+func (s *Server) serveOperation(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.Lock()
+	op, ok := s.operations[id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "OperationNotFound", fmt.Sprintf("The operation '%s' was not found.", id))
+		return
+	}
+
+	if op.deletion {
+		if s.exists(r.Context(), op.resourceGroup, op.name) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		s.removeOperation(id)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	status := map[string]interface{}{"id": id, "name": id}
+
+	cg, err, _ := s.Backend.GetContainerGroup(r.Context(), op.resourceGroup, op.name)
+	switch {
+	case err != nil:
+		status["status"] = "Canceled"
+		status["error"] = map[string]string{"code": "Canceled", "message": fmt.Sprintf("The container group '%s' was deleted.", op.name)}
+	case cg.ProvisioningState == "Succeeded":
+		status["status"] = "Succeeded"
+	case cg.ProvisioningState == "Failed":
+		status["status"] = "Failed"
+		status["error"] = provisioningError(cg)
+	default:
+		status["status"] = "InProgress"
+		w.Header().Set("Retry-After", "1")
+	}
+
+	// Operations that reached a terminal state are not polled anymore.
+	if status["status"] != "InProgress" {
+		s.removeOperation(id)
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// removeOperation forgets the operation once its terminal status is read.
+func (s *Server) removeOperation(id string) {
+	s.mu.Lock()
+	delete(s.operations, id)
+	s.mu.Unlock()
+}
+
+// startOperation records a long-running operation and sets the header
+// pointing to its status URL. Operations older than operationTTL, that
+// clients stopped polling, are pruned.
+func (s *Server) startOperation(w http.ResponseWriter, r *http.Request, header string, location string, op operation) {
+	op.started = time.Now()
+
+	s.mu.Lock()
+	for id, other := range s.operations {
+		if op.started.Sub(other.started) > operationTTL {
+			delete(s.operations, id)
+		}
+	}
+	s.lastOperation++
+	id := strconv.Itoa(s.lastOperation)
+	s.operations[id] = op
+	s.mu.Unlock()
+
+	if location == "" {
+		location = "local"
+	}
+
+	subscription := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[1]
+
+	statusURL := requestURL(r, fmt.Sprintf("/subscriptions/%s/providers/Microsoft.ContainerInstance/locations/%s/operations/%s", subscription, location, id), url.Values{"api-version": []string{r.URL.Query().Get("api-version")}})
+
+	w.Header().Set(header, statusURL)
+	w.Header().Set("Retry-After", "1")
+}
+
+// provisioningError describes why the container group failed to provision.
+func provisioningError(cg *client.ContainerGroup) map[string]string {
+	for _, container := range cg.Containers {
+		if container.InstanceView.CurrentState.DetailStatus == "ErrImagePull" {
+			return map[string]string{
+				"code":    "InaccessibleImage",
+				"message": fmt.Sprintf("The image '%s' in container group '%s' is not accessible. Please check the image and registry credential.", container.Image, cg.Name),
+			}
+		}
+	}
+
+	return map[string]string{"code": "Failed", "message": fmt.Sprintf("The container group '%s' failed to provision.", cg.Name)}
+}
+
+func (s *Server) serveLogs(w http.ResponseWriter, r *http.Request, resourceGroup, name, containerName string) {
+	ctx := r.Context()
+	tail, _ := strconv.Atoi(r.URL.Query().Get("tail"))
+
+	logs, err := s.Backend.GetContainerLogs(ctx, resourceGroup, name, containerName, tail)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, logs)
+}
+
+// exists checks for the container group without advancing its provisioning.
+func (s *Server) exists(ctx context.Context, resourceGroup, name string) bool {
+	list, err := s.Backend.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return false
+	}
+
+	for _, cg := range list.Value {
+		if strings.EqualFold(cg.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) shouldFail() bool {
+	if s.FailureRate <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rand.Float64() < s.FailureRate
+}
+
+// nextLink returns the URL of the list page starting at offset.
+func nextLink(r *http.Request, offset int) string {
+	query := r.URL.Query()
+	query.Set("$skipToken", strconv.Itoa(offset))
+
+	return requestURL(r, r.URL.Path, query)
+}
+
+// requestURL returns the absolute URL of path on the server handling r.
+func requestURL(r *http.Request, path string, query url.Values) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// writeBackendError writes an error of the fake client as a resource manager error.
+func writeBackendError(w http.ResponseWriter, err error) {
+	if armErr, ok := err.(*aci.Error); ok {
+		writeError(w, armErr.StatusCode, armErr.Code, armErr.Message)
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, "InternalServerError", err.Error())
+}
@@ -0,0 +1,100 @@
+package emulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const containerGroupPath = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.ContainerInstance/containerGroups/web-0?api-version=2018-04-01"
+
+// do sends an authenticated request to the emulator and returns the response
+// and the status of the operation it decodes from the body, if any.
+func do(t *testing.T, srv *httptest.Server, method, url, body string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer token")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+
+	return resp, status.Status
+}
+
+func TestOperationPruned(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		header string
+		body   string
+	}{
+		{name: "create", method: http.MethodPut, header: "Azure-AsyncOperation", body: `{"location":"westus","properties":{"containers":[{"name":"web","properties":{"image":"nginx"}}]}}`},
+		{name: "delete", method: http.MethodDelete, header: "Location"},
+	}
+
+	server := NewServer()
+	server.Backend.ProvisioningSteps = 1
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, _ := do(t, srv, test.method, srv.URL+containerGroupPath, test.body)
+			operationURL := resp.Header.Get(test.header)
+			if operationURL == "" {
+				t.Fatalf("%s returned status %d without a %s header", test.method, resp.StatusCode, test.header)
+			}
+
+			// Poll until the operation reaches a terminal state.
+			for i := 0; ; i++ {
+				resp, status := do(t, srv, http.MethodGet, operationURL, "")
+				if resp.StatusCode == http.StatusOK && status != "InProgress" {
+					break
+				}
+				if i == 10 {
+					t.Fatalf("Operation still running after %d polls", i)
+				}
+			}
+
+			if resp, _ := do(t, srv, http.MethodGet, operationURL, ""); resp.StatusCode != http.StatusNotFound {
+				t.Errorf("Reading a completed operation again returned status %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+
+	if len(server.operations) != 0 {
+		t.Errorf("Emulator kept %d operations, want none", len(server.operations))
+	}
+}
+
+func TestOperationExpired(t *testing.T) {
+	server := NewServer()
+	server.operations["stale"] = operation{resourceGroup: "rg", name: "web-0", started: time.Now().Add(-2 * operationTTL)}
+	server.operations["recent"] = operation{resourceGroup: "rg", name: "web-1", started: time.Now()}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	do(t, srv, http.MethodPut, srv.URL+containerGroupPath, `{"location":"westus","properties":{"containers":[{"name":"web","properties":{"image":"nginx"}}]}}`)
+
+	if _, ok := server.operations["stale"]; ok {
+		t.Errorf("Emulator kept an operation started %s ago", 2*operationTTL)
+	}
+	if _, ok := server.operations["recent"]; !ok {
+		t.Errorf("Emulator pruned an operation that is still recent")
+	}
+}
@@ -0,0 +1,78 @@
+module github.com/samkreter/acictl
+
+go 1.20
+
+require (
+	github.com/Azure/go-autorest v10.6.0+incompatible
+	github.com/fsnotify/fsnotify v1.6.0
+	github.com/ghodss/yaml v1.0.0
+	github.com/gorilla/websocket v1.4.0
+	github.com/samkreter/Kirix v0.0.0-00010101000000-000000000000
+	github.com/spf13/cobra v1.7.0
+	github.com/virtual-kubelet/virtual-kubelet v0.0.0-00010101000000-000000000000
+	k8s.io/api v0.0.0-20180308224125-73d903622b73
+	k8s.io/apimachinery v0.0.0-20180228050457-302974c03f7e
+	k8s.io/client-go v7.0.0+incompatible
+	k8s.io/helm v2.9.1+incompatible
+	sigs.k8s.io/kustomize/api v0.16.0
+	sigs.k8s.io/kustomize/kyaml v0.16.0
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
+	github.com/dimchansky/utfbom v0.0.0-20170328061312-6c6132ff69f0 // indirect
+	github.com/go-errors/errors v1.4.2 // indirect
+	github.com/go-openapi/jsonpointer v0.19.6 // indirect
+	github.com/go-openapi/jsonreference v0.20.2 // indirect
+	github.com/go-openapi/swag v0.22.3 // indirect
+	github.com/gogo/protobuf v1.0.0 // indirect
+	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/google/gnostic-models v0.6.8 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/google/gofuzz v1.2.0 // indirect
+	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/imdario/mergo v0.3.13 // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
+	github.com/json-iterator/go v1.1.12 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
+	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
+	github.com/modern-go/reflect2 v1.0.2 // indirect
+	github.com/monochromegane/go-gitignore v0.0.0-20200626010858-205db1a8cc00 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/xlab/treeprint v1.2.0 // indirect
+	go.starlark.net v0.0.0-20200306205701-8dd3e2ee1dd5 // indirect
+	golang.org/x/net v0.4.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.5.0 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+	gopkg.in/evanphx/json-patch.v5 v5.6.0 // indirect
+	gopkg.in/inf.v0 v0.9.1 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+	k8s.io/kube-openapi v0.0.0-20230601164746-7562a1006961 // indirect
+	sigs.k8s.io/yaml v1.4.0 // indirect
+)
+
+// k8s.io/helm v2.9.1 is not a module, the packages its template engine
+// imports are kept at the releases of its glide.lock.
+require (
+	github.com/Masterminds/semver v1.3.1 // indirect
+	github.com/Masterminds/sprig v2.15.0+incompatible // indirect
+	github.com/aokoli/goutils v1.0.1 // indirect
+	github.com/gobwas/glob v0.2.3 // indirect
+	github.com/huandu/xstrings v0.0.0-20151130125119-3959339b3335 // indirect
+	golang.org/x/crypto v0.0.0-20170825220121-81e90905daef // indirect
+)
+
+// The ACI client of virtual-kubelet v0.2-beta-9 and the ACI provider of Kirix
+// are not published as modules, copies of them are kept in third_party.
+replace (
+	github.com/samkreter/Kirix => ./third_party/Kirix
+	github.com/virtual-kubelet/virtual-kubelet => ./third_party/virtual-kubelet
+)
@@ -0,0 +1 @@
+module github.com/virtual-kubelet/virtual-kubelet
@@ -0,0 +1,2 @@
+// Package aci provides tools for interacting with the Azure Container Instances API.
+package aci
@@ -0,0 +1,3 @@
+// Package azure and subpackages are used to perform operations using the
+// Azure Resource Manager (ARM).
+package azure
@@ -0,0 +1,136 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/engine"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/timeconv"
+	helmversion "k8s.io/helm/pkg/version"
+)
+
+var (
+	// ChartRelease is the release name charts are rendered with, the name of
+	// the chart when empty.
+	ChartRelease string
+
+	// chartKubeVersion is the Kubernetes version of .Capabilities, the one
+	// of the vendored API types.
+	chartKubeVersion = version.Info{Major: "1", Minor: "10", GitVersion: "v1.10.0"}
+
+	// chartHookAnnotation marks the objects Helm runs as hooks of a release.
+	chartHookAnnotation = "helm.sh/hook"
+)
+
+// LoadChart renders the chart of the directory or packaged .tgz archive with
+// Helm, with the values of its values.yaml overridden by ManifestValues, and
+// loads its workloads, ConfigMaps and Secrets like loadObjects. Hooks are
+// ignored.
+func LoadChart(chartPath string, name string) (string, error) {
+	c, err := chartutil.Load(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("Loading chart %s failed: %v", chartPath, err)
+	}
+
+	objects, err := renderChart(chartPath, c)
+	if err != nil {
+		return "", err
+	}
+
+	var loaded []*manifestObject
+	for _, object := range objects {
+		if _, ok := nestedMap(object.fields, "metadata", "annotations")[chartHookAnnotation]; ok {
+			fmt.Fprintf(os.Stderr, "Warning: %s renders the %s %s as a hook, which acictl ignores.\n", chartPath, object.kind(), object.name())
+			continue
+		}
+		loaded = append(loaded, object)
+	}
+
+	return loadObjects(chartPath, name, loaded)
+}
+
+// renderChart renders the templates of the chart and its subcharts as Tiller
+// does for the install of a release, and decodes the objects of their output.
+func renderChart(chartPath string, c *chart.Chart) ([]*manifestObject, error) {
+	raw, err := yaml.Marshal(ManifestValues)
+	if err != nil {
+		return nil, err
+	}
+	config := &chart.Config{Raw: string(raw)}
+
+	if err := chartutil.ProcessRequirementsEnabled(c, config); err != nil {
+		return nil, fmt.Errorf("Processing the requirements of %s failed: %v", chartPath, err)
+	}
+	if err := chartutil.ProcessRequirementsImportValues(c); err != nil {
+		return nil, fmt.Errorf("Importing the values of the dependencies of %s failed: %v", chartPath, err)
+	}
+
+	options := chartutil.ReleaseOptions{
+		Name:      firstNonEmptyString(ChartRelease, c.Metadata.Name),
+		Time:      timeconv.Now(),
+		Namespace: "default",
+		IsInstall: true,
+		Revision:  1,
+	}
+	capabilities := &chartutil.Capabilities{
+		APIVersions:   chartAPIVersions(),
+		KubeVersion:   &chartKubeVersion,
+		TillerVersion: helmversion.GetVersionProto(),
+	}
+	values, err := chartutil.ToRenderValuesCaps(c, config, options, capabilities)
+	if err != nil {
+		return nil, fmt.Errorf("Reading the values of %s failed: %v", chartPath, err)
+	}
+
+	rendered, err := engine.New().Render(c, values)
+	if err != nil {
+		return nil, fmt.Errorf("Rendering chart %s failed: %v", chartPath, err)
+	}
+
+	var files []string
+	for file := range rendered {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	// Like Tiller, the notes are not manifests and templates rendering
+	// nothing are skipped.
+	var objects []*manifestObject
+	for _, file := range files {
+		if strings.HasSuffix(file, "NOTES.txt") || strings.TrimSpace(rendered[file]) == "" {
+			continue
+		}
+
+		// The files are named after the chart, their path in it follows.
+		source := path.Join(chartPath, strings.SplitN(file, "/", 2)[1])
+		templateObjects, err := decodeManifestObjects(source, []byte(rendered[file]))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, templateObjects...)
+	}
+
+	return objects, nil
+}
+
+// chartAPIVersions returns the API versions of .Capabilities, the group
+// versions of the vendored API types.
+func chartAPIVersions() chartutil.VersionSet {
+	var versions []string
+	for gvk := range scheme.Scheme.AllKnownTypes() {
+		if gvk.Version != runtime.APIVersionInternal {
+			versions = append(versions, gvk.GroupVersion().String())
+		}
+	}
+
+	return chartutil.NewVersionSet(versions...)
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// testChart is a chart with a subchart enabled by a value, a helper template,
+// a hook and notes.
+var testChart = map[string]string{
+	"web/Chart.yaml": `name: web
+version: 0.1.0
+`,
+	"web/values.yaml": `image:
+  tag: "1.0"
+db:
+  enabled: false
+`,
+	"web/requirements.yaml": `dependencies:
+- name: db
+  version: 0.1.0
+  condition: db.enabled
+`,
+	"web/templates/_helpers.tpl": `{{- define "web.fullname" -}}
+{{ printf "%s-%s" .Release.Name .Chart.Name | trunc 63 | trimSuffix "-" }}
+{{- end -}}
+`,
+	"web/templates/deployment.yaml": `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: {{ include "web.fullname" . }}
+spec:
+  replicas: {{ if semverCompare ">=1.9" .Capabilities.KubeVersion.GitVersion }}2{{ else }}1{{ end }}
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:{{ .Values.image.tag }}
+        env:
+        - name: RELEASE
+          value: {{ .Release.Name | upper | quote }}
+`,
+	"web/templates/migrate.yaml": `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-migrate
+  annotations:
+    helm.sh/hook: pre-install
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: migrate
+`,
+	"web/templates/NOTES.txt": `Visit {{ .Release.Name }}.`,
+	"web/charts/db/Chart.yaml": `name: db
+version: 0.1.0
+`,
+	"web/charts/db/templates/deployment.yaml": `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-db
+spec:
+  template:
+    spec:
+      containers:
+      - name: db
+        image: postgres
+`,
+}
+
+func TestLoadChart(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        map[string]interface{}
+		wantWorkloads int
+	}{
+		{
+			name:          "subchart disabled",
+			wantWorkloads: 1,
+		},
+		{
+			name:          "subchart enabled",
+			values:        map[string]interface{}{"db": map[string]interface{}{"enabled": true}},
+			wantWorkloads: 2,
+		},
+	}
+
+	chartPath := filepath.Join(writeFiles(t, testChart), "web")
+
+	values, release := ManifestValues, ChartRelease
+	ChartRelease = "prod"
+	defer func() { ManifestValues, ChartRelease = values, release }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ManifestValues = test.values
+
+			if _, err := LoadChart(chartPath, ""); err != nil {
+				t.Fatal(err)
+			}
+			if len(builtWorkloads) != test.wantWorkloads {
+				t.Errorf("Chart rendered the workloads %v, want %d", builtWorkloads, test.wantWorkloads)
+			}
+
+			ref, err := LoadChart(chartPath, "prod-web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			obj, _, err := readManifest(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deployment := obj.(*v1beta1.Deployment)
+
+			if *deployment.Spec.Replicas != 2 {
+				t.Errorf("Deployment has %d replicas, want the 2 of Kubernetes 1.9 and later", *deployment.Spec.Replicas)
+			}
+			container := deployment.Spec.Template.Spec.Containers[0]
+			if got := fmt.Sprintf("%s %s=%s", container.Image, container.Env[0].Name, container.Env[0].Value); got != "nginx:1.0 RELEASE=PROD" {
+				t.Errorf("Container is %q, want %q", got, "nginx:1.0 RELEASE=PROD")
+			}
+		})
+	}
+}
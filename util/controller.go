@@ -0,0 +1,496 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/api/extensions/v1beta1"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+var (
+	// DefaultControllerInterval is how often the controller checks the
+	// replicas.
+	DefaultControllerInterval = 30 * time.Second
+	// DefaultCrashLoopRestarts and DefaultCrashLoopWindow define a crash
+	// looping replica: its containers restarted that many times within the
+	// window.
+	DefaultCrashLoopRestarts = 3
+	DefaultCrashLoopWindow   = 10 * time.Minute
+	// DefaultReplacementsPerMinute bounds how many replicas the controller
+	// creates per minute across every deployment.
+	DefaultReplacementsPerMinute = 10
+
+	// ControllerBackoff is the delay before a replica is replaced again, doubled
+	// for every further replacement up to MaxControllerBackoff. The count is
+	// reset once the replacement stayed healthy for the crash loop window.
+	ControllerBackoff    = 10 * time.Second
+	MaxControllerBackoff = 5 * time.Minute
+)
+
+// Controller keeps the replicas of deployments running, like the Kubernetes
+// replica set controller. Deleted replicas are created again, and replicas
+// that failed, terminated or are crash looping are replaced.
+//
+// The replica count comes from the manifest of the deployment, or else from
+// the ReplicasTag of its replicas. New replicas copy the spec and the tags of
+// a live replica of the latest revision, or are built from the manifest once
+// none is left.
+//
+// The controller also deletes the finished jobs of the resource group once
+// their ttlSecondsAfterFinished has passed.
+type Controller struct {
+	Client        aci.ContainerGroupClient
+	ResourceGroup string
+	Region        string
+	Clock         Clock
+
+	// Manifests maps the names of deployments to their manifest file. When
+	// set, only those deployments are controlled.
+	Manifests map[string]string
+
+	Interval              time.Duration
+	CrashLoopRestarts     int
+	CrashLoopWindow       time.Duration
+	ReplacementsPerMinute int
+
+	replicas map[string]*replicaState
+	limiter  *tokenBucket
+}
+
+// replicaState is what the controller remembers of a replica between checks.
+// The state of the missing replicas of a deployment is kept under the name of
+// the deployment, prefixed with deploymentStateKey.
+type replicaState struct {
+	// restarts samples the restart count of the containers over the crash
+	// loop window.
+	restarts []restartSample
+
+	replacements int
+	lastReplaced time.Time
+	nextAttempt  time.Time
+	// announced records that the pending replacement was reported.
+	announced bool
+	// short records that replicas of the deployment were missing.
+	short bool
+	seen  bool
+}
+
+// deploymentStateKey prefixes the deployment names in the replica states, it
+// can not appear in a container group name.
+const deploymentStateKey = "deployment/"
+
+type restartSample struct {
+	at    time.Time
+	count int32
+}
+
+// ReadDeploymentManifests returns the files of the deployment in the file at
+// path, or of the deployments in the manifests of the directory at path,
+// keyed by deployment name.
+func ReadDeploymentManifests(path string) (map[string]string, error) {
+	files := []string{path}
+	entries, err := ioutil.ReadDir(path)
+	if path == builtSource && builtSource != "" {
+		files = builtWorkloads
+	} else if err == nil {
+		files = nil
+		for _, entry := range entries {
+			if !entry.IsDir() && isManifestFile(entry.Name()) {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	manifests := map[string]string{}
+	for _, file := range files {
+		obj, _, err := readManifest(file)
+		if err != nil {
+			return nil, err
+		}
+
+		deployment, ok := obj.(*v1beta1.Deployment)
+		if !ok {
+			if file == path {
+				return nil, fmt.Errorf("%s does not hold a Deployment but a %s", file, obj.GetObjectKind().GroupVersionKind().Kind)
+			}
+			continue
+		}
+
+		if other, ok := manifests[deployment.Name]; ok {
+			return nil, fmt.Errorf("Deployment %s is defined in both %s and %s", deployment.Name, other, file)
+		}
+		manifests[deployment.Name] = file
+	}
+
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("No Deployment found in %s", path)
+	}
+
+	return manifests, nil
+}
+
+// Run checks the replicas every Interval until the context is cancelled.
+func (c *Controller) Run(ctx context.Context) error {
+	if c.Clock == nil {
+		c.Clock = RealClock
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultControllerInterval
+	}
+	if c.CrashLoopRestarts <= 0 {
+		return fmt.Errorf("The crash loop restart count must be positive, got %d", c.CrashLoopRestarts)
+	}
+	if c.ReplacementsPerMinute <= 0 {
+		return fmt.Errorf("The replacements per minute must be positive, got %d", c.ReplacementsPerMinute)
+	}
+
+	c.replicas = map[string]*replicaState{}
+	c.limiter = newTokenBucket(c.ReplacementsPerMinute, time.Minute, c.Clock.Now())
+
+	fmt.Printf("Controlling the deployments of resource group %s every %s.\n", c.ResourceGroup, c.Interval)
+
+	for {
+		if err := c.reconcile(ctx); err != nil && ctx.Err() == nil {
+			fmt.Println(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Controller stopped (%s)", ctx.Err())
+		case <-c.Clock.After(c.Interval):
+		}
+	}
+}
+
+// reconcile checks the replicas of every controlled deployment once.
+func (c *Controller) reconcile(ctx context.Context) error {
+	cgList, err := c.Client.ListContainerGroups(ctx, c.ResourceGroup)
+	if err != nil {
+		return fmt.Errorf("Container group list error: %w", err)
+	}
+
+	deployments := map[string][]client.ContainerGroup{}
+	for name := range c.Manifests {
+		deployments[name] = nil
+	}
+	for _, cg := range cgList.Value {
+		name, ok := cg.Tags[DeploymentTag]
+		if !ok || !IsOwnedBy(cg, name) {
+			continue
+		}
+		if _, ok := c.Manifests[name]; c.Manifests != nil && !ok {
+			continue
+		}
+		deployments[name] = append(deployments[name], cg)
+	}
+
+	names := make([]string, 0, len(deployments))
+	for name := range deployments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, state := range c.replicas {
+		state.seen = false
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		groups := deployments[name]
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+		if err := c.reconcileDeployment(ctx, name, groups); err != nil {
+			fmt.Printf("Deployment %s: %s\n", name, err)
+		}
+	}
+
+	// Forget the replicas that are gone for good, such as the replicas of a
+	// deleted deployment.
+	for name, state := range c.replicas {
+		if !state.seen {
+			delete(c.replicas, name)
+		}
+	}
+
+	return DeleteExpiredJobs(ctx, c.Client, c.ResourceGroup, c.Clock.Now())
+}
+
+// reconcileDeployment replaces the unhealthy replicas of the deployment and
+// creates the missing ones.
+func (c *Controller) reconcileDeployment(ctx context.Context, name string, groups []client.ContainerGroup) error {
+	now := c.Clock.Now()
+
+	desired := -1
+	if file, ok := c.Manifests[name]; ok {
+		deployment, err := GetDeploymentFromFile(file)
+		if err != nil {
+			return err
+		}
+		desired = int(getReplicas(deployment))
+	} else if len(groups) > 0 {
+		if replicas, err := strconv.Atoi(latestContainerGroup(groups).Tags[ReplicasTag]); err == nil {
+			desired = replicas
+		}
+	}
+
+	// A rollout replaces the replicas itself.
+	hashes := map[string]bool{}
+	for _, cg := range groups {
+		hashes[cg.Tags[TemplateHashTag]] = true
+	}
+	if len(hashes) > 1 {
+		return nil
+	}
+
+	present := 0
+	var unhealthy []client.ContainerGroup
+	reasons := map[string]string{}
+	for _, cg := range groups {
+		live, err, status := c.Client.GetContainerGroup(ctx, c.ResourceGroup, cg.Name)
+		if status != nil && *status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Containers that are not restarted Always, such as those of
+		// 'acictl run --restart Never', are expected to exit.
+		if live.RestartPolicy != "" && live.RestartPolicy != client.Always {
+			return nil
+		}
+
+		present++
+		if reason := c.check(live, now); reason != "" {
+			unhealthy = append(unhealthy, cg)
+			reasons[cg.Name] = reason
+		}
+	}
+
+	for _, cg := range unhealthy {
+		if err := c.replace(ctx, name, groups, cg, reasons[cg.Name], now); err != nil {
+			return err
+		}
+	}
+
+	state := c.state(deploymentStateKey + name)
+	missing := desired - present
+	if missing <= 0 {
+		if len(unhealthy) == 0 && now.Sub(state.lastReplaced) >= c.CrashLoopWindow {
+			state.replacements = 0
+		}
+		state.short = false
+		return nil
+	}
+
+	// Replicas are only missing when they were also missing at the previous
+	// check, so the controller does not race a deployment being created.
+	if !state.short {
+		state.short = true
+		return nil
+	}
+
+	if !c.ready(state, fmt.Sprintf("Deployment %s is missing %d of %d replicas", name, missing, desired), now) {
+		return nil
+	}
+
+	template, err := scaleTemplate(ctx, c.Client, groups, name, c.Manifests[name], c.ResourceGroup, c.Region)
+	if err != nil {
+		return err
+	}
+	if desired >= 0 {
+		template.Tags[ReplicasTag] = strconv.Itoa(desired)
+	}
+
+	namer, err := newReplicaNamer(ctx, c.Client, c.ResourceGroup, name, template.Tags[TemplateHashTag])
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < missing; i++ {
+		if !c.limiter.take(c.Clock.Now()) {
+			fmt.Printf("Deployment %s: %d replicas are left to create after the rate limit of %d per minute.\n", name, missing-i, c.ReplacementsPerMinute)
+			break
+		}
+
+		cg := *template
+		if cg.Name, err = namer.next(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Creating Container Group %s, a missing replica of deployment %s.\n", cg.Name, name)
+		if _, err := c.Client.CreateContainerGroup(ctx, c.ResourceGroup, cg.Name, cg); err != nil {
+			return err
+		}
+	}
+	c.replaced(state, now)
+
+	return nil
+}
+
+// check returns why the replica needs to be replaced, or "" when it is
+// healthy. A replica stopped with 'acictl stop' is left alone.
+func (c *Controller) check(live *client.ContainerGroup, now time.Time) string {
+	state := c.state(live.Name)
+
+	var restarts int32
+	for _, container := range live.Containers {
+		restarts += container.InstanceView.RestartCount
+	}
+
+	samples := append(state.restarts, restartSample{at: now, count: restarts})
+	for len(samples) > 1 && now.Sub(samples[0].at) > c.CrashLoopWindow {
+		samples = samples[1:]
+	}
+	state.restarts = samples
+
+	switch {
+	case live.ProvisioningState == "Failed":
+		return "failed to provision"
+	case isContainerGroupFinished(live):
+		return fmt.Sprintf("terminated (%s)", live.InstanceView.State)
+	case restarts-samples[0].count >= int32(c.CrashLoopRestarts):
+		return fmt.Sprintf("crash looping, restarted %d times in %s", restarts-samples[0].count, now.Sub(samples[0].at).Round(time.Second))
+	}
+
+	if now.Sub(state.lastReplaced) >= c.CrashLoopWindow {
+		state.replacements = 0
+	}
+	state.announced = false
+
+	return ""
+}
+
+// replace deletes the unhealthy replica and creates it again under the same
+// name, unless it is backing off or the rate limit is reached.
+func (c *Controller) replace(ctx context.Context, deploymentName string, groups []client.ContainerGroup, cg client.ContainerGroup, reason string, now time.Time) error {
+	state := c.state(cg.Name)
+	if !c.ready(state, fmt.Sprintf("Replica %s of deployment %s is %s", cg.Name, deploymentName, reason), now) {
+		return nil
+	}
+
+	if !c.limiter.take(now) {
+		fmt.Printf("Replica %s of deployment %s is left to replace after the rate limit of %d per minute.\n", cg.Name, deploymentName, c.ReplacementsPerMinute)
+		return nil
+	}
+
+	template, err := scaleTemplate(ctx, c.Client, groups, deploymentName, c.Manifests[deploymentName], c.ResourceGroup, c.Region)
+	if err != nil {
+		return err
+	}
+	template.Name = cg.Name
+
+	fmt.Printf("Replacing replica %s of deployment %s, it is %s.\n", cg.Name, deploymentName, reason)
+	if err := c.Client.DeleteContainerGroup(ctx, c.ResourceGroup, cg.Name); err != nil {
+		return fmt.Errorf("Delete container group error: %w", err)
+	}
+	if err := waitForDeletion(ctx, c.Client, c.ResourceGroup, cg.Name); err != nil {
+		return err
+	}
+
+	fmt.Printf("Creating Container Group %s.\n", cg.Name)
+	if _, err := c.Client.CreateContainerGroup(ctx, c.ResourceGroup, cg.Name, *template); err != nil {
+		return err
+	}
+
+	c.replaced(state, now)
+	state.restarts = nil
+
+	return nil
+}
+
+// ready reports whether the replica, or the missing replicas of a deployment,
+// may be replaced now. The first time it is backing off, the problem is
+// reported with the time left.
+func (c *Controller) ready(state *replicaState, problem string, now time.Time) bool {
+	if now.Before(state.nextAttempt) {
+		if !state.announced {
+			fmt.Printf("%s, backing off for %s.\n", problem, state.nextAttempt.Sub(now).Round(time.Second))
+			state.announced = true
+		}
+		return false
+	}
+
+	return true
+}
+
+// replaced records a replacement and backs further ones off.
+func (c *Controller) replaced(state *replicaState, now time.Time) {
+	state.replacements++
+	state.lastReplaced = now
+	state.nextAttempt = now.Add(controllerBackoff(state.replacements))
+	state.announced = false
+}
+
+// state returns the state of the named replica or deployment.
+func (c *Controller) state(name string) *replicaState {
+	state, ok := c.replicas[name]
+	if !ok {
+		state = &replicaState{}
+		c.replicas[name] = state
+	}
+	state.seen = true
+
+	return state
+}
+
+// controllerBackoff returns the delay before the next replacement after the
+// given number of replacements.
+func controllerBackoff(replacements int) time.Duration {
+	backoff := ControllerBackoff
+	for i := 1; i < replacements && backoff < MaxControllerBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > MaxControllerBackoff {
+		return MaxControllerBackoff
+	}
+
+	return backoff
+}
+
+// tokenBucket allows a burst of capacity events, refilled at capacity per
+// period.
+type tokenBucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity int, period time.Duration, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		rate:     float64(capacity) / period.Seconds(),
+		last:     now,
+	}
+}
+
+// take reports whether an event is allowed now, consuming a token if so.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
@@ -0,0 +1,223 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// controllerClient records the created container groups, and reports the
+// restart counts set in restarts for the containers of the named groups.
+type controllerClient struct {
+	*createRecorder
+	restarts map[string]int32
+}
+
+func (c *controllerClient) GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*client.ContainerGroup, error, *int) {
+	cg, err, status := c.createRecorder.GetContainerGroup(ctx, resourceGroup, containerGroupName)
+	if cg != nil {
+		for i := range cg.Containers {
+			cg.Containers[i].InstanceView.RestartCount = c.restarts[containerGroupName]
+		}
+	}
+
+	return cg, err, status
+}
+
+// newTestController creates the deployment web of the manifest and returns a
+// controller of it, in the state Run starts it in.
+func newTestController(t *testing.T, manifest string, replacementsPerMinute int) (*Controller, *controllerClient, *fakeClock) {
+	t.Helper()
+	fastPolling(t)
+
+	aciClient := &controllerClient{
+		createRecorder: &createRecorder{Client: fake.NewClient()},
+		restarts:       map[string]int32{},
+	}
+	file := writeManifest(t, manifest)
+	if err := Create(context.Background(), aciClient.Client, file, testResourceGroup, "westus", false); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := &fakeClock{now: time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)}
+	c := &Controller{
+		Client:                aciClient,
+		ResourceGroup:         testResourceGroup,
+		Region:                "westus",
+		Clock:                 clock,
+		Manifests:             map[string]string{"web": file},
+		Interval:              DefaultControllerInterval,
+		CrashLoopRestarts:     3,
+		CrashLoopWindow:       10 * time.Minute,
+		ReplacementsPerMinute: replacementsPerMinute,
+		replicas:              map[string]*replicaState{},
+		limiter:               newTokenBucket(replacementsPerMinute, time.Minute, clock.Now()),
+	}
+
+	return c, aciClient, clock
+}
+
+// reconcileAt advances the clock by d and reconciles, returning the number
+// of container groups created so far.
+func reconcileAt(t *testing.T, c *Controller, aciClient *controllerClient, clock *fakeClock, d time.Duration) int {
+	t.Helper()
+
+	clock.set(clock.Now().Add(d))
+	if err := c.reconcile(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return len(aciClient.created)
+}
+
+func deleteReplica(t *testing.T, aciClient *controllerClient, name string) {
+	t.Helper()
+
+	if err := aciClient.DeleteContainerGroup(context.Background(), testResourceGroup, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestControllerMissingReplicas(t *testing.T) {
+	c, aciClient, clock := newTestController(t, deploymentManifest("web", 2, "nginx"), 10)
+	groups := listGroups(t, aciClient)
+
+	if created := reconcileAt(t, c, aciClient, clock, 0); created != 0 {
+		t.Fatalf("Controller created %d replicas of a complete deployment", created)
+	}
+
+	deleteReplica(t, aciClient, groups[0].Name)
+
+	// A replica is only created once it was missing at two checks.
+	if created := reconcileAt(t, c, aciClient, clock, 0); created != 0 {
+		t.Fatalf("Controller created %d replicas at the first check missing one", created)
+	}
+	if created := reconcileAt(t, c, aciClient, clock, time.Second); created != 1 {
+		t.Fatalf("Controller created %d replicas at the second check missing one, want 1", created)
+	}
+	if groups := listGroups(t, aciClient); len(groups) != 2 {
+		t.Fatalf("Deployment has %d replicas, want 2", len(groups))
+	}
+
+	// The next missing replica is backed off for ControllerBackoff.
+	deleteReplica(t, aciClient, groups[1].Name)
+	reconcileAt(t, c, aciClient, clock, time.Second)
+	if created := reconcileAt(t, c, aciClient, clock, time.Second); created != 1 {
+		t.Fatalf("Controller created a replica %s after the previous one, want a backoff of %s", 2*time.Second, ControllerBackoff)
+	}
+	if created := reconcileAt(t, c, aciClient, clock, ControllerBackoff); created != 2 {
+		t.Fatalf("Controller created %d replicas after the backoff, want 2", created)
+	}
+}
+
+func TestControllerRateLimit(t *testing.T) {
+	c, aciClient, clock := newTestController(t, deploymentManifest("web", 3, "nginx"), 1)
+	for _, cg := range listGroups(t, aciClient) {
+		deleteReplica(t, aciClient, cg.Name)
+	}
+
+	reconcileAt(t, c, aciClient, clock, 0)
+	if created := reconcileAt(t, c, aciClient, clock, time.Second); created != 1 {
+		t.Fatalf("Controller created %d replicas, want the 1 of the rate limit", created)
+	}
+
+	// The backoff passed, but the bucket only refilled after a minute.
+	if created := reconcileAt(t, c, aciClient, clock, 30*time.Second); created != 1 {
+		t.Fatalf("Controller created %d replicas half a minute later, want 1", created)
+	}
+	if created := reconcileAt(t, c, aciClient, clock, 30*time.Second); created != 2 {
+		t.Fatalf("Controller created %d replicas a minute later, want 2", created)
+	}
+}
+
+func TestControllerFailedReplicaBackoff(t *testing.T) {
+	c, aciClient, clock := newTestController(t, deploymentManifest("web", 1, "broken"), 10)
+	aciClient.FailingImages["broken"] = true
+
+	// Every replacement fails again, and is backed off twice as long as the
+	// previous one.
+	steps := []struct {
+		after       time.Duration
+		wantCreated int
+	}{
+		{after: 0, wantCreated: 1},
+		{after: time.Second, wantCreated: 1},
+		{after: ControllerBackoff, wantCreated: 2},
+		{after: ControllerBackoff, wantCreated: 2},
+		{after: ControllerBackoff, wantCreated: 3},
+	}
+	for i, step := range steps {
+		if created := reconcileAt(t, c, aciClient, clock, step.after); created != step.wantCreated {
+			t.Fatalf("Step %d: controller created %d replacements, want %d", i, created, step.wantCreated)
+		}
+	}
+
+	if groups := listGroups(t, aciClient); len(groups) != 1 || groups[0].Name != aciClient.created[0].Name {
+		t.Errorf("Replacements left the container groups %v, want the replica under its name", containerGroupNames(groups))
+	}
+}
+
+func TestControllerCrashLoop(t *testing.T) {
+	tests := []struct {
+		name        string
+		restarts    []int32
+		interval    time.Duration
+		wantCreated int
+	}{
+		{name: "restarting within the window", restarts: []int32{0, 2, 3}, interval: time.Minute, wantCreated: 1},
+		{name: "too few restarts", restarts: []int32{0, 1, 2}, interval: time.Minute, wantCreated: 0},
+		{name: "restarts spread over the window", restarts: []int32{0, 2, 4}, interval: 6 * time.Minute, wantCreated: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, aciClient, clock := newTestController(t, deploymentManifest("web", 1, "nginx"), 10)
+			name := listGroups(t, aciClient)[0].Name
+
+			created := 0
+			for i, restarts := range test.restarts {
+				aciClient.restarts[name] = restarts
+
+				after := test.interval
+				if i == 0 {
+					after = 0
+				}
+				created = reconcileAt(t, c, aciClient, clock, after)
+			}
+
+			if created != test.wantCreated {
+				t.Errorf("Controller replaced the replica %d times, want %d", created, test.wantCreated)
+			}
+		})
+	}
+}
+
+func TestControllerSkipsRollout(t *testing.T) {
+	c, aciClient, clock := newTestController(t, deploymentManifest("web", 3, "nginx"), 10)
+	groups := listGroups(t, aciClient)
+	deleteReplica(t, aciClient, groups[0].Name)
+
+	// A replica of another template means a rollout is replacing them.
+	tags := copyTags(groups[2].Tags)
+	tags[TemplateHashTag] = "rollout"
+	if _, err := aciClient.UpdateContainerGroupTags(context.Background(), testResourceGroup, groups[2].Name, tags); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileAt(t, c, aciClient, clock, 0)
+	if created := reconcileAt(t, c, aciClient, clock, time.Second); created != 0 {
+		t.Fatalf("Controller created %d replicas during a rollout", created)
+	}
+
+	if _, err := aciClient.UpdateContainerGroupTags(context.Background(), testResourceGroup, groups[2].Name, groups[2].Tags); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileAt(t, c, aciClient, clock, time.Second)
+	if created := reconcileAt(t, c, aciClient, clock, time.Second); created != 1 {
+		t.Fatalf("Controller created %d replicas after the rollout, want 1", created)
+	}
+}
@@ -0,0 +1,496 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+// Tags acictl sets on the container groups of the jobs of a cron job, in
+// addition to the tags of the job. They hold the state of the scheduler, so
+// that it picks up where it left off when it is restarted.
+const (
+	CronJobTag           = "acictl-cronjob"
+	CronScheduledTimeTag = "acictl-cron-scheduled-time"
+)
+
+var (
+	// The Kubernetes defaults of the history limits.
+	defaultSuccessfulJobsHistoryLimit int32 = 3
+	defaultFailedJobsHistoryLimit     int32 = 1
+
+	// cronResyncInterval bounds the time the scheduler sleeps, so that the
+	// history of cron jobs is pruned and clock changes are noticed.
+	cronResyncInterval = time.Minute
+
+	// maxMissedSchedules is the number of missed start times above which the
+	// scheduler warns about them, like the Kubernetes cron job controller.
+	maxMissedSchedules = 100
+)
+
+// Clock tells the time. The cron scheduler takes a Clock so that schedules
+// can be evaluated against a fake time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RealClock is the Clock of the system.
+var RealClock Clock = realClock{}
+
+// CronJob is a batch/v1beta1 CronJob, with the timeZone and
+// ttlSecondsAfterFinished fields that the vendored API types predate.
+type CronJob struct {
+	*batchv1beta1.CronJob
+	TimeZone                   string
+	JobTTLSecondsAfterFinished *int32
+}
+
+// cronJobRun is a job started by the scheduler for a cron job.
+type cronJobRun struct {
+	jobName     string
+	scheduled   time.Time
+	condition   string
+	ttlDeadline time.Time
+}
+
+// cronRun is a job the scheduler is running.
+type cronRun struct {
+	cronJob  string
+	cancel   context.CancelFunc
+	finished chan struct{}
+}
+
+// cronState is a cron job and the last time it was scheduled.
+type cronState struct {
+	cronJob  *CronJob
+	schedule *Schedule
+	last     time.Time
+}
+
+// CronScheduler runs the jobs of cron jobs on their schedule.
+type CronScheduler struct {
+	Client        aci.ContainerGroupClient
+	ResourceGroup string
+	Region        string
+	Clock         Clock
+
+	mu   sync.Mutex
+	runs map[string]*cronRun
+	done chan string
+}
+
+// ReadCronJobs reads the cron job in the file at path, or the cron jobs in
+// the manifests of the directory at path.
+func ReadCronJobs(path string) ([]*CronJob, error) {
+	files := []string{path}
+	entries, err := ioutil.ReadDir(path)
+	if path == builtSource && builtSource != "" {
+		files = builtWorkloads
+	} else if err == nil {
+		files = nil
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	var cronJobs []*CronJob
+	names := map[string]string{}
+	for _, file := range files {
+		obj, data, err := readManifest(file)
+		if err != nil {
+			return nil, err
+		}
+
+		cronJob, ok := obj.(*batchv1beta1.CronJob)
+		if !ok {
+			if len(files) == 1 && file == path {
+				return nil, fmt.Errorf("%s does not hold a CronJob but a %s", file, obj.GetObjectKind().GroupVersionKind().Kind)
+			}
+			continue
+		}
+
+		if other, ok := names[cronJob.Name]; ok {
+			return nil, fmt.Errorf("Cron job %s is defined in both %s and %s", cronJob.Name, other, file)
+		}
+		names[cronJob.Name] = file
+
+		cronJobs = append(cronJobs, cronJobFromManifest(cronJob, data))
+	}
+
+	if len(cronJobs) == 0 {
+		return nil, fmt.Errorf("No CronJob found in %s", path)
+	}
+
+	return cronJobs, nil
+}
+
+// cronJobFromManifest adds the fields of the manifest missing from the
+// vendored CronJob type.
+func cronJobFromManifest(cronJob *batchv1beta1.CronJob, data []byte) *CronJob {
+	var extra struct {
+		Spec struct {
+			TimeZone    string `json:"timeZone"`
+			JobTemplate struct {
+				Spec struct {
+					TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished"`
+				} `json:"spec"`
+			} `json:"jobTemplate"`
+		} `json:"spec"`
+	}
+	yaml.Unmarshal(data, &extra)
+
+	return &CronJob{
+		CronJob:                    cronJob,
+		TimeZone:                   extra.Spec.TimeZone,
+		JobTTLSecondsAfterFinished: extra.Spec.JobTemplate.Spec.TTLSecondsAfterFinished,
+	}
+}
+
+// Run schedules the cron jobs until ctx is done. The jobs of every schedule
+// are run like 'acictl create -f job.yaml' does, following the
+// concurrencyPolicy of the cron job. A missed schedule is run late unless
+// startingDeadlineSeconds have passed since. Finished jobs beyond the history
+// limits, or whose ttlSecondsAfterFinished has passed, are deleted.
+//
+// The scheduler resumes the unfinished jobs it finds, and only runs the
+// schedules missed since the latest job it started, so it can be restarted.
+func (s *CronScheduler) Run(ctx context.Context, cronJobs []*CronJob) error {
+	if s.Clock == nil {
+		s.Clock = RealClock
+	}
+	s.runs = map[string]*cronRun{}
+	s.done = make(chan string, 1)
+
+	states := make([]*cronState, 0, len(cronJobs))
+	for _, cronJob := range cronJobs {
+		state, err := newCronState(cronJob)
+		if err != nil {
+			return err
+		}
+		states = append(states, state)
+	}
+
+	now := s.Clock.Now()
+	for _, state := range states {
+		history, err := s.history(ctx, state.cronJob.Name)
+		if err != nil {
+			return err
+		}
+
+		state.last = now
+		if len(history) > 0 {
+			state.last = history[0].scheduled
+		}
+
+		for _, run := range history {
+			if run.condition == "" {
+				s.start(ctx, state, run.jobName, run.scheduled)
+			}
+		}
+
+		fmt.Printf("Cron job %s: schedule %q, next run at %s.\n", state.cronJob.Name, state.cronJob.Spec.Schedule, state.schedule.Next(now).Format(time.RFC3339))
+	}
+
+	for {
+		now := s.Clock.Now()
+		next := now.Add(cronResyncInterval)
+		for _, state := range states {
+			if err := s.sync(ctx, state, now); err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				fmt.Printf("Cron job %s: %s\n", state.cronJob.Name, err)
+			}
+
+			if at := state.schedule.Next(now); !at.IsZero() && at.Before(next) {
+				next = at
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.stopRuns(func(*cronRun) bool { return true })
+			return fmt.Errorf("Cron scheduler stopped (%s), the unfinished jobs resume when it runs again", ctx.Err())
+		case <-s.Clock.After(next.Sub(now)):
+		case <-s.done:
+		}
+	}
+}
+
+// newCronState validates the cron job and parses its schedule.
+func newCronState(cronJob *CronJob) (*cronState, error) {
+	switch cronJob.Spec.ConcurrencyPolicy {
+	case "", batchv1beta1.AllowConcurrent, batchv1beta1.ForbidConcurrent, batchv1beta1.ReplaceConcurrent:
+	default:
+		return nil, fmt.Errorf("Cron job %s has an unknown concurrency policy %q, must be Allow, Forbid or Replace", cronJob.Name, cronJob.Spec.ConcurrencyPolicy)
+	}
+
+	if policy := cronJob.Spec.JobTemplate.Spec.Template.Spec.RestartPolicy; policy != v1.RestartPolicyNever && policy != v1.RestartPolicyOnFailure {
+		return nil, fmt.Errorf("Cron job %s must have the restart policy Never or OnFailure, got %q", cronJob.Name, policy)
+	}
+
+	location := time.Local
+	if cronJob.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(cronJob.TimeZone); err != nil {
+			return nil, fmt.Errorf("Cron job %s has an unknown time zone %q: %v", cronJob.Name, cronJob.TimeZone, err)
+		}
+	}
+
+	schedule, err := ParseSchedule(cronJob.Spec.Schedule, location)
+	if err != nil {
+		return nil, fmt.Errorf("Cron job %s: %v", cronJob.Name, err)
+	}
+
+	return &cronState{cronJob: cronJob, schedule: schedule}, nil
+}
+
+// sync starts the job of the latest schedule of the cron job missed since it
+// was last scheduled, and prunes its history.
+func (s *CronScheduler) sync(ctx context.Context, state *cronState, now time.Time) error {
+	cronJob := state.cronJob
+
+	var scheduled time.Time
+	missed := 0
+	for t := state.schedule.Next(state.last); !t.IsZero() && !t.After(now); t = state.schedule.Next(t) {
+		scheduled = t
+		missed++
+	}
+
+	if !scheduled.IsZero() {
+		state.last = scheduled
+
+		switch {
+		case cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend:
+			fmt.Printf("Cron job %s: suspended, not running the schedule of %s.\n", cronJob.Name, scheduled.Format(time.RFC3339))
+		case cronJob.Spec.StartingDeadlineSeconds != nil && now.Sub(scheduled) > time.Duration(*cronJob.Spec.StartingDeadlineSeconds)*time.Second:
+			fmt.Printf("Cron job %s: missed the starting deadline of the schedule of %s.\n", cronJob.Name, scheduled.Format(time.RFC3339))
+		default:
+			if missed > maxMissedSchedules {
+				fmt.Printf("Cron job %s: %d start times were missed, only the latest one runs. Check the clock or set startingDeadlineSeconds.\n", cronJob.Name, missed)
+			}
+			if err := s.trigger(ctx, state, scheduled); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.prune(ctx, state, now)
+}
+
+// trigger starts the job of the schedule, following the concurrency policy.
+func (s *CronScheduler) trigger(ctx context.Context, state *cronState, scheduled time.Time) error {
+	cronJob := state.cronJob
+	active := s.activeRuns(cronJob.Name)
+
+	switch cronJob.Spec.ConcurrencyPolicy {
+	case batchv1beta1.ForbidConcurrent:
+		if len(active) > 0 {
+			fmt.Printf("Cron job %s: %s is still running, skipping the schedule of %s.\n", cronJob.Name, strings.Join(active, ", "), scheduled.Format(time.RFC3339))
+			return nil
+		}
+	case batchv1beta1.ReplaceConcurrent:
+		if len(active) > 0 {
+			fmt.Printf("Cron job %s: replacing %s.\n", cronJob.Name, strings.Join(active, ", "))
+			s.stopRuns(func(run *cronRun) bool { return run.cronJob == cronJob.Name })
+			for _, jobName := range active {
+				if err := DeleteJob(ctx, s.Client, jobName, s.ResourceGroup, false); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	s.start(ctx, state, fmt.Sprintf("%s-%d", cronJob.Name, scheduled.Unix()/60), scheduled)
+	return nil
+}
+
+// start runs the job in the background, or resumes it.
+func (s *CronScheduler) start(ctx context.Context, state *cronState, jobName string, scheduled time.Time) {
+	cronJob := state.cronJob
+	job := &Job{
+		Job: &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: jobName},
+			Spec:       cronJob.Spec.JobTemplate.Spec,
+		},
+		TTLSecondsAfterFinished: cronJob.JobTTLSecondsAfterFinished,
+		Tags: map[string]string{
+			CronJobTag:           cronJob.Name,
+			CronScheduledTimeTag: scheduled.UTC().Format(time.RFC3339),
+		},
+		Clock: s.Clock,
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	run := &cronRun{cronJob: cronJob.Name, cancel: cancel, finished: make(chan struct{})}
+
+	s.mu.Lock()
+	s.runs[jobName] = run
+	s.mu.Unlock()
+
+	fmt.Printf("Cron job %s: running job %s for the schedule of %s.\n", cronJob.Name, jobName, scheduled.Format(time.RFC3339))
+	go func() {
+		defer close(run.finished)
+		defer cancel()
+
+		if err := RunJob(runCtx, s.Client, job, s.ResourceGroup, s.Region); err != nil && runCtx.Err() == nil {
+			fmt.Printf("Cron job %s: %s\n", cronJob.Name, err)
+		}
+
+		s.mu.Lock()
+		delete(s.runs, jobName)
+		s.mu.Unlock()
+
+		// Wake up the scheduler to prune the history, unless it is already
+		// woken up.
+		select {
+		case s.done <- jobName:
+		default:
+		}
+	}()
+}
+
+// activeRuns returns the names of the running jobs of the cron job.
+func (s *CronScheduler) activeRuns(cronJobName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for jobName, run := range s.runs {
+		if run.cronJob == cronJobName {
+			names = append(names, jobName)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// stopRuns interrupts the running jobs selected by match, and waits for them
+// to return. Their container groups are left as they are.
+func (s *CronScheduler) stopRuns(match func(*cronRun) bool) {
+	s.mu.Lock()
+	var stopped []*cronRun
+	for _, run := range s.runs {
+		if match(run) {
+			run.cancel()
+			stopped = append(stopped, run)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, run := range stopped {
+		<-run.finished
+	}
+}
+
+// prune deletes the finished jobs of the cron job whose
+// ttlSecondsAfterFinished has passed at now, then the oldest ones beyond its
+// history limits. Finished jobs are no longer running, so their deletion does
+// not hold up the next schedules.
+func (s *CronScheduler) prune(ctx context.Context, state *cronState, now time.Time) error {
+	history, err := s.history(ctx, state.cronJob.Name)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]int32{
+		JobComplete: int32Value(state.cronJob.Spec.SuccessfulJobsHistoryLimit, defaultSuccessfulJobsHistoryLimit),
+		JobFailed:   int32Value(state.cronJob.Spec.FailedJobsHistoryLimit, defaultFailedJobsHistoryLimit),
+	}
+
+	for _, run := range history {
+		if run.condition == "" {
+			continue
+		}
+
+		if !run.ttlDeadline.IsZero() && !now.Before(run.ttlDeadline) {
+			fmt.Printf("Cron job %s: deleting job %s, its ttlSecondsAfterFinished has passed.\n", state.cronJob.Name, run.jobName)
+			if err := DeleteJob(ctx, s.Client, run.jobName, s.ResourceGroup, false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if keep[run.condition] > 0 {
+			keep[run.condition]--
+			continue
+		}
+
+		fmt.Printf("Cron job %s: deleting job %s beyond the history limit.\n", state.cronJob.Name, run.jobName)
+		if err := DeleteJob(ctx, s.Client, run.jobName, s.ResourceGroup, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// history returns the jobs of the cron job recorded in the tags of their
+// container groups, the latest first.
+func (s *CronScheduler) history(ctx context.Context, cronJobName string) ([]cronJobRun, error) {
+	cgList, err := s.Client.ListContainerGroups(ctx, s.ResourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("Container group list error: %w", err)
+	}
+
+	runs := map[string]*cronJobRun{}
+	for _, cg := range cgList.Value {
+		jobName, ok := cg.Tags[JobTag]
+		if !ok || cg.Tags[CronJobTag] != cronJobName {
+			continue
+		}
+
+		run, ok := runs[jobName]
+		if !ok {
+			scheduled, err := time.Parse(time.RFC3339, cg.Tags[CronScheduledTimeTag])
+			if err != nil {
+				continue
+			}
+			run = &cronJobRun{jobName: jobName, scheduled: scheduled}
+			runs[jobName] = run
+		}
+
+		if condition := cg.Tags[JobConditionTag]; condition != "" {
+			run.condition = condition
+		}
+		if deadline, err := time.Parse(time.RFC3339, cg.Tags[JobTTLDeadlineTag]); err == nil {
+			run.ttlDeadline = deadline
+		}
+	}
+
+	history := make([]cronJobRun, 0, len(runs))
+	for _, run := range runs {
+		history = append(history, *run)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].scheduled.After(history[j].scheduled) })
+
+	return history, nil
+}
+
+// DeleteCronJob deletes the container groups of every job of the cron job.
+func DeleteCronJob(ctx context.Context, aciClient aci.ContainerGroupClient, cronJobName string, resourceGroup string, wait bool) error {
+	return deleteTagged(ctx, aciClient, resourceGroup, CronJobTag, cronJobName, wait)
+}
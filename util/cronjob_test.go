@@ -0,0 +1,358 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// fakeClock is a Clock whose time only moves when set. Its timers fire right
+// away, so that the jobs it times poll without waiting.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return time.After(time.Millisecond)
+}
+
+func (c *fakeClock) set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// cronJobManifest returns a batch/v1beta1 CronJob running every 5 minutes in
+// UTC, with the fields of spec added to its spec and those of jobSpec to the
+// spec of its job template.
+func cronJobManifest(spec string, jobSpec string) string {
+	return fmt.Sprintf(`apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  schedule: "*/5 * * * *"
+  timeZone: UTC
+%s  jobTemplate:
+    spec:
+%s      template:
+        spec:
+          restartPolicy: Never
+          containers:
+          - name: worker
+            image: worker
+`, spec, jobSpec)
+}
+
+// at returns the time of the 2001-01-01 UTC at hour:minute.
+func at(hour, minute int) time.Time {
+	return time.Date(2001, 1, 1, hour, minute, 0, 0, time.UTC)
+}
+
+// newTestScheduler returns a scheduler of the cron job of the manifest, last
+// scheduled at last, on a fake client and clock.
+func newTestScheduler(t *testing.T, manifest string, last time.Time) (*CronScheduler, *cronState, *fake.Client, *fakeClock) {
+	t.Helper()
+	fastPolling(t)
+
+	cronJobs, err := ReadCronJobs(writeManifest(t, manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := newCronState(cronJobs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.last = last
+
+	aciClient := fake.NewClient()
+	clock := &fakeClock{now: last}
+	s := &CronScheduler{
+		Client:        aciClient,
+		ResourceGroup: testResourceGroup,
+		Region:        "westus",
+		Clock:         clock,
+		runs:          map[string]*cronRun{},
+		done:          make(chan string, 1),
+	}
+	t.Cleanup(func() {
+		s.stopRuns(func(*cronRun) bool { return true })
+	})
+
+	return s, state, aciClient, clock
+}
+
+// syncAt runs a sync of the scheduler at now.
+func syncAt(t *testing.T, s *CronScheduler, state *cronState, clock *fakeClock, now time.Time) {
+	t.Helper()
+
+	clock.set(now)
+	if err := s.sync(context.Background(), state, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitRuns waits for the running jobs of the scheduler to finish.
+func waitRuns(s *CronScheduler) {
+	s.mu.Lock()
+	var runs []*cronRun
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+
+	for _, run := range runs {
+		<-run.finished
+	}
+}
+
+// waitGroups waits for the job to have created its container groups.
+func waitGroups(t *testing.T, s *CronScheduler, jobName string) {
+	t.Helper()
+
+	for i := 0; i < 1000; i++ {
+		for _, cg := range listGroups(t, s.Client) {
+			if cg.Tags[JobTag] == jobName {
+				return
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("Job %s created no container group", jobName)
+}
+
+// scheduledJobs returns the scheduled times of the jobs with container
+// groups, sorted.
+func scheduledJobs(t *testing.T, s *CronScheduler) []string {
+	t.Helper()
+
+	seen := map[string]bool{}
+	var scheduled []string
+	for _, cg := range listGroups(t, s.Client) {
+		if value := cg.Tags[CronScheduledTimeTag]; !seen[value] {
+			seen[value] = true
+			scheduled = append(scheduled, value)
+		}
+	}
+	sort.Strings(scheduled)
+
+	return scheduled
+}
+
+func TestCronSchedule(t *testing.T) {
+	tests := []struct {
+		name          string
+		spec          string
+		now           time.Time
+		wantScheduled []string
+	}{
+		{
+			name: "not due",
+			now:  at(10, 4),
+		},
+		{
+			name:          "on schedule",
+			now:           at(10, 5),
+			wantScheduled: []string{"2001-01-01T10:05:00Z"},
+		},
+		{
+			name:          "missed schedules run the latest",
+			now:           at(10, 32),
+			wantScheduled: []string{"2001-01-01T10:30:00Z"},
+		},
+		{
+			name:          "within the starting deadline",
+			spec:          "  startingDeadlineSeconds: 300\n",
+			now:           at(10, 32),
+			wantScheduled: []string{"2001-01-01T10:30:00Z"},
+		},
+		{
+			name: "past the starting deadline",
+			spec: "  startingDeadlineSeconds: 60\n",
+			now:  at(10, 32),
+		},
+		{
+			name: "suspended",
+			spec: "  suspend: true\n",
+			now:  at(10, 5),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, state, aciClient, clock := newTestScheduler(t, cronJobManifest(test.spec, ""), at(10, 0))
+			aciClient.RunSteps = 1
+
+			syncAt(t, s, state, clock, test.now)
+			waitRuns(s)
+
+			scheduled := scheduledJobs(t, s)
+			if fmt.Sprint(scheduled) != fmt.Sprint(test.wantScheduled) {
+				t.Errorf("Scheduler ran the jobs scheduled at %v, want %v", scheduled, test.wantScheduled)
+			}
+		})
+	}
+}
+
+func TestCronConcurrencyPolicy(t *testing.T) {
+	tests := []struct {
+		policy        string
+		wantActive    int
+		wantScheduled []string
+	}{
+		{policy: "Allow", wantActive: 2, wantScheduled: []string{"2001-01-01T10:05:00Z", "2001-01-01T10:10:00Z"}},
+		{policy: "Forbid", wantActive: 1, wantScheduled: []string{"2001-01-01T10:05:00Z"}},
+		{policy: "Replace", wantActive: 1, wantScheduled: []string{"2001-01-01T10:10:00Z"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			// The containers run until stopped, so the first job is still
+			// running on the next schedule.
+			s, state, _, clock := newTestScheduler(t, cronJobManifest("  concurrencyPolicy: "+test.policy+"\n", ""), at(10, 0))
+
+			syncAt(t, s, state, clock, at(10, 5))
+			active := s.activeRuns("report")
+			if len(active) != 1 {
+				t.Fatalf("Scheduler runs %v, want one job", active)
+			}
+			waitGroups(t, s, active[0])
+
+			syncAt(t, s, state, clock, at(10, 10))
+			if active := s.activeRuns("report"); len(active) != test.wantActive {
+				t.Errorf("Scheduler runs %v, want %d jobs", active, test.wantActive)
+			}
+
+			if test.policy != "Forbid" {
+				waitGroups(t, s, fmt.Sprintf("report-%d", at(10, 10).Unix()/60))
+			}
+			if scheduled := scheduledJobs(t, s); fmt.Sprint(scheduled) != fmt.Sprint(test.wantScheduled) {
+				t.Errorf("Scheduler left the jobs scheduled at %v, want %v", scheduled, test.wantScheduled)
+			}
+		})
+	}
+}
+
+func TestCronPrune(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		jobs     []string
+		wantJobs []string
+	}{
+		{
+			name:     "default history limits",
+			jobs:     []string{"1 Complete", "2 Complete", "3 Complete", "4 Complete", "5 Failed", "6 Failed", "7"},
+			wantJobs: []string{"2 Complete", "3 Complete", "4 Complete", "6 Failed", "7"},
+		},
+		{
+			name:     "history limits",
+			spec:     "  successfulJobsHistoryLimit: 1\n  failedJobsHistoryLimit: 0\n",
+			jobs:     []string{"1 Complete", "2 Complete", "3 Failed"},
+			wantJobs: []string{"2 Complete"},
+		},
+		{
+			name:     "ttl",
+			jobs:     []string{"1 Complete expired", "2 Failed expired", "3 Complete", "4 Complete expired"},
+			wantJobs: []string{"3 Complete"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now := at(11, 0)
+			s, state, aciClient, _ := newTestScheduler(t, cronJobManifest(test.spec, ""), now)
+			aciClient.ProvisioningSteps = 0
+
+			// A job is "minute [condition] [expired]", scheduled at 10:minute.
+			for _, job := range test.jobs {
+				var minute int
+				var condition, expired string
+				fmt.Sscan(job, &minute, &condition, &expired)
+
+				jobName := fmt.Sprintf("report-%d", minute)
+				tags := map[string]string{
+					JobTag:               jobName,
+					CronJobTag:           "report",
+					CronScheduledTimeTag: at(10, minute).Format(time.RFC3339),
+					JobConditionTag:      condition,
+				}
+				if expired != "" {
+					tags[JobTTLDeadlineTag] = now.Format(time.RFC3339)
+				} else if condition != "" {
+					tags[JobTTLDeadlineTag] = now.Add(time.Minute).Format(time.RFC3339)
+				}
+
+				cg := client.ContainerGroup{Name: jobName, Tags: tags}
+				if _, err := aciClient.CreateContainerGroup(context.Background(), testResourceGroup, jobName, cg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := s.prune(context.Background(), state, now); err != nil {
+				t.Fatal(err)
+			}
+
+			var jobs []string
+			for _, cg := range listGroups(t, aciClient) {
+				var minute int
+				fmt.Sscanf(cg.Tags[CronScheduledTimeTag], "2001-01-01T10:%02d", &minute)
+				jobs = append(jobs, fmt.Sprintf("%d %s", minute, cg.Tags[JobConditionTag]))
+			}
+			sort.Strings(jobs)
+
+			var want []string
+			for _, job := range test.wantJobs {
+				var minute int
+				var condition string
+				fmt.Sscan(job, &minute, &condition)
+				want = append(want, fmt.Sprintf("%d %s", minute, condition))
+			}
+
+			if fmt.Sprint(jobs) != fmt.Sprint(want) {
+				t.Errorf("Pruning left the jobs %q, want %q", jobs, want)
+			}
+		})
+	}
+}
+
+func TestCronJobTTL(t *testing.T) {
+	s, state, aciClient, clock := newTestScheduler(t, cronJobManifest("", "      ttlSecondsAfterFinished: 600\n"), at(10, 0))
+	aciClient.RunSteps = 1
+
+	// The finished job leaves the active runs right away, the next schedule
+	// is not skipped while it waits for its TTL.
+	syncAt(t, s, state, clock, at(10, 5))
+	waitRuns(s)
+	if active := s.activeRuns("report"); len(active) != 0 {
+		t.Fatalf("Scheduler still runs %v after the job finished", active)
+	}
+
+	syncAt(t, s, state, clock, at(10, 10))
+	waitRuns(s)
+	if scheduled := scheduledJobs(t, s); len(scheduled) != 2 {
+		t.Fatalf("Scheduler ran the jobs scheduled at %v, want 2 jobs", scheduled)
+	}
+
+	// The TTL of the first job passes at 10:15, the second one at 10:20.
+	syncAt(t, s, state, clock, at(10, 16))
+	waitRuns(s)
+	want := []string{"2001-01-01T10:10:00Z", "2001-01-01T10:15:00Z"}
+	if scheduled := scheduledJobs(t, s); fmt.Sprint(scheduled) != fmt.Sprint(want) {
+		t.Errorf("Scheduler left the jobs scheduled at %v, want %v", scheduled, want)
+	}
+}
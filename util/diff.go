@@ -0,0 +1,466 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// States of a replica in a diff.
+const (
+	DiffInSync  = "InSync"
+	DiffDrifted = "Drifted"
+	// DiffMissing is a replica the deployment lacks, DiffExtra a replica
+	// beyond the replica count of the manifest.
+	DiffMissing = "Missing"
+	DiffExtra   = "Extra"
+)
+
+// diffContext is the number of unchanged lines around the changes of a
+// unified diff.
+const diffContext = 3
+
+// DeploymentDiff compares the container groups a manifest translates to with
+// the live replicas of the deployment.
+type DeploymentDiff struct {
+	Name          string        `json:"name"`
+	Replicas      int           `json:"replicas"`
+	LiveReplicas  int           `json:"liveReplicas"`
+	Drifted       bool          `json:"drifted"`
+	ReplicaDiffs  []ReplicaDiff `json:"replicaDiffs"`
+	manifestLines []string
+}
+
+// ReplicaDiff is the difference between the manifest and a live replica. The
+// changes are keyed by the path of the field in the container group, without
+// the ARM properties levels.
+type ReplicaDiff struct {
+	Name    string        `json:"name,omitempty"`
+	Status  string        `json:"status"`
+	Changes []FieldChange `json:"changes,omitempty"`
+	live    string
+}
+
+// FieldChange is a field whose live value differs from the manifest.
+type FieldChange struct {
+	Path     string      `json:"path"`
+	Manifest interface{} `json:"manifest,omitempty"`
+	Live     interface{} `json:"live,omitempty"`
+}
+
+// Diff compares the container group the deployment file translates to with
+// every live replica of the deployment, ignoring the fields Azure populates
+// such as the instance view, the provisioning state and the IP address. The
+// deployment drifted when a replica differs, is missing or is extra.
+func Diff(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentFile string, resourceGroup string, region string) (*DeploymentDiff, error) {
+	deployment, err := GetDeploymentFromFile(deploymentFile)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := ContainerGroupFromDeployment(deployment, region)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := diffValue(template)
+	if err != nil {
+		return nil, err
+	}
+	expected := diffFields(value)
+	manifest, err := diffDocument(value)
+	if err != nil {
+		return nil, err
+	}
+
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deployment.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &DeploymentDiff{
+		Name:          deployment.Name,
+		Replicas:      int(getReplicas(deployment)),
+		manifestLines: splitLines(manifest),
+	}
+
+	for _, cg := range owned {
+		live, err, status := aciClient.GetContainerGroup(ctx, resourceGroup, cg.Name)
+		if status != nil && *status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := diffValue(live)
+		if err != nil {
+			return nil, err
+		}
+		actual := diffFields(value)
+		document, err := diffDocument(value)
+		if err != nil {
+			return nil, err
+		}
+
+		replica := ReplicaDiff{Name: cg.Name, Status: DiffInSync, Changes: compareFields(expected, actual), live: document}
+		if len(replica.Changes) > 0 {
+			replica.Status = DiffDrifted
+		}
+		if diff.LiveReplicas >= diff.Replicas {
+			replica.Status = DiffExtra
+		}
+		diff.LiveReplicas++
+
+		diff.ReplicaDiffs = append(diff.ReplicaDiffs, replica)
+	}
+
+	for i := diff.LiveReplicas; i < diff.Replicas; i++ {
+		diff.ReplicaDiffs = append(diff.ReplicaDiffs, ReplicaDiff{Status: DiffMissing})
+	}
+
+	for _, replica := range diff.ReplicaDiffs {
+		if replica.Status != DiffInSync {
+			diff.Drifted = true
+		}
+	}
+
+	return diff, nil
+}
+
+// PrintDiff prints a unified diff of the manifest and every live replica that
+// differs from it, followed by a summary.
+func PrintDiff(w io.Writer, diff *DeploymentDiff) {
+	counts := map[string]int{}
+	for _, replica := range diff.ReplicaDiffs {
+		counts[replica.Status]++
+
+		switch replica.Status {
+		case DiffMissing:
+			continue
+		case DiffExtra:
+			fmt.Fprintf(w, "Replica %s is beyond the %d replicas of the manifest.\n", replica.Name, diff.Replicas)
+			if len(replica.Changes) == 0 {
+				continue
+			}
+		case DiffInSync:
+			continue
+		}
+
+		fmt.Fprintf(w, "--- %s (manifest)\n", diff.Name)
+		fmt.Fprintf(w, "+++ %s (live)\n", replica.Name)
+		for _, line := range unifiedDiff(diff.manifestLines, splitLines(replica.live), diffContext) {
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	if counts[DiffMissing] > 0 {
+		fmt.Fprintf(w, "Deployment %s is missing %d of its %d replicas.\n", diff.Name, counts[DiffMissing], diff.Replicas)
+	}
+
+	if !diff.Drifted {
+		fmt.Fprintf(w, "Deployment %s matches the manifest, %d replicas in sync.\n", diff.Name, counts[DiffInSync])
+		return
+	}
+
+	fmt.Fprintf(w, "Deployment %s drifted from the manifest: %d in sync, %d drifted, %d missing, %d extra.\n",
+		diff.Name, counts[DiffInSync], counts[DiffDrifted], counts[DiffMissing], counts[DiffExtra])
+}
+
+// normalizeForDiff returns the template of the container group with the
+// values Azure may spell differently from the request filled or normalized,
+// and the secrets Azure never returns cleared.
+func normalizeForDiff(cg *client.ContainerGroup) *client.ContainerGroup {
+	template := templateFromContainerGroup(cg)
+	template.Type = ""
+	template.Location = strings.ToLower(strings.Replace(template.Location, " ", "", -1))
+
+	if template.RestartPolicy == "" {
+		template.RestartPolicy = client.Always
+	}
+
+	credentials := make([]client.ImageRegistryCredential, len(template.ImageRegistryCredentials))
+	for i, credential := range template.ImageRegistryCredentials {
+		credential.Password = ""
+		credentials[i] = credential
+	}
+	template.ImageRegistryCredentials = credentials
+
+	// Like registry passwords, the content of secret volumes is not read
+	// back, only their files are compared.
+	volumes := make([]client.Volume, len(template.Volumes))
+	for i, volume := range template.Volumes {
+		if volume.Secret != nil {
+			files := make(map[string]string, len(volume.Secret))
+			for file := range volume.Secret {
+				files[file] = ""
+			}
+			volume.Secret = files
+		}
+		volumes[i] = volume
+	}
+	template.Volumes = volumes
+
+	for i, container := range template.Containers {
+		ports := make([]client.ContainerPort, len(container.Ports))
+		for j, port := range container.Ports {
+			port.Protocol = client.ContainerNetworkProtocol(strings.ToUpper(string(port.Protocol)))
+			if port.Protocol == "" {
+				port.Protocol = client.ContainerNetworkProtocolTCP
+			}
+			ports[j] = port
+		}
+		template.Containers[i].Ports = ports
+	}
+
+	if template.IPAddress != nil {
+		ipAddress := *template.IPAddress
+		if strings.EqualFold(ipAddress.Type, "Public") {
+			ipAddress.Type = "Public"
+		}
+
+		ports := make([]client.Port, len(ipAddress.Ports))
+		for i, port := range ipAddress.Ports {
+			port.Protocol = client.ContainerGroupNetworkProtocol(strings.ToUpper(string(port.Protocol)))
+			if port.Protocol == "" {
+				port.Protocol = client.TCP
+			}
+			ports[i] = port
+		}
+		sort.Slice(ports, func(i, j int) bool { return ports[i].Port < ports[j].Port })
+		ipAddress.Ports = ports
+		template.IPAddress = &ipAddress
+	}
+
+	return template
+}
+
+// diffValue returns the normalized container group as a generic JSON value.
+// The instance views are dropped, their types marshal to zero values rather
+// than being omitted.
+func diffValue(cg *client.ContainerGroup) (interface{}, error) {
+	data, err := json.Marshal(normalizeForDiff(cg))
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	dropInstanceViews(value)
+
+	return value, nil
+}
+
+func dropInstanceViews(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		delete(value, "instanceView")
+		for _, child := range value {
+			dropInstanceViews(child)
+		}
+	case []interface{}:
+		for _, child := range value {
+			dropInstanceViews(child)
+		}
+	}
+}
+
+// diffDocument returns the normalized container group as YAML.
+func diffDocument(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// diffFields returns the leaf values of the normalized container group keyed
+// by their path.
+func diffFields(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	flattenFields(value, "", fields)
+
+	return fields
+}
+
+// flattenFields adds the leaves of the JSON value to fields, skipping the
+// properties objects of the ARM resources.
+func flattenFields(value interface{}, path string, fields map[string]interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			childPath := path
+			if key != "properties" {
+				childPath = joinFieldPath(path, key)
+			}
+			flattenFields(child, childPath, fields)
+		}
+	case []interface{}:
+		for i, child := range value {
+			flattenFields(child, fmt.Sprintf("%s[%d]", path, i), fields)
+		}
+	default:
+		fields[path] = value
+	}
+}
+
+func joinFieldPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// compareFields returns the fields that differ, sorted by path.
+func compareFields(expected, actual map[string]interface{}) []FieldChange {
+	paths := map[string]bool{}
+	for path := range expected {
+		paths[path] = true
+	}
+	for path := range actual {
+		paths[path] = true
+	}
+
+	var changes []FieldChange
+	for path := range paths {
+		if !reflect.DeepEqual(expected[path], actual[path]) {
+			changes = append(changes, FieldChange{Path: path, Manifest: expected[path], Live: actual[path]})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffOp is a line of an edit script: ' ' keeps the line, '-' removes it from
+// a and '+' adds it from b. aIndex and bIndex are the positions in a and b
+// the line is at.
+type diffOp struct {
+	op             byte
+	text           string
+	aIndex, bIndex int
+}
+
+// editScript returns the shortest edit script turning a into b, from their
+// longest common subsequence.
+func editScript(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	return ops
+}
+
+// unifiedDiff returns the hunks of the unified diff of a and b, with context
+// unchanged lines around the changes.
+func unifiedDiff(a, b []string, context int) []string {
+	ops := editScript(a, b)
+
+	var lines []string
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			i++
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Changes separated by up to twice the context share a hunk.
+		end := i
+		for end < len(ops) {
+			if ops[end].op != ' ' {
+				end++
+				continue
+			}
+
+			run := 0
+			for end+run < len(ops) && ops[end+run].op == ' ' {
+				run++
+			}
+			if end+run == len(ops) || run > 2*context {
+				end += minInt(run, context)
+				break
+			}
+			end += run
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.op != '+' {
+				aCount++
+			}
+			if op.op != '-' {
+				bCount++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@", hunkRange(ops[start].aIndex, aCount), hunkRange(ops[start].bIndex, bCount)))
+		for _, op := range ops[start:end] {
+			lines = append(lines, string(op.op)+op.text)
+		}
+
+		i = end
+	}
+
+	return lines
+}
+
+// hunkRange formats the start line and the line count of a hunk, an empty
+// range starts at the line before it.
+func hunkRange(index, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", index)
+	}
+
+	return fmt.Sprintf("%d,%d", index+1, count)
+}
@@ -0,0 +1,197 @@
+package util
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// numberedLines returns the lines "1" to "n", with the lines of changes
+// replaced.
+func numberedLines(n int, changes map[int]string) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = strconv.Itoa(i + 1)
+		if text, ok := changes[i+1]; ok {
+			lines[i] = text
+		}
+	}
+
+	return lines
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    []string
+		context int
+		want    []string
+	}{
+		{
+			name:    "identical",
+			a:       numberedLines(5, nil),
+			b:       numberedLines(5, nil),
+			context: 3,
+		},
+		{
+			name:    "change in the middle",
+			a:       numberedLines(10, nil),
+			b:       numberedLines(10, map[int]string{5: "five"}),
+			context: 3,
+			want:    []string{"@@ -2,7 +2,7 @@", " 2", " 3", " 4", "-5", "+five", " 6", " 7", " 8"},
+		},
+		{
+			name:    "change of the first line",
+			a:       numberedLines(10, nil),
+			b:       numberedLines(10, map[int]string{1: "one"}),
+			context: 3,
+			want:    []string{"@@ -1,4 +1,4 @@", "-1", "+one", " 2", " 3", " 4"},
+		},
+		{
+			name:    "changes within twice the context share a hunk",
+			a:       numberedLines(20, nil),
+			b:       numberedLines(20, map[int]string{5: "five", 11: "eleven"}),
+			context: 3,
+			want: []string{"@@ -2,13 +2,13 @@", " 2", " 3", " 4", "-5", "+five", " 6", " 7", " 8", " 9", " 10",
+				"-11", "+eleven", " 12", " 13", " 14"},
+		},
+		{
+			name:    "distant changes have their own hunks",
+			a:       numberedLines(20, nil),
+			b:       numberedLines(20, map[int]string{3: "three", 15: "fifteen"}),
+			context: 3,
+			want: []string{"@@ -1,6 +1,6 @@", " 1", " 2", "-3", "+three", " 4", " 5", " 6",
+				"@@ -12,7 +12,7 @@", " 12", " 13", " 14", "-15", "+fifteen", " 16", " 17", " 18"},
+		},
+		{
+			name:    "added line",
+			a:       []string{"a", "b"},
+			b:       []string{"a", "x", "b"},
+			context: 3,
+			want:    []string{"@@ -1,2 +1,3 @@", " a", "+x", " b"},
+		},
+		{
+			name:    "removed last line without context",
+			a:       []string{"a", "b"},
+			b:       []string{"a"},
+			context: 0,
+			want:    []string{"@@ -2,1 +1,0 @@", "-b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := unifiedDiff(test.a, test.b, test.context)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("unifiedDiff() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// armClient returns the container groups with the fields ARM populates or
+// spells differently from the request.
+type armClient struct {
+	*fake.Client
+}
+
+func (c *armClient) GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*client.ContainerGroup, error, *int) {
+	cg, err, status := c.Client.GetContainerGroup(ctx, resourceGroup, containerGroupName)
+	if cg != nil {
+		cg.Location = "West US"
+		if cg.IPAddress != nil {
+			cg.IPAddress.IP = "20.42.0.1"
+			for i := range cg.IPAddress.Ports {
+				cg.IPAddress.Ports[i].Protocol = "tcp"
+			}
+		}
+	}
+
+	return cg, err, status
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		edit        func(t *testing.T, aciClient *fake.Client, cg *client.ContainerGroup)
+		wantStatus  string
+		wantChanges []FieldChange
+	}{
+		{
+			name:       "server populated fields",
+			wantStatus: DiffInSync,
+		},
+		{
+			name: "image changed in the portal",
+			edit: func(t *testing.T, aciClient *fake.Client, cg *client.ContainerGroup) {
+				cg.Containers[0].Image = "nginx:1.15"
+				if _, err := aciClient.UpdateContainerGroup(context.Background(), testResourceGroup, cg.Name, *cg); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus:  DiffDrifted,
+			wantChanges: []FieldChange{{Path: "containers[0].image", Manifest: "nginx", Live: "nginx:1.15"}},
+		},
+		{
+			name: "deleted replica",
+			edit: func(t *testing.T, aciClient *fake.Client, cg *client.ContainerGroup) {
+				if err := aciClient.DeleteContainerGroup(context.Background(), testResourceGroup, cg.Name); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: DiffMissing,
+		},
+	}
+
+	manifest := deploymentManifest("web", 2, "nginx") + `        ports:
+        - containerPort: 80
+`
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			aciClient := &armClient{fake.NewClient()}
+
+			file := writeManifest(t, manifest)
+			if err := Create(ctx, aciClient.Client, file, testResourceGroup, "westus", false); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.edit != nil {
+				live, err, _ := aciClient.GetContainerGroup(ctx, testResourceGroup, listGroups(t, aciClient)[0].Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				test.edit(t, aciClient.Client, live)
+			}
+
+			diff, err := Diff(ctx, aciClient, file, testResourceGroup, "westus")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff.Drifted != (test.wantStatus != DiffInSync) {
+				t.Errorf("Diff reports drifted %t, want %t", diff.Drifted, test.wantStatus != DiffInSync)
+			}
+
+			// The edited replica is first, or last once it is missing.
+			replica := diff.ReplicaDiffs[0]
+			if test.wantStatus == DiffMissing {
+				replica = diff.ReplicaDiffs[len(diff.ReplicaDiffs)-1]
+			}
+			if replica.Status != test.wantStatus {
+				t.Errorf("Replica is %s, want %s", replica.Status, test.wantStatus)
+			}
+			if !reflect.DeepEqual(replica.Changes, test.wantChanges) {
+				t.Errorf("Replica changes are %+v, want %+v", replica.Changes, test.wantChanges)
+			}
+			if other := diff.ReplicaDiffs[1]; test.wantStatus != DiffMissing && other.Status != DiffInSync {
+				t.Errorf("Unedited replica is %s with the changes %+v, want %s", other.Status, other.Changes, DiffInSync)
+			}
+		})
+	}
+}
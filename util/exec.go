@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+// Exec runs command in a container of the container group and bridges the
+// local stdin and stdout to it. With tty set and stdin being a terminal, the
+// local terminal is put in raw mode for the session, and its resizes are
+// passed on to the session.
+func Exec(ctx context.Context, aciClient aci.ContainerGroupClient, containerGroupName string, containerName string, resourceGroup string, command []string, stdin bool, tty bool) error {
+	if len(command) == 0 {
+		return fmt.Errorf("Must supply a command to execute")
+	}
+
+	if containerName == "" {
+		cg, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, containerGroupName)
+		if err != nil {
+			return err
+		}
+
+		if len(cg.Containers) != 1 {
+			names := make([]string, 0, len(cg.Containers))
+			for _, container := range cg.Containers {
+				names = append(names, container.Name)
+			}
+			return fmt.Errorf("Container group %s has %d containers, choose one of %s with the -c flag", containerGroupName, len(names), strings.Join(names, ", "))
+		}
+
+		containerName = cg.Containers[0].Name
+	}
+
+	execRequest := aci.ExecRequest{
+		Command: strings.Join(command, " "),
+	}
+
+	fd := int(os.Stdin.Fd())
+	raw := tty && stdin && isTerminal(fd)
+	if raw {
+		rows, cols, err := getTerminalSize(fd)
+		if err != nil {
+			return err
+		}
+		execRequest.TerminalSize = aci.TerminalSize{Rows: rows, Cols: cols}
+	}
+
+	session, err := aciClient.ExecuteCommand(ctx, resourceGroup, containerGroupName, containerName, execRequest)
+	if err != nil {
+		return fmt.Errorf("Execute command error: %w", err)
+	}
+
+	var in io.Reader
+	if stdin {
+		in = os.Stdin
+	}
+
+	var resize <-chan aci.TerminalSize
+	if raw {
+		state, err := makeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer restoreTerminal(fd, state)
+
+		var stop func()
+		resize, stop = notifyResize(fd)
+		defer stop()
+	}
+
+	return aci.Attach(ctx, session.WebSocketURI, session.Password, in, os.Stdout, resize)
+}
@@ -0,0 +1,76 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+func TestExec(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if _, password, err := conn.ReadMessage(); err != nil || string(password) != "secret" {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "bad password"))
+			return
+		}
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		group     string
+		container string
+		command   []string
+		wantErr   string
+	}{
+		{name: "only container", group: "single", command: []string{"ls"}},
+		{name: "named container", group: "sidecar", container: "web", command: []string{"ls", "-l"}},
+		{name: "no command", group: "single", wantErr: "Must supply a command"},
+		{name: "several containers", group: "sidecar", command: []string{"ls"}, wantErr: "choose one of web, proxy"},
+		{name: "unknown container", group: "single", container: "db", command: []string{"ls"}, wantErr: "ContainerNotFound"},
+		{name: "unknown group", group: "missing", command: []string{"ls"}, wantErr: "ResourceNotFound"},
+	}
+
+	ctx := context.Background()
+	aciClient := fake.NewClient()
+	aciClient.ProvisioningSteps = 0
+	aciClient.ExecURI = "ws" + strings.TrimPrefix(srv.URL, "http")
+	aciClient.ExecPassword = "secret"
+
+	groups := map[string][]string{"single": {"web"}, "sidecar": {"web", "proxy"}}
+	for name, containers := range groups {
+		cg := client.ContainerGroup{Name: name}
+		for _, container := range containers {
+			cg.Containers = append(cg.Containers, client.Container{Name: container})
+		}
+		if _, err := aciClient.CreateContainerGroup(ctx, "rg", name, cg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Exec(ctx, aciClient, test.group, test.container, "rg", test.command, false, false)
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Fatalf("Exec failed: %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Fatalf("Exec returned %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,551 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// Tags acictl sets on the container groups of a job. The status of a job is
+// kept in the tags of its container groups, so that it can be reported after
+// acictl exits.
+const (
+	JobTag            = "acictl-job"
+	JobCompletionsTag = "acictl-job-completions"
+	JobStartTimeTag   = "acictl-job-start-time"
+
+	// JobConditionTag records JobComplete or JobFailed once the job has
+	// finished, JobReasonTag why it failed and JobCompletionTimeTag when.
+	JobConditionTag      = "acictl-job-condition"
+	JobReasonTag         = "acictl-job-reason"
+	JobCompletionTimeTag = "acictl-job-completion-time"
+
+	// JobTTLDeadlineTag records when a finished job with
+	// ttlSecondsAfterFinished is to be deleted.
+	JobTTLDeadlineTag = "acictl-job-ttl-deadline"
+)
+
+// Conditions of a finished job.
+const (
+	JobComplete = "Complete"
+	JobFailed   = "Failed"
+)
+
+// States of the container groups of a job.
+const (
+	jobGroupActive    = "Active"
+	jobGroupSucceeded = "Succeeded"
+	jobGroupFailed    = "Failed"
+)
+
+var (
+	// JobBackoff is the delay before replacing a failed container group of a
+	// job, doubled for every further failure up to MaxJobBackoff, like the
+	// back-off of the Kubernetes job controller.
+	JobBackoff    = 10 * time.Second
+	MaxJobBackoff = 6 * time.Minute
+
+	// defaultBackoffLimit matches the Kubernetes default of backoffLimit.
+	defaultBackoffLimit int32 = 6
+
+	jobPollInterval = 5 * time.Second
+)
+
+// Job is a batch/v1 Job, with the ttlSecondsAfterFinished field that the
+// vendored API types predate.
+type Job struct {
+	*batchv1.Job
+	TTLSecondsAfterFinished *int32
+
+	// Tags are added to the tags of the container groups of the job.
+	Tags map[string]string
+
+	// Clock times the job, RealClock when nil.
+	Clock Clock
+}
+
+// JobStatus is the status of a job, computed from its container groups.
+type JobStatus struct {
+	Name string `json:"name"`
+	// Completions is the number of successful container groups the job
+	// needs, nil when the job completes once any of them succeeded.
+	Completions    *int32     `json:"completions,omitempty"`
+	Active         int32      `json:"active"`
+	Succeeded      int32      `json:"succeeded"`
+	Failed         int32      `json:"failed"`
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+	Condition      string     `json:"condition,omitempty"`
+	Reason         string     `json:"reason,omitempty"`
+}
+
+// jobGroup is a container group of a job and its state.
+type jobGroup struct {
+	cg    client.ContainerGroup
+	state string
+}
+
+// RunJob runs the job until it has finished, creating up to parallelism
+// container groups at a time until completions of them have succeeded. Failed
+// container groups count against backoffLimit, as do the restarts of
+// containers with the OnFailure restart policy, and are replaced after an
+// exponential back-off. A job that runs longer than activeDeadlineSeconds
+// fails. Running a job again after an interruption resumes it.
+func RunJob(ctx context.Context, aciClient aci.ContainerGroupClient, job *Job, resourceGroup string, region string) error {
+	spec := job.Spec
+	if policy := spec.Template.Spec.RestartPolicy; policy != v1.RestartPolicyNever && policy != v1.RestartPolicyOnFailure {
+		return fmt.Errorf("Job %s must have the restart policy Never or OnFailure, got %q", job.Name, policy)
+	}
+
+	parallelism := int32Value(spec.Parallelism, 1)
+	backoffLimit := int32Value(spec.BackoffLimit, defaultBackoffLimit)
+	if parallelism < 1 {
+		return fmt.Errorf("Job %s must have a parallelism of at least 1, got %d", job.Name, parallelism)
+	}
+
+	containerGroup, err := containerGroupFromPodSpec(job.Name, spec.Template.Spec, region)
+	if err != nil {
+		return err
+	}
+
+	templateHash, err := TemplateHash(containerGroup)
+	if err != nil {
+		return err
+	}
+
+	clock := job.clock()
+
+	groups, err := getJobGroups(ctx, aciClient, resourceGroup, job.Name)
+	if err != nil {
+		return err
+	}
+
+	if expired(groups, clock.Now()) {
+		fmt.Printf("Job %s finished and its ttlSecondsAfterFinished has passed, deleting it.\n", job.Name)
+		if err := DeleteJob(ctx, aciClient, job.Name, resourceGroup, true); err != nil {
+			return err
+		}
+		groups = nil
+	}
+
+	startTime := clock.Now().UTC().Truncate(time.Second)
+	if len(groups) > 0 {
+		status := jobStatus(job.Name, groups)
+		if status.Condition != "" {
+			return fmt.Errorf("Job %s has already finished (%s), delete it with 'acictl delete -f' to run it again", job.Name, status.Condition)
+		}
+		if status.StartTime != nil {
+			startTime = *status.StartTime
+		}
+		fmt.Printf("Resuming job %s started at %s.\n", job.Name, startTime.Format(time.RFC3339))
+	}
+
+	containerGroup.Tags = map[string]string{
+		JobTag:          job.Name,
+		JobStartTimeTag: startTime.Format(time.RFC3339),
+		TemplateHashTag: templateHash,
+	}
+	for key, value := range job.Tags {
+		containerGroup.Tags[key] = value
+	}
+	if spec.Completions != nil {
+		containerGroup.Tags[JobCompletionsTag] = strconv.Itoa(int(*spec.Completions))
+	}
+
+	var deadline time.Time
+	if spec.ActiveDeadlineSeconds != nil {
+		deadline = startTime.Add(time.Duration(*spec.ActiveDeadlineSeconds) * time.Second)
+	}
+
+	var failures int32
+	var notBefore time.Time
+	var backingOff bool
+	var last JobStatus
+	for {
+		groups, err := getJobGroups(ctx, aciClient, resourceGroup, job.Name)
+		if err != nil {
+			return err
+		}
+
+		status := jobStatus(job.Name, groups)
+		if status.Active != last.Active || status.Succeeded != last.Succeeded || status.Failed != last.Failed {
+			fmt.Printf("Job %s: %d active, %d succeeded, %d failed.\n", job.Name, status.Active, status.Succeeded, status.Failed)
+			last = status
+		}
+
+		now := clock.Now()
+		switch {
+		case status.Failed > backoffLimit:
+			return finishJob(ctx, aciClient, job, resourceGroup, groups, JobFailed, "BackoffLimitExceeded")
+		case !deadline.IsZero() && now.After(deadline):
+			return finishJob(ctx, aciClient, job, resourceGroup, groups, JobFailed, "DeadlineExceeded")
+		case spec.Completions != nil && status.Succeeded >= *spec.Completions,
+			spec.Completions == nil && status.Succeeded > 0 && status.Active == 0:
+			return finishJob(ctx, aciClient, job, resourceGroup, groups, JobComplete, "")
+		}
+
+		if status.Failed > failures {
+			failures = status.Failed
+			notBefore = now.Add(jobBackoff(failures))
+		}
+
+		// Without completions, the job is a work queue: once a container
+		// group succeeded no new ones are created.
+		want := parallelism - status.Active
+		if spec.Completions != nil && *spec.Completions-status.Succeeded-status.Active < want {
+			want = *spec.Completions - status.Succeeded - status.Active
+		}
+		if spec.Completions == nil && status.Succeeded > 0 {
+			want = 0
+		}
+
+		if want > 0 && now.Before(notBefore) && !backingOff {
+			fmt.Printf("Job %s: backing off %s before creating new container groups.\n", job.Name, notBefore.Sub(now).Round(time.Second))
+		}
+		backingOff = want > 0 && now.Before(notBefore)
+
+		if want > 0 && !backingOff {
+			if err := createJobGroups(ctx, aciClient, job.Name, resourceGroup, containerGroup, templateHash, int(want)); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Job %s interrupted (%s), run it again to resume it", job.Name, ctx.Err())
+		case <-clock.After(jobPollInterval):
+		}
+	}
+}
+
+// clock returns the clock of the job.
+func (job *Job) clock() Clock {
+	if job.Clock == nil {
+		return RealClock
+	}
+
+	return job.Clock
+}
+
+// createJobGroups creates count new container groups for the job.
+func createJobGroups(ctx context.Context, aciClient aci.ContainerGroupClient, jobName string, resourceGroup string, containerGroup *client.ContainerGroup, templateHash string, count int) error {
+	namer, err := newReplicaNamer(ctx, aciClient, resourceGroup, jobName, templateHash)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		name, err := namer.next()
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	var done progress
+	return runParallel(ctx, "create", names, &done, func(ctx context.Context, name string) error {
+		cg := *containerGroup
+		cg.Name = name
+
+		fmt.Printf("Creating Container Group %s.\n", cg.Name)
+
+		_, err := aciClient.CreateContainerGroup(ctx, resourceGroup, cg.Name, cg)
+		return err
+	})
+}
+
+// finishJob records the condition of the job on its container groups. A
+// failed job has its active container groups stopped. With
+// ttlSecondsAfterFinished set, the deadline after which the job is deleted is
+// recorded too, the deletion is left to DeleteExpiredJobs.
+func finishJob(ctx context.Context, aciClient aci.ContainerGroupClient, job *Job, resourceGroup string, groups []jobGroup, condition string, reason string) error {
+	var active []string
+	for _, group := range groups {
+		if group.state == jobGroupActive {
+			active = append(active, group.cg.Name)
+		}
+	}
+
+	var done progress
+	if condition == JobFailed && len(active) > 0 {
+		err := runParallel(ctx, "stop", active, &done, func(ctx context.Context, name string) error {
+			fmt.Printf("Stopping container group %s\n", name)
+			if err := aciClient.StopContainerGroup(ctx, resourceGroup, name); err != nil {
+				return fmt.Errorf("Stop container group error: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	completionTime := job.clock().Now().UTC().Truncate(time.Second)
+	var ttlDeadline time.Time
+	if job.TTLSecondsAfterFinished != nil {
+		ttlDeadline = completionTime.Add(time.Duration(*job.TTLSecondsAfterFinished) * time.Second)
+	}
+
+	for _, group := range groups {
+		tags := map[string]string{}
+		for key, value := range group.cg.Tags {
+			tags[key] = value
+		}
+		tags[JobConditionTag] = condition
+		tags[JobCompletionTimeTag] = completionTime.Format(time.RFC3339)
+		if reason != "" {
+			tags[JobReasonTag] = reason
+		}
+		if !ttlDeadline.IsZero() {
+			tags[JobTTLDeadlineTag] = ttlDeadline.Format(time.RFC3339)
+		}
+
+		if _, err := aciClient.UpdateContainerGroupTags(ctx, resourceGroup, group.cg.Name, tags); err != nil {
+			return fmt.Errorf("Recording the condition of job %s on container group %s failed: %w", job.Name, group.cg.Name, err)
+		}
+	}
+
+	if condition == JobComplete {
+		fmt.Printf("Job %s completed.\n", job.Name)
+	} else {
+		fmt.Printf("Job %s failed: %s.\n", job.Name, reason)
+	}
+
+	if !ttlDeadline.IsZero() {
+		fmt.Printf("Job %s expires at %s, it is deleted by the controller, the cron scheduler of a cron job, or when run again after that.\n", job.Name, ttlDeadline.Local().Format(time.RFC3339))
+	}
+
+	if condition == JobFailed {
+		return fmt.Errorf("Job %s failed: %s", job.Name, reason)
+	}
+
+	return nil
+}
+
+// DeleteExpiredJobs deletes the finished jobs of the resource group whose
+// ttlSecondsAfterFinished has passed at now.
+func DeleteExpiredJobs(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, now time.Time) error {
+	cgList, err := aciClient.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return fmt.Errorf("Container group list error: %w", err)
+	}
+
+	jobs := map[string][]jobGroup{}
+	for _, cg := range cgList.Value {
+		if name, ok := cg.Tags[JobTag]; ok {
+			jobs[name] = append(jobs[name], jobGroup{cg: cg})
+		}
+	}
+
+	var names []string
+	for name, groups := range jobs {
+		if expired(groups, now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Printf("Deleting job %s, its ttlSecondsAfterFinished has passed.\n", name)
+		if err := DeleteJob(ctx, aciClient, name, resourceGroup, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expired reports whether the job of the container groups has finished and
+// its ttlSecondsAfterFinished has passed at now.
+func expired(groups []jobGroup, now time.Time) bool {
+	for _, group := range groups {
+		if deadline, err := time.Parse(time.RFC3339, group.cg.Tags[JobTTLDeadlineTag]); err == nil && group.cg.Tags[JobConditionTag] != "" {
+			return !now.Before(deadline)
+		}
+	}
+
+	return false
+}
+
+// DeleteJob deletes the container groups of the job.
+func DeleteJob(ctx context.Context, aciClient aci.ContainerGroupClient, jobName string, resourceGroup string, wait bool) error {
+	return deleteTagged(ctx, aciClient, resourceGroup, JobTag, jobName, wait)
+}
+
+// deleteTagged deletes the container groups with the tag set to value.
+func deleteTagged(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, tag string, value string, wait bool) error {
+	cgList, err := aciClient.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return fmt.Errorf("Container group list error: %w", err)
+	}
+
+	var names []string
+	for _, cg := range cgList.Value {
+		if tagValue, ok := cg.Tags[tag]; ok && tagValue == value {
+			names = append(names, cg.Name)
+		}
+	}
+	sort.Strings(names)
+
+	if wait {
+		ctx = aci.WithOperationWait(ctx)
+	}
+
+	var done progress
+	return runParallel(ctx, "delete", names, &done, func(ctx context.Context, name string) error {
+		fmt.Printf("Deleting container group %s\n", name)
+		if err := aciClient.DeleteContainerGroup(ctx, resourceGroup, name); err != nil {
+			return fmt.Errorf("Delete container group error: %w", err)
+		}
+
+		if wait {
+			return waitForDeletion(ctx, aciClient, resourceGroup, name)
+		}
+		return nil
+	})
+}
+
+// GetJobs returns the status of every job in the resource group, sorted by
+// name.
+func GetJobs(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string) ([]JobStatus, error) {
+	cgList, err := aciClient.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("Container group list error: %w", err)
+	}
+
+	var jobNames []string
+	seen := map[string]bool{}
+	for _, cg := range cgList.Value {
+		if name, ok := cg.Tags[JobTag]; ok && !seen[name] {
+			seen[name] = true
+			jobNames = append(jobNames, name)
+		}
+	}
+	sort.Strings(jobNames)
+
+	statuses := make([]JobStatus, 0, len(jobNames))
+	for _, name := range jobNames {
+		groups, err := getJobGroups(ctx, aciClient, resourceGroup, name)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, jobStatus(name, groups))
+	}
+
+	return statuses, nil
+}
+
+// getJobGroups returns the container groups of the job with their instance
+// views, which are not part of the list response.
+func getJobGroups(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, jobName string) ([]jobGroup, error) {
+	cgList, err := aciClient.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("Container group list error: %w", err)
+	}
+
+	var groups []jobGroup
+	for _, listed := range cgList.Value {
+		if listed.Tags[JobTag] != jobName {
+			continue
+		}
+
+		cg, err, status := aciClient.GetContainerGroup(ctx, resourceGroup, listed.Name)
+		if status != nil && *status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Getting container group %s of job %s failed: %w", listed.Name, jobName, err)
+		}
+
+		groups = append(groups, jobGroup{cg: *cg, state: jobGroupState(cg)})
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].cg.Name < groups[j].cg.Name })
+
+	return groups, nil
+}
+
+// jobGroupState returns whether the containers of a container group of a job
+// are still running, have all exited with 0, or failed.
+func jobGroupState(cg *client.ContainerGroup) string {
+	switch {
+	case isContainerGroupFailed(cg), cg.InstanceView.State == "Stopped":
+		return jobGroupFailed
+	case cg.InstanceView.State == "Succeeded":
+		return jobGroupSucceeded
+	default:
+		return jobGroupActive
+	}
+}
+
+// jobStatus computes the status of a job from its container groups. Restarts
+// of containers count as failures.
+func jobStatus(jobName string, groups []jobGroup) JobStatus {
+	status := JobStatus{Name: jobName}
+	for _, group := range groups {
+		switch group.state {
+		case jobGroupActive:
+			status.Active++
+		case jobGroupSucceeded:
+			status.Succeeded++
+		case jobGroupFailed:
+			status.Failed++
+		}
+
+		for _, container := range group.cg.Containers {
+			status.Failed += container.InstanceView.RestartCount
+		}
+
+		tags := group.cg.Tags
+		if completions, err := strconv.Atoi(tags[JobCompletionsTag]); err == nil {
+			c := int32(completions)
+			status.Completions = &c
+		}
+		if t, err := time.Parse(time.RFC3339, tags[JobStartTimeTag]); err == nil && (status.StartTime == nil || t.Before(*status.StartTime)) {
+			status.StartTime = &t
+		}
+		if t, err := time.Parse(time.RFC3339, tags[JobCompletionTimeTag]); err == nil {
+			status.CompletionTime = &t
+		}
+		if condition := tags[JobConditionTag]; condition != "" {
+			status.Condition = condition
+			status.Reason = tags[JobReasonTag]
+		}
+	}
+
+	return status
+}
+
+// jobBackoff returns the delay before replacing container groups after the
+// given number of failures.
+func jobBackoff(failures int32) time.Duration {
+	backoff := JobBackoff
+	for i := int32(1); i < failures && backoff < MaxJobBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > MaxJobBackoff {
+		return MaxJobBackoff
+	}
+
+	return backoff
+}
+
+// int32Value returns the value of p, or def when p is nil.
+func int32Value(p *int32, def int32) int32 {
+	if p == nil {
+		return def
+	}
+
+	return *p
+}
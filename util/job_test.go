@@ -0,0 +1,208 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+
+	"github.com/samkreter/acictl/aci/fake"
+)
+
+// jobManifest returns a batch/v1 Job running image, with the fields of spec
+// added to its spec.
+func jobManifest(image string, restartPolicy string, spec string) string {
+	return fmt.Sprintf(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: batch
+spec:
+%s  template:
+    spec:
+      restartPolicy: %s
+      containers:
+      - name: worker
+        image: %s
+`, spec, restartPolicy, image)
+}
+
+// readJob reads the job of the manifest.
+func readJob(t *testing.T, manifest string) *Job {
+	t.Helper()
+
+	obj, data, err := readManifest(writeManifest(t, manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return jobFromManifest(obj.(*batchv1.Job), data)
+}
+
+func TestRunJob(t *testing.T) {
+	tests := []struct {
+		name          string
+		manifest      string
+		exitCode      int32
+		wantSucceeded int32
+		wantFailed    int32
+		wantCondition string
+		wantReason    string
+		wantErr       bool
+	}{
+		{
+			name:          "single",
+			manifest:      jobManifest("worker", "Never", ""),
+			wantSucceeded: 1,
+			wantCondition: JobComplete,
+		},
+		{
+			name:          "completions",
+			manifest:      jobManifest("worker", "Never", "  completions: 5\n  parallelism: 2\n"),
+			wantSucceeded: 5,
+			wantCondition: JobComplete,
+		},
+		{
+			name:          "work queue",
+			manifest:      jobManifest("worker", "Never", "  parallelism: 3\n"),
+			wantSucceeded: 3,
+			wantCondition: JobComplete,
+		},
+		{
+			name:          "backoff limit",
+			manifest:      jobManifest("worker", "Never", "  backoffLimit: 2\n"),
+			exitCode:      1,
+			wantFailed:    3,
+			wantCondition: JobFailed,
+			wantReason:    "BackoffLimitExceeded",
+			wantErr:       true,
+		},
+		{
+			name:     "restart policy",
+			manifest: jobManifest("worker", "Always", ""),
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+			backoff := JobBackoff
+			JobBackoff = 0
+			defer func() { JobBackoff = backoff }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			aciClient := fake.NewClient()
+			aciClient.RunSteps = 1
+			aciClient.ExitCodes["worker"] = test.exitCode
+
+			err := RunJob(ctx, aciClient, readJob(t, test.manifest), testResourceGroup, "westus")
+			if test.wantErr != (err != nil) {
+				t.Fatalf("RunJob returned %v, want an error: %t", err, test.wantErr)
+			}
+
+			jobs, err := GetJobs(ctx, aciClient, testResourceGroup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.wantCondition == "" {
+				if len(jobs) != 0 {
+					t.Fatalf("RunJob left the jobs %+v, want none", jobs)
+				}
+				return
+			}
+			if len(jobs) != 1 {
+				t.Fatalf("RunJob left %d jobs, want 1", len(jobs))
+			}
+
+			status := jobs[0]
+			if status.Condition != test.wantCondition || status.Reason != test.wantReason {
+				t.Errorf("Job finished with %s (%s), want %s (%s)", status.Condition, status.Reason, test.wantCondition, test.wantReason)
+			}
+			if status.Succeeded != test.wantSucceeded || status.Failed != test.wantFailed || status.Active != 0 {
+				t.Errorf("Job has %d active, %d succeeded and %d failed container groups, want 0, %d and %d", status.Active, status.Succeeded, status.Failed, test.wantSucceeded, test.wantFailed)
+			}
+		})
+	}
+}
+
+func TestJobTTL(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int32
+	}{
+		{name: "succeeded"},
+		{name: "failed", exitCode: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			aciClient := fake.NewClient()
+			aciClient.RunSteps = 1
+			aciClient.ExitCodes["worker"] = test.exitCode
+
+			job := readJob(t, jobManifest("worker", "Never", "  backoffLimit: 0\n  ttlSecondsAfterFinished: 60\n"))
+			RunJob(ctx, aciClient, job, testResourceGroup, "westus")
+			finished := time.Now()
+
+			groups := listGroups(t, aciClient)
+			if len(groups) == 0 || groups[0].Tags[JobTTLDeadlineTag] == "" {
+				t.Fatalf("RunJob left container groups %+v, want them tagged with the TTL deadline", groups)
+			}
+
+			if err := DeleteExpiredJobs(ctx, aciClient, testResourceGroup, finished); err != nil {
+				t.Fatal(err)
+			}
+			if len(listGroups(t, aciClient)) == 0 {
+				t.Fatalf("DeleteExpiredJobs deleted the job before its TTL")
+			}
+
+			if err := DeleteExpiredJobs(ctx, aciClient, testResourceGroup, finished.Add(2*time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			if groups := listGroups(t, aciClient); len(groups) != 0 {
+				t.Fatalf("DeleteExpiredJobs left %d container groups after the TTL, want none", len(groups))
+			}
+		})
+	}
+}
+
+func TestRunJobExpired(t *testing.T) {
+	fastPolling(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	aciClient := fake.NewClient()
+	aciClient.RunSteps = 1
+
+	// Without a TTL, a finished job must be deleted before it runs again.
+	job := readJob(t, jobManifest("worker", "Never", ""))
+	if err := RunJob(ctx, aciClient, job, testResourceGroup, "westus"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunJob(ctx, aciClient, job, testResourceGroup, "westus"); err == nil {
+		t.Fatalf("RunJob ran a finished job again")
+	}
+
+	// Once its TTL has passed, the job is deleted and runs again.
+	aciClient = fake.NewClient()
+	aciClient.RunSteps = 1
+	job = readJob(t, jobManifest("worker", "Never", "  ttlSecondsAfterFinished: 0\n"))
+	for i := 0; i < 2; i++ {
+		if err := RunJob(ctx, aciClient, job, testResourceGroup, "westus"); err != nil {
+			t.Fatalf("Run %d of the job failed: %v", i+1, err)
+		}
+	}
+	if groups := listGroups(t, aciClient); len(groups) != 1 {
+		t.Errorf("Running the expired job again left %d container groups, want 1", len(groups))
+	}
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// LoadKustomization builds the kustomization of the directory with kustomize,
+// and loads its workloads, ConfigMaps and Secrets like loadObjects.
+func LoadKustomization(dir string, name string) (string, error) {
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(templateFS{filesys.MakeFsOnDisk()}, dir)
+	if err != nil {
+		return "", fmt.Errorf("Building the kustomization of %s failed: %v", dir, err)
+	}
+
+	var objects []*manifestObject
+	for _, resource := range resources.Resources() {
+		fields, err := resource.Map()
+		if err != nil {
+			return "", fmt.Errorf("Decoding the %s %s of %s failed: %v", resource.GetKind(), resource.GetName(), dir, err)
+		}
+		objects = append(objects, &manifestObject{fields: fields})
+	}
+
+	return loadObjects(dir, name, objects)
+}
+
+// templateFS is the file system kustomize reads through, which preprocesses
+// the manifests of resources and patches like the -f manifests. The
+// kustomization files are read as they are.
+type templateFS struct {
+	filesys.FileSystem
+}
+
+func (fs templateFS) ReadFile(path string) ([]byte, error) {
+	data, err := fs.FileSystem.ReadFile(path)
+	if err != nil || !isManifestFile(path) || isKustomizationFile(path) {
+		return data, err
+	}
+
+	return preprocessManifest(path, data)
+}
+
+func isKustomizationFile(path string) bool {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if filepath.Base(path) == name {
+			return true
+		}
+	}
+
+	return false
+}
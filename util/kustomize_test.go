@@ -0,0 +1,109 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/api/extensions/v1beta1"
+)
+
+// writeFiles writes the files, keyed by their path relative to the returned
+// directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestLoadKustomization(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base/kustomization.yaml": `resources:
+- deployment.yaml
+configMapGenerator:
+- name: settings
+  literals:
+  - LEVEL=debug
+`,
+		"base/deployment.yaml": `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx:{{ .Values.tag }}
+        envFrom:
+        - configMapRef:
+            name: settings
+`,
+		"overlay/kustomization.yaml": `resources:
+- ../base
+namePrefix: prod-
+patches:
+- target:
+    kind: Deployment
+    name: web
+  patch: |-
+    - op: replace
+      path: /spec/replicas
+      value: 3
+`,
+	})
+
+	values := ManifestValues
+	ManifestValues = map[string]interface{}{"tag": "1.15"}
+	defer func() { ManifestValues = values }()
+
+	ref, err := LoadKustomization(filepath.Join(dir, "overlay"), "prod-web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, _, err := readManifest(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := obj.(*v1beta1.Deployment)
+
+	if deployment.Name != "prod-web" {
+		t.Errorf("Deployment is named %q, want prod-web", deployment.Name)
+	}
+	if *deployment.Spec.Replicas != 3 {
+		t.Errorf("Deployment has %d replicas, want the 3 of the patch", *deployment.Spec.Replicas)
+	}
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != "nginx:1.15" {
+		t.Errorf("Container has image %q, want nginx:1.15", container.Image)
+	}
+
+	// The reference follows the name prefix and hash suffix of the
+	// generated ConfigMap.
+	configMap := container.EnvFrom[0].ConfigMapRef.Name
+	if !strings.HasPrefix(configMap, "prod-settings-") {
+		t.Fatalf("Container references the ConfigMap %q, want prod-settings-<hash>", configMap)
+	}
+	if level := string(manifestConfigs["ConfigMap/"+configMap]["LEVEL"]); level != "debug" {
+		t.Errorf("ConfigMap %s has LEVEL %q, want debug", configMap, level)
+	}
+
+	if _, err := LoadKustomization(filepath.Join(dir, "overlay"), "web"); err == nil {
+		t.Errorf("Loading the workload web by its name before the prefix succeeded, want an error")
+	}
+}
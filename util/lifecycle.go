@@ -0,0 +1,162 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// Restart restarts the containers of every replica owned by the deployment,
+// or of the single container group with that name. A rolling restart restarts
+// one replica at a time, and waits for its containers to have restarted and to
+// be running again before the next one.
+func Restart(ctx context.Context, aciClient aci.ContainerGroupClient, name string, resourceGroup string, rolling bool, timeout time.Duration) error {
+	names, err := resolveContainerGroups(ctx, aciClient, resourceGroup, name)
+	if err != nil {
+		return err
+	}
+
+	if timeout == 0 {
+		timeout = DefaultRolloutTimeout
+	}
+
+	var done progress
+	if !rolling {
+		return runParallel(ctx, "restart", names, &done, func(ctx context.Context, cgName string) error {
+			fmt.Printf("Restarting container group %s\n", cgName)
+			if err := aciClient.RestartContainerGroup(ctx, resourceGroup, cgName); err != nil {
+				return fmt.Errorf("Restart container group error: %w", err)
+			}
+			return nil
+		})
+	}
+
+	for _, cgName := range names {
+		before, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, cgName)
+		if err != nil {
+			return done.interrupted(ctx, err)
+		}
+
+		fmt.Printf("Restarting container group %s\n", cgName)
+		if err := aciClient.RestartContainerGroup(ctx, resourceGroup, cgName); err != nil {
+			return done.interrupted(ctx, fmt.Errorf("Restart container group error: %w", err))
+		}
+		done.add("restarted", cgName)
+
+		// The group is usually still running right after the restart was
+		// requested, so it is only ready again once its containers restarted.
+		if err := waitForRestart(ctx, aciClient, resourceGroup, before, timeout); err != nil {
+			return done.interrupted(ctx, err)
+		}
+
+		if err := waitForContainerGroups(ctx, aciClient, resourceGroup, []string{cgName}, timeout); err != nil {
+			return done.interrupted(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// waitForRestart waits until the containers of the group restarted since it
+// was read as before, or the group left the Running state.
+func waitForRestart(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, before *client.ContainerGroup, timeout time.Duration) error {
+	err := pollImmediate(ctx, rolloutPollInterval, timeout, func() (bool, error) {
+		cg, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, before.Name)
+		if err != nil {
+			return false, err
+		}
+
+		return hasRestarted(before, cg), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Timed out after %s waiting for container group %s to restart", timeout, before.Name)
+	}
+
+	return err
+}
+
+// hasRestarted reports whether a container of the group restarted, or the
+// group left the Running state, since it was read as before.
+func hasRestarted(before, cg *client.ContainerGroup) bool {
+	if cg.InstanceView.State != "Running" {
+		return true
+	}
+
+	started := map[string]client.ContainerPropertiesInstanceView{}
+	for _, container := range before.Containers {
+		started[container.Name] = container.InstanceView
+	}
+
+	for _, container := range cg.Containers {
+		view, ok := started[container.Name]
+		if !ok || container.InstanceView.RestartCount != view.RestartCount {
+			return true
+		}
+
+		if !time.Time(container.InstanceView.CurrentState.StartTime).Equal(time.Time(view.CurrentState.StartTime)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stop stops every replica owned by the deployment, or the single container
+// group with that name.
+func Stop(ctx context.Context, aciClient aci.ContainerGroupClient, name string, resourceGroup string) error {
+	names, err := resolveContainerGroups(ctx, aciClient, resourceGroup, name)
+	if err != nil {
+		return err
+	}
+
+	var done progress
+	return runParallel(ctx, "stop", names, &done, func(ctx context.Context, cgName string) error {
+		fmt.Printf("Stopping container group %s\n", cgName)
+		if err := aciClient.StopContainerGroup(ctx, resourceGroup, cgName); err != nil {
+			return fmt.Errorf("Stop container group error: %w", err)
+		}
+		return nil
+	})
+}
+
+// Start starts every stopped replica owned by the deployment, or the single
+// container group with that name.
+func Start(ctx context.Context, aciClient aci.ContainerGroupClient, name string, resourceGroup string) error {
+	names, err := resolveContainerGroups(ctx, aciClient, resourceGroup, name)
+	if err != nil {
+		return err
+	}
+
+	var done progress
+	return runParallel(ctx, "start", names, &done, func(ctx context.Context, cgName string) error {
+		fmt.Printf("Starting container group %s\n", cgName)
+		if err := aciClient.StartContainerGroup(ctx, resourceGroup, cgName); err != nil {
+			return fmt.Errorf("Start container group error: %w", err)
+		}
+		return nil
+	})
+}
+
+// resolveContainerGroups returns the names of the replicas owned by the named
+// deployment, or the name itself when it is a container group.
+func resolveContainerGroups(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, name string) ([]string, error) {
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(owned) > 0 {
+		return containerGroupNames(owned), nil
+	}
+
+	if _, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, name); err != nil {
+		return nil, fmt.Errorf("No deployment or container group named %q found in resource group %s: %w", name, resourceGroup, err)
+	}
+
+	return []string{name}, nil
+}
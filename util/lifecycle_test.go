@@ -0,0 +1,56 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samkreter/acictl/aci/fake"
+)
+
+func TestRestart(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		rolling bool
+		want    map[string]int32
+		wantErr bool
+	}{
+		{name: "deployment", target: "web", want: map[string]int32{"web": 1, "api": 0}},
+		{name: "rolling", target: "web", rolling: true, want: map[string]int32{"web": 1, "api": 0}},
+		{name: "unknown", target: "db", wantErr: true, want: map[string]int32{"web": 0, "api": 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+			ctx := context.Background()
+			aciClient := fake.NewClient()
+
+			for _, name := range []string{"web", "api"} {
+				if err := Create(ctx, aciClient, writeManifest(t, deploymentManifest(name, 2, "nginx")), testResourceGroup, "westus", true); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := Restart(ctx, aciClient, test.target, testResourceGroup, test.rolling, 0)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Restart returned %v, want an error: %t", err, test.wantErr)
+			}
+
+			for _, cg := range listGroups(t, aciClient) {
+				live, err, _ := aciClient.GetContainerGroup(ctx, testResourceGroup, cg.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := test.want[cg.Tags[DeploymentTag]]
+				if got := live.Containers[0].InstanceView.RestartCount; got != want {
+					t.Errorf("Container of %s restarted %d times, want %d", cg.Name, got, want)
+				}
+				if !isContainerGroupReady(live) {
+					t.Errorf("Container group %s is not running after the restart", cg.Name)
+				}
+			}
+		})
+	}
+}
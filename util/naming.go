@@ -0,0 +1,149 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+// Naming schemes for the container groups of a deployment's replicas.
+const (
+	// NamingOrdinal names replicas <deployment>-0 to <deployment>-N, using
+	// the lowest free ordinal for every new replica.
+	NamingOrdinal = "ordinal"
+	// NamingHash derives the replica suffix from the template hash.
+	NamingHash = "hash"
+	// NamingRandom uses a random suffix.
+	NamingRandom = "random"
+)
+
+var (
+	// ReplicaNaming is the naming scheme used for new replicas.
+	ReplicaNaming = NamingOrdinal
+
+	// MaxContainerGroupNameLength is the longest name ACI accepts.
+	MaxContainerGroupNameLength = 63
+
+	containerGroupNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	randChars                = []rune("abcdefghijklmnopqrstuvwxyz0123456789")
+
+	// maxNameAttempts bounds the search for a free hash or random name.
+	maxNameAttempts = 1000
+)
+
+// ValidateNamingScheme returns an error if scheme is not a known naming scheme.
+func ValidateNamingScheme(scheme string) error {
+	switch scheme {
+	case NamingOrdinal, NamingHash, NamingRandom:
+		return nil
+	}
+
+	return fmt.Errorf("Unknown naming scheme %q, must be one of %s, %s or %s", scheme, NamingOrdinal, NamingHash, NamingRandom)
+}
+
+// ValidateContainerGroupName returns an error if ACI would reject the name.
+func ValidateContainerGroupName(name string) error {
+	if len(name) == 0 || len(name) > MaxContainerGroupNameLength {
+		return fmt.Errorf("Container group name %q must be between 1 and %d characters long", name, MaxContainerGroupNameLength)
+	}
+
+	if !containerGroupNameRegexp.MatchString(name) {
+		return fmt.Errorf("Container group name %q must only contain lowercase letters, numbers and '-', and start and end with a letter or number", name)
+	}
+
+	if strings.Contains(name, "--") {
+		return fmt.Errorf("Container group name %q can not contain consecutive '-'", name)
+	}
+
+	return nil
+}
+
+// replicaNamer hands out names for new replicas of a deployment that do not
+// collide with the container groups already in the resource group.
+type replicaNamer struct {
+	scheme       string
+	prefix       string
+	templateHash string
+	taken        map[string]bool
+}
+
+// newReplicaNamer lists the container groups of the resource group so that
+// new names never overwrite an existing group.
+func newReplicaNamer(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, deploymentName string, templateHash string) (*replicaNamer, error) {
+	if err := ValidateNamingScheme(ReplicaNaming); err != nil {
+		return nil, err
+	}
+
+	cgList, err := aciClient.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("Container group list error: %w", err)
+	}
+
+	taken := map[string]bool{}
+	for _, cg := range cgList.Value {
+		taken[cg.Name] = true
+	}
+
+	return &replicaNamer{
+		scheme:       ReplicaNaming,
+		prefix:       deploymentName + "-",
+		templateHash: templateHash,
+		taken:        taken,
+	}, nil
+}
+
+// next returns a free, valid name and reserves it.
+func (n *replicaNamer) next() (string, error) {
+	for i := 0; i < maxNameAttempts || n.scheme == NamingOrdinal; i++ {
+		var name string
+		switch n.scheme {
+		case NamingOrdinal:
+			name = n.prefix + strconv.Itoa(i)
+		case NamingHash:
+			hasher := fnv.New32a()
+			hasher.Write([]byte(n.templateHash + "/" + strconv.Itoa(i)))
+			name = n.prefix + strconv.FormatUint(uint64(hasher.Sum32()), 36)
+		default:
+			suffix, err := randSeq(RandStringLength)
+			if err != nil {
+				return "", err
+			}
+			name = n.prefix + suffix
+		}
+
+		if n.taken[name] {
+			continue
+		}
+
+		if err := ValidateContainerGroupName(name); err != nil {
+			return "", err
+		}
+
+		n.taken[name] = true
+
+		return name, nil
+	}
+
+	return "", fmt.Errorf("Unable to find a free container group name for %s after %d attempts", n.prefix, maxNameAttempts)
+}
+
+// randSeq returns a random lowercase alphanumeric string of length n.
+func randSeq(n int) (string, error) {
+	b := make([]rune, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(randChars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = randChars[idx.Int64()]
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,179 @@
+package util
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+var (
+	// builtSource is the kustomization or chart loaded by loadObjects, and
+	// builtWorkloads the references of its workloads, which read the
+	// manifests of builtManifests.
+	builtSource    string
+	builtWorkloads []string
+	builtManifests map[string][]byte
+
+	// manifestConfigs are the data of the ConfigMaps and Secrets of the
+	// kustomization or chart, keyed by kind and name, that pod specs
+	// reference.
+	manifestConfigs map[string]map[string][]byte
+)
+
+// manifestObject is an object of a built kustomization or of a rendered
+// chart.
+type manifestObject struct {
+	fields map[string]interface{}
+}
+
+func (o *manifestObject) kind() string {
+	kind, _ := o.fields["kind"].(string)
+	return kind
+}
+
+func (o *manifestObject) name() string {
+	name, _ := nestedMap(o.fields, "metadata")["name"].(string)
+	return name
+}
+
+// loadObjects loads the objects built from the kustomization or chart at
+// source, and returns the reference that reads the manifest of its workload
+// named name in place of a manifest file. When name is empty or several
+// workloads have the name, source itself is returned, which reads all of them
+// as a manifest directory does. The ConfigMaps and Secrets are resolved by the
+// pod specs referencing them, the other kinds are ignored.
+func loadObjects(source string, name string, objects []*manifestObject) (string, error) {
+	var workloads []string
+	manifests := map[string][]byte{}
+	configs := map[string]map[string][]byte{}
+	for _, object := range objects {
+		switch object.kind() {
+		case "ConfigMap", "Secret":
+			data, err := configData(object)
+			if err != nil {
+				return "", err
+			}
+			configs[object.kind()+"/"+object.name()] = data
+		case "Deployment", "Job", "CronJob":
+			data, err := json.Marshal(object.fields)
+			if err != nil {
+				return "", err
+			}
+
+			ref := fmt.Sprintf("%s (%s %s)", source, object.kind(), object.name())
+			manifests[ref] = data
+			if name == "" || object.name() == name {
+				workloads = append(workloads, ref)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: ignoring the %s %s of %s, only Deployments, Jobs and CronJobs are run.\n", object.kind(), object.name(), source)
+		}
+	}
+
+	switch {
+	case len(workloads) == 0 && name != "":
+		return "", fmt.Errorf("%s builds no Deployment, Job or CronJob named %s", source, name)
+	case len(workloads) == 0:
+		return "", fmt.Errorf("%s builds no Deployment, Job or CronJob", source)
+	}
+
+	builtSource = source
+	builtWorkloads = workloads
+	builtManifests = manifests
+	manifestConfigs = configs
+
+	if len(workloads) == 1 {
+		return workloads[0], nil
+	}
+	return source, nil
+}
+
+// decodeManifestObjects decodes the objects of the YAML documents or the
+// JSON object of source, empty documents aside.
+func decodeManifestObjects(source string, data []byte) ([]*manifestObject, error) {
+	var objects []*manifestObject
+	decoder := k8syaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var fields map[string]interface{}
+		err := decoder.Decode(&fields)
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Decoding %s failed: %v", source, err)
+		}
+		if fields == nil {
+			continue
+		}
+
+		object := &manifestObject{fields: fields}
+		if object.kind() == "" || object.name() == "" {
+			return nil, fmt.Errorf("%s holds an object without kind or name", source)
+		}
+		objects = append(objects, object)
+	}
+}
+
+// configData returns the decoded data of the ConfigMap or Secret.
+func configData(object *manifestObject) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	decode := func(field string) error {
+		for key, value := range nestedMap(object.fields, field) {
+			decoded, err := base64.StdEncoding.DecodeString(fmt.Sprint(value))
+			if err != nil {
+				return fmt.Errorf("The key %s of the %s %s is not valid base64: %v", key, object.kind(), object.name(), err)
+			}
+			data[key] = decoded
+		}
+		return nil
+	}
+
+	if object.kind() == "Secret" {
+		if err := decode("data"); err != nil {
+			return nil, err
+		}
+		for key, value := range nestedMap(object.fields, "stringData") {
+			data[key] = []byte(fmt.Sprint(value))
+		}
+		return data, nil
+	}
+
+	for key, value := range nestedMap(object.fields, "data") {
+		data[key] = []byte(fmt.Sprint(value))
+	}
+	if err := decode("binaryData"); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// nestedMap returns the map at the path of fields. A missing map is returned
+// as nil, which reads as an empty map.
+func nestedMap(fields map[string]interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		child, ok := fields[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields = child
+	}
+
+	return fields
+}
+
+// firstNonEmptyString returns the first of values that is not empty.
+func firstNonEmptyString(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
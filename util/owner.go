@@ -0,0 +1,304 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+	"github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/api"
+)
+
+// Tags acictl sets on every container group it creates so the group can be
+// traced back to the deployment and revision it belongs to.
+const (
+	DeploymentTag   = "acictl-deployment"
+	RevisionTag     = "acictl-revision"
+	TemplateHashTag = "acictl-template-hash"
+	// ReplicasTag records the number of replicas the deployment should have,
+	// for 'acictl controller' to recreate the missing ones.
+	ReplicasTag = "acictl-replicas"
+	// StrategyTag records the deployment strategy, for 'acictl rollout undo'
+	// to roll back the way the deployment rolls out.
+	StrategyTag = "acictl-strategy"
+
+	// RevisionHistoryTagPrefix prefixes one tag per recorded revision, the
+	// value holds the container images of that revision.
+	RevisionHistoryTagPrefix = "acictl-rev-"
+)
+
+// maxTagValueLength is the length Azure Resource Manager limits the values of
+// tags to.
+const maxTagValueLength = 256
+
+// IsOwnedBy reports whether the container group belongs to the named deployment.
+// Groups created before acictl tagged its resources are matched by name prefix,
+// the groups of jobs belong to no deployment.
+func IsOwnedBy(cg client.ContainerGroup, deploymentName string) bool {
+	if _, ok := cg.Tags[JobTag]; ok {
+		return false
+	}
+
+	if owner, ok := cg.Tags[DeploymentTag]; ok {
+		return owner == deploymentName
+	}
+
+	return strings.HasPrefix(cg.Name, deploymentName+"-")
+}
+
+// ListOwnedContainerGroups returns the container groups in the resource group
+// that belong to the named deployment, sorted by name.
+func ListOwnedContainerGroups(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, deploymentName string) ([]client.ContainerGroup, error) {
+	cgList, err := aciClient.ListContainerGroups(ctx, resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("Container group list error: %w", err)
+	}
+
+	owned := []client.ContainerGroup{}
+	for _, cg := range cgList.Value {
+		if IsOwnedBy(cg, deploymentName) {
+			owned = append(owned, cg)
+		}
+	}
+
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[i].Name < owned[j].Name
+	})
+
+	return owned, nil
+}
+
+// GetRevision returns the revision recorded on the container group, groups
+// without a revision tag are treated as revision 0.
+func GetRevision(cg client.ContainerGroup) int {
+	revision, err := strconv.Atoi(cg.Tags[RevisionTag])
+	if err != nil {
+		return 0
+	}
+
+	return revision
+}
+
+// TemplateHash computes a stable hash of the container group template,
+// ignoring the fields that differ between replicas of the same revision.
+func TemplateHash(cg *client.ContainerGroup) (string, error) {
+	data, err := json.Marshal(templateFromContainerGroup(cg))
+	if err != nil {
+		return "", err
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write(data)
+
+	return strconv.FormatUint(uint64(hasher.Sum32()), 16), nil
+}
+
+// templateFromContainerGroup returns a copy of the container group with the
+// name, tags and every server populated field cleared.
+func templateFromContainerGroup(cg *client.ContainerGroup) *client.ContainerGroup {
+	template := *cg
+	template.ResponseMetadata = api.ResponseMetadata{}
+	template.ID = ""
+	template.Name = ""
+	template.Tags = nil
+	template.ProvisioningState = ""
+	template.InstanceView = client.ContainerGroupPropertiesInstanceView{}
+	if cg.IPAddress != nil {
+		ipAddress := *cg.IPAddress
+		ipAddress.IP = ""
+		template.IPAddress = &ipAddress
+	}
+
+	template.Containers = make([]client.Container, len(cg.Containers))
+	for i, container := range cg.Containers {
+		container.InstanceView = client.ContainerPropertiesInstanceView{}
+		template.Containers[i] = container
+	}
+
+	return &template
+}
+
+// copyReplica reads the replica of the deployment and returns its template.
+// Azure never returns the content of secret volumes and registry passwords,
+// replicas having them can't be copied.
+func copyReplica(ctx context.Context, aciClient aci.ContainerGroupClient, replica client.ContainerGroup, deploymentName string, resourceGroup string) (*client.ContainerGroup, error) {
+	live, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, replica.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	hasSecrets := len(live.ImageRegistryCredentials) > 0
+	for _, volume := range live.Volumes {
+		hasSecrets = hasSecrets || volume.Secret != nil
+	}
+	if hasSecrets {
+		return nil, fmt.Errorf("Replicas of deployment %q have secret volumes or registry credentials Azure doesn't return, supply the deployment file with the -f flag", deploymentName)
+	}
+
+	return templateFromContainerGroup(live), nil
+}
+
+// copyTags returns a copy of the tags.
+func copyTags(tags map[string]string) map[string]string {
+	copied := make(map[string]string, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+
+	return copied
+}
+
+// ownerTags returns the tags for a replica of the given deployment revision.
+// It fails when the images of a revision are too long for the value of its
+// tag, which Azure would reject.
+func ownerTags(deploymentName string, revision int, templateHash string, history map[int]string) (map[string]string, error) {
+	tags := map[string]string{
+		DeploymentTag:   deploymentName,
+		RevisionTag:     strconv.Itoa(revision),
+		TemplateHashTag: templateHash,
+	}
+
+	for rev, images := range history {
+		if length := utf8.RuneCountInString(images); length > maxTagValueLength {
+			return nil, fmt.Errorf("The images of revision %d of deployment %q take %d characters to record in the %s%d tag, Azure limits tag values to %d, shorten the container names or image references: %s", rev, deploymentName, length, RevisionHistoryTagPrefix, rev, maxTagValueLength, images)
+		}
+		tags[RevisionHistoryTagPrefix+strconv.Itoa(rev)] = images
+	}
+
+	return tags, nil
+}
+
+// recordReplicas sets the ReplicasTag of every replica of the deployment to
+// the number of replicas it should have.
+func recordReplicas(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, deploymentName string, replicas int) error {
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	value := strconv.Itoa(replicas)
+	for _, cg := range owned {
+		if cg.Tags == nil || cg.Tags[ReplicasTag] == value {
+			continue
+		}
+
+		tags := map[string]string{}
+		for key, tagValue := range cg.Tags {
+			tags[key] = tagValue
+		}
+		tags[ReplicasTag] = value
+
+		if _, err := aciClient.UpdateContainerGroupTags(ctx, resourceGroup, cg.Name, tags); err != nil {
+			return fmt.Errorf("Recording the replica count of deployment %s on container group %s failed: %w", deploymentName, cg.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// getRevisionHistory returns the revision history recorded on the container group.
+func getRevisionHistory(cg client.ContainerGroup) map[int]string {
+	history := map[int]string{}
+	for key, value := range cg.Tags {
+		if !strings.HasPrefix(key, RevisionHistoryTagPrefix) {
+			continue
+		}
+
+		revision, err := strconv.Atoi(strings.TrimPrefix(key, RevisionHistoryTagPrefix))
+		if err != nil {
+			continue
+		}
+
+		history[revision] = value
+	}
+
+	return history
+}
+
+// formatImages records the image of every container as name=image pairs.
+func formatImages(cg *client.ContainerGroup) string {
+	images := make([]string, 0, len(cg.Containers))
+	for _, container := range cg.Containers {
+		images = append(images, container.Name+"="+container.Image)
+	}
+
+	return strings.Join(images, ",")
+}
+
+// parseImages is the inverse of formatImages.
+func parseImages(record string) (map[string]string, error) {
+	images := map[string]string{}
+	for _, pair := range strings.Split(record, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid revision record: %q", record)
+		}
+		images[parts[0]] = parts[1]
+	}
+
+	return images, nil
+}
+
+// formatStrategy records the deployment strategy as its type followed by the
+// maxSurge and maxUnavailable set for rolling updates, for example
+// RollingUpdate,maxSurge=25%,maxUnavailable=0.
+func formatStrategy(strategy v1beta1.DeploymentStrategy) string {
+	record := string(strategy.Type)
+	if record == "" {
+		record = string(v1beta1.RollingUpdateDeploymentStrategyType)
+	}
+
+	if strategy.RollingUpdate != nil {
+		if strategy.RollingUpdate.MaxSurge != nil {
+			record += ",maxSurge=" + strategy.RollingUpdate.MaxSurge.String()
+		}
+		if strategy.RollingUpdate.MaxUnavailable != nil {
+			record += ",maxUnavailable=" + strategy.RollingUpdate.MaxUnavailable.String()
+		}
+	}
+
+	return record
+}
+
+// parseStrategy is the inverse of formatStrategy. Groups without a recorded
+// strategy roll out with the default one.
+func parseStrategy(record string) (v1beta1.DeploymentStrategy, error) {
+	strategy := v1beta1.DeploymentStrategy{}
+	if record == "" {
+		return strategy, nil
+	}
+
+	parts := strings.Split(record, ",")
+	strategy.Type = v1beta1.DeploymentStrategyType(parts[0])
+	for _, part := range parts[1:] {
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return strategy, fmt.Errorf("Invalid strategy record: %q", record)
+		}
+
+		value := intstr.Parse(pair[1])
+		if strategy.RollingUpdate == nil {
+			strategy.RollingUpdate = &v1beta1.RollingUpdateDeployment{}
+		}
+
+		switch pair[0] {
+		case "maxSurge":
+			strategy.RollingUpdate.MaxSurge = &value
+		case "maxUnavailable":
+			strategy.RollingUpdate.MaxUnavailable = &value
+		default:
+			return strategy, fmt.Errorf("Invalid strategy record: %q", record)
+		}
+	}
+
+	return strategy, nil
+}
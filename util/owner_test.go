@@ -0,0 +1,50 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestOwnerTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		history map[int]string
+		wantErr bool
+	}{
+		{
+			name:    "short images",
+			history: map[int]string{1: "web=nginx", 2: "web=nginx:1.15"},
+		},
+		{
+			name:    "images at the limit",
+			history: map[int]string{1: "web=" + strings.Repeat("a", maxTagValueLength-4)},
+		},
+		{
+			name:    "images over the limit",
+			history: map[int]string{1: "web=nginx", 2: "web=" + strings.Repeat("a", maxTagValueLength-3)},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags, err := ownerTags("web", 2, "hash", test.history)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "acictl-rev-2") {
+					t.Errorf("ownerTags returned %v, want an error naming the tag acictl-rev-2", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for rev, images := range test.history {
+				if value := tags[RevisionHistoryTagPrefix+strconv.Itoa(rev)]; value != images {
+					t.Errorf("Tag of revision %d is %q, want %q", rev, value, images)
+				}
+			}
+		})
+	}
+}
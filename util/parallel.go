@@ -0,0 +1,168 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+var (
+	// Parallelism is the number of container groups changed concurrently.
+	Parallelism = 5
+
+	// FailFast stops starting work on further container groups after the
+	// first failure, instead of trying every container group.
+	FailFast = false
+
+	actionPastTense = map[string]string{
+		"create":  "created",
+		"delete":  "deleted",
+		"restart": "restarted",
+		"stop":    "stopped",
+		"start":   "started",
+	}
+)
+
+// ContainerGroupError is the failure of an operation on a single container group.
+type ContainerGroupError struct {
+	Name string
+	Err  error
+}
+
+// ContainerGroupErrors lists every container group an operation failed for,
+// and the ones it skipped after failing fast.
+type ContainerGroupErrors struct {
+	Action  string
+	Total   int
+	Errors  []ContainerGroupError
+	Skipped []string
+}
+
+func (e *ContainerGroupErrors) Error() string {
+	lines := []string{fmt.Sprintf("Failed to %s %d of %d container groups:", e.Action, len(e.Errors), e.Total)}
+	for _, cgErr := range e.Errors {
+		lines = append(lines, fmt.Sprintf("  %s: %s", cgErr.Name, cgErr.Err))
+	}
+
+	if len(e.Skipped) > 0 {
+		lines = append(lines, fmt.Sprintf("Skipped after the first failure: %s", strings.Join(e.Skipped, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the error of every failed container group.
+func (e *ContainerGroupErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, cgErr := range e.Errors {
+		errs = append(errs, cgErr.Err)
+	}
+
+	return errs
+}
+
+// ValidateParallelism returns an error if parallelism is not positive.
+func ValidateParallelism(parallelism int) error {
+	if parallelism < 1 {
+		return fmt.Errorf("Parallelism must be at least 1, got %d", parallelism)
+	}
+
+	return nil
+}
+
+// runParallel calls fn for every named container group, with at most
+// Parallelism calls in flight, and prints the progress. Successful calls are
+// recorded in done. Failures are collected in a ContainerGroupErrors, unless
+// ctx is cancelled, in which case the error reports what was completed.
+func runParallel(ctx context.Context, action string, names []string, done *progress, fn func(ctx context.Context, name string) error) error {
+	workers := Parallelism
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+
+	var (
+		mu       sync.Mutex
+		failed   = map[string]error{}
+		finished int
+	)
+
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for name := range work {
+				err := fn(ctx, name)
+
+				mu.Lock()
+				finished++
+				if err != nil {
+					failed[name] = err
+					fmt.Printf("Failed to %s container group %s (%d/%d): %s\n", action, name, finished, len(names), err)
+				} else {
+					done.add(actionPastTense[action], name)
+					fmt.Printf("Container group %s %s (%d/%d)\n", name, actionPastTense[action], finished, len(names))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var skipped []string
+dispatch:
+	for i, name := range names {
+		mu.Lock()
+		stop := FailFast && len(failed) > 0
+		mu.Unlock()
+
+		if stop {
+			skipped = names[i:]
+			break
+		}
+
+		select {
+		case work <- name:
+		case <-ctx.Done():
+			skipped = names[i:]
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if len(failed) == 0 && len(skipped) == 0 {
+		return nil
+	}
+
+	errs := &ContainerGroupErrors{Action: action, Total: len(names)}
+	for _, name := range names {
+		if err, ok := failed[name]; ok {
+			errs.Errors = append(errs.Errors, ContainerGroupError{Name: name, Err: err})
+		}
+	}
+
+	if ctx.Err() != nil {
+		return done.interrupted(ctx, errs)
+	}
+	errs.Skipped = skipped
+
+	return errs
+}
+
+// containerGroupNames returns the names of the container groups.
+func containerGroupNames(cgs []client.ContainerGroup) []string {
+	names := make([]string, 0, len(cgs))
+	for _, cg := range cgs {
+		names = append(names, cg.Name)
+	}
+
+	return names
+}
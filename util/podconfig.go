@@ -0,0 +1,147 @@
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"k8s.io/api/core/v1"
+
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// resolveConfigReferences returns the pod spec with the environment variables
+// its containers take from ConfigMaps and Secrets set to their values, and the
+// ACI secret volumes holding its ConfigMap and Secret volumes. References are
+// resolved against the ConfigMaps and Secrets of the kustomization or chart,
+// without one they are left to the translator, which ignores them.
+func resolveConfigReferences(spec v1.PodSpec) (v1.PodSpec, []client.Volume, error) {
+	if manifestConfigs == nil {
+		return spec, nil, nil
+	}
+
+	lookup := func(kind string, name string, optional *bool) (map[string][]byte, error) {
+		data, ok := manifestConfigs[kind+"/"+name]
+		if !ok && (optional == nil || !*optional) {
+			return nil, fmt.Errorf("The %s %s is not defined by the kustomization or chart", kind, name)
+		}
+		return data, nil
+	}
+
+	containers := make([]v1.Container, len(spec.Containers))
+	for i, container := range spec.Containers {
+		// Like in Kubernetes, later sources override earlier ones, and the
+		// variables of env override all of them.
+		fromSources := map[string]string{}
+		for _, source := range container.EnvFrom {
+			var data map[string][]byte
+			var err error
+			switch {
+			case source.ConfigMapRef != nil:
+				data, err = lookup("ConfigMap", source.ConfigMapRef.Name, source.ConfigMapRef.Optional)
+			case source.SecretRef != nil:
+				data, err = lookup("Secret", source.SecretRef.Name, source.SecretRef.Optional)
+			}
+			if err != nil {
+				return spec, nil, fmt.Errorf("Container %s: %v", container.Name, err)
+			}
+
+			for key, value := range data {
+				fromSources[source.Prefix+key] = string(value)
+			}
+		}
+		for _, env := range container.Env {
+			delete(fromSources, env.Name)
+		}
+
+		names := make([]string, 0, len(fromSources))
+		for name := range fromSources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		env := make([]v1.EnvVar, 0, len(names)+len(container.Env))
+		for _, name := range names {
+			env = append(env, v1.EnvVar{Name: name, Value: fromSources[name]})
+		}
+
+		for _, variable := range container.Env {
+			if variable.ValueFrom != nil {
+				var kind, name, key string
+				var optional *bool
+				switch {
+				case variable.ValueFrom.ConfigMapKeyRef != nil:
+					ref := variable.ValueFrom.ConfigMapKeyRef
+					kind, name, key, optional = "ConfigMap", ref.Name, ref.Key, ref.Optional
+				case variable.ValueFrom.SecretKeyRef != nil:
+					ref := variable.ValueFrom.SecretKeyRef
+					kind, name, key, optional = "Secret", ref.Name, ref.Key, ref.Optional
+				}
+
+				if kind != "" {
+					data, err := lookup(kind, name, optional)
+					if err != nil {
+						return spec, nil, fmt.Errorf("Environment variable %s of container %s: %v", variable.Name, container.Name, err)
+					}
+
+					value, ok := data[key]
+					if !ok {
+						if optional != nil && *optional {
+							continue
+						}
+						return spec, nil, fmt.Errorf("Environment variable %s of container %s: the %s %s has no key %s", variable.Name, container.Name, kind, name, key)
+					}
+					variable = v1.EnvVar{Name: variable.Name, Value: string(value)}
+				}
+			}
+			env = append(env, variable)
+		}
+
+		container.Env = env
+		container.EnvFrom = nil
+		containers[i] = container
+	}
+	spec.Containers = containers
+
+	var volumes []client.Volume
+	for _, volume := range spec.Volumes {
+		var kind, name string
+		var items []v1.KeyToPath
+		var optional *bool
+		switch {
+		case volume.ConfigMap != nil:
+			kind, name, items, optional = "ConfigMap", volume.ConfigMap.Name, volume.ConfigMap.Items, volume.ConfigMap.Optional
+		case volume.Secret != nil:
+			kind, name, items, optional = "Secret", volume.Secret.SecretName, volume.Secret.Items, volume.Secret.Optional
+		default:
+			continue
+		}
+
+		data, err := lookup(kind, name, optional)
+		if err != nil {
+			return spec, nil, fmt.Errorf("Volume %s: %v", volume.Name, err)
+		}
+
+		// ACI secret volumes hold base64 encoded files.
+		files := map[string]string{}
+		if len(items) == 0 {
+			for key, value := range data {
+				files[key] = base64.StdEncoding.EncodeToString(value)
+			}
+		}
+		for _, item := range items {
+			value, ok := data[item.Key]
+			if !ok {
+				if optional != nil && *optional {
+					continue
+				}
+				return spec, nil, fmt.Errorf("Volume %s: the %s %s has no key %s", volume.Name, kind, name, item.Key)
+			}
+			files[item.Path] = base64.StdEncoding.EncodeToString(value)
+		}
+
+		volumes = append(volumes, client.Volume{Name: volume.Name, Secret: files})
+	}
+
+	return spec, volumes, nil
+}
@@ -0,0 +1,64 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// progress records the container groups an operation has changed, so that an
+// interrupted operation can report exactly what it completed. It is safe for
+// concurrent use.
+type progress struct {
+	mu        sync.Mutex
+	completed []string
+}
+
+// add records that action, such as "created", completed for the container group.
+func (p *progress) add(action string, containerGroupName string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.completed = append(p.completed, action+" "+containerGroupName)
+}
+
+// interrupted replaces err with a report of the completed container groups
+// when it was caused by the cancellation of ctx.
+func (p *progress) interrupted(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	completed := "nothing"
+	if len(p.completed) > 0 {
+		completed = strings.Join(p.completed, ", ")
+	}
+
+	return fmt.Errorf("Operation cancelled (%s), completed before cancellation: %s", ctx.Err(), completed)
+}
+
+// pollImmediate runs condition right away and then every interval until it
+// returns true or an error. It returns wait.ErrWaitTimeout once timeout expires
+// and the error of ctx once ctx is done.
+func pollImmediate(ctx context.Context, interval time.Duration, timeout time.Duration, condition wait.ConditionFunc) error {
+	if done, err := condition(); err != nil || done {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := wait.PollUntil(interval, condition, waitCtx.Done())
+	if err == wait.ErrWaitTimeout && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
@@ -0,0 +1,626 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+var (
+	// DefaultRolloutTimeout matches the Kubernetes default progressDeadlineSeconds.
+	DefaultRolloutTimeout = 10 * time.Minute
+	// DefaultRevisionHistoryLimit is the number of revisions recorded when the
+	// deployment does not set revisionHistoryLimit.
+	DefaultRevisionHistoryLimit = 10
+
+	rolloutPollInterval = 5 * time.Second
+)
+
+// rollout replaces the container groups of a deployment with groups built
+// from a new template, following the deployment strategy.
+type rollout struct {
+	aciClient     aci.ContainerGroupClient
+	resourceGroup string
+	name          string
+	template      *client.ContainerGroup
+	replicas      int
+	strategy      v1beta1.DeploymentStrategy
+	historyLimit  int
+	timeout       time.Duration
+	// source is recorded in the SyncTag of the new replicas when set.
+	source string
+
+	tags map[string]string
+	done progress
+}
+
+// Apply creates the deployment or rolls the existing deployment out to the
+// spec in the deployment file.
+func Apply(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentFile string, resourceGroup string, region string, timeout time.Duration) error {
+	deployment, err := GetDeploymentFromFile(deploymentFile)
+	if err != nil {
+		return err
+	}
+
+	r, err := newRollout(aciClient, deployment, resourceGroup, region, timeout)
+	if err != nil {
+		return err
+	}
+
+	return r.run(ctx)
+}
+
+// newRollout returns the rollout of the deployment to its spec.
+func newRollout(aciClient aci.ContainerGroupClient, deployment *v1beta1.Deployment, resourceGroup string, region string, timeout time.Duration) (*rollout, error) {
+	template, err := ContainerGroupFromDeployment(deployment, region)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rollout{
+		aciClient:     aciClient,
+		resourceGroup: resourceGroup,
+		name:          deployment.Name,
+		template:      template,
+		replicas:      int(getReplicas(deployment)),
+		strategy:      deployment.Spec.Strategy,
+		historyLimit:  DefaultRevisionHistoryLimit,
+		timeout:       timeout,
+	}
+
+	if deployment.Spec.RevisionHistoryLimit != nil {
+		r.historyLimit = int(*deployment.Spec.RevisionHistoryLimit)
+	}
+
+	if r.timeout == 0 && deployment.Spec.ProgressDeadlineSeconds != nil {
+		r.timeout = time.Duration(*deployment.Spec.ProgressDeadlineSeconds) * time.Second
+	}
+
+	return r, nil
+}
+
+// RolloutStatus prints the progress of the latest rollout of the deployment,
+// optionally waiting until it completes.
+func RolloutStatus(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentName string, resourceGroup string, watch bool, timeout time.Duration) error {
+	if timeout == 0 {
+		timeout = DefaultRolloutTimeout
+	}
+
+	checkStatus := func() (bool, error) {
+		owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deploymentName)
+		if err != nil {
+			return false, err
+		}
+
+		if len(owned) == 0 {
+			return false, fmt.Errorf("Deployment %q not found in resource group %s", deploymentName, resourceGroup)
+		}
+
+		latest := latestRevision(owned)
+
+		old, updated, available := 0, 0, 0
+		for _, cg := range owned {
+			if GetRevision(cg) != latest {
+				old++
+				continue
+			}
+
+			updated++
+			current, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, cg.Name)
+			if err != nil {
+				return false, err
+			}
+			if isContainerGroupReady(current) {
+				available++
+			}
+		}
+
+		switch {
+		case old > 0:
+			fmt.Printf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...\n", deploymentName, old)
+		case available < updated:
+			fmt.Printf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...\n", deploymentName, available, updated)
+		default:
+			fmt.Printf("deployment %q successfully rolled out to revision %d\n", deploymentName, latest)
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	if !watch {
+		_, err := checkStatus()
+		return err
+	}
+
+	return pollImmediate(ctx, rolloutPollInterval, timeout, checkStatus)
+}
+
+// RolloutHistory prints the revisions recorded for the deployment.
+func RolloutHistory(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentName string, resourceGroup string) error {
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	if len(owned) == 0 {
+		return fmt.Errorf("Deployment %q not found in resource group %s", deploymentName, resourceGroup)
+	}
+
+	latest := latestRevision(owned)
+	history := getRevisionHistory(latestContainerGroup(owned))
+
+	revisions := make([]int, 0, len(history))
+	for revision := range history {
+		revisions = append(revisions, revision)
+	}
+	sort.Ints(revisions)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tIMAGES\t")
+	for _, revision := range revisions {
+		current := ""
+		if revision == latest {
+			current = " (current)"
+		}
+		fmt.Fprintf(w, "%d%s\t%s\t\n", revision, current, strings.Replace(history[revision], ",", ", ", -1))
+	}
+
+	return w.Flush()
+}
+
+// RolloutUndo rolls the deployment back to a previous revision, or to the
+// revision before the current one when toRevision is 0. Revisions only record
+// container images, so the rest of the spec is taken from the deployment file
+// when one is given and from the live replicas otherwise, and the strategy
+// from the one recorded on them.
+func RolloutUndo(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentName string, deploymentFile string, resourceGroup string, region string, toRevision int, timeout time.Duration) error {
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	if len(owned) == 0 {
+		return fmt.Errorf("Deployment %q not found in resource group %s", deploymentName, resourceGroup)
+	}
+
+	latest := latestRevision(owned)
+	history := getRevisionHistory(latestContainerGroup(owned))
+
+	if toRevision == 0 {
+		for revision := range history {
+			if revision < latest && revision > toRevision {
+				toRevision = revision
+			}
+		}
+	}
+
+	record, ok := history[toRevision]
+	if !ok || toRevision == 0 {
+		return fmt.Errorf("Unable to find a previous revision of deployment %q", deploymentName)
+	}
+
+	images, err := parseImages(record)
+	if err != nil {
+		return err
+	}
+
+	strategy, err := parseStrategy(latestContainerGroup(owned).Tags[StrategyTag])
+	if err != nil {
+		return err
+	}
+
+	template, err := undoTemplate(ctx, aciClient, latestContainerGroup(owned), deploymentName, deploymentFile, resourceGroup, region)
+	if err != nil {
+		return err
+	}
+	for i, container := range template.Containers {
+		if image, ok := images[container.Name]; ok {
+			template.Containers[i].Image = image
+		}
+	}
+
+	replicas := 0
+	for _, cg := range owned {
+		if GetRevision(cg) == latest {
+			replicas++
+		}
+	}
+
+	fmt.Printf("Rolling back deployment %q to revision %d.\n", deploymentName, toRevision)
+
+	r := &rollout{
+		aciClient:     aciClient,
+		resourceGroup: resourceGroup,
+		name:          deploymentName,
+		template:      template,
+		replicas:      replicas,
+		strategy:      strategy,
+		historyLimit:  DefaultRevisionHistoryLimit,
+		timeout:       timeout,
+	}
+
+	return r.run(ctx)
+}
+
+// undoTemplate returns the spec a rollback starts from, the one of the
+// deployment file when given, or else a copy of the latest replica.
+func undoTemplate(ctx context.Context, aciClient aci.ContainerGroupClient, latest client.ContainerGroup, deploymentName string, deploymentFile string, resourceGroup string, region string) (*client.ContainerGroup, error) {
+	if deploymentFile != "" {
+		template, _, err := manifestTemplate(deploymentName, deploymentFile, region)
+		return template, err
+	}
+
+	return copyReplica(ctx, aciClient, latest, deploymentName, resourceGroup)
+}
+
+func (r *rollout) run(ctx context.Context) error {
+	if r.timeout == 0 {
+		r.timeout = DefaultRolloutTimeout
+	}
+
+	owned, err := ListOwnedContainerGroups(ctx, r.aciClient, r.resourceGroup, r.name)
+	if err != nil {
+		return err
+	}
+
+	templateHash, err := TemplateHash(r.template)
+	if err != nil {
+		return err
+	}
+
+	// Reuse the revision of groups that already run this template, such as
+	// those left behind by an interrupted rollout.
+	revision := 0
+	for _, cg := range owned {
+		if cg.Tags[TemplateHashTag] == templateHash {
+			revision = GetRevision(cg)
+		}
+	}
+
+	history := map[int]string{}
+	if len(owned) > 0 {
+		history = getRevisionHistory(latestContainerGroup(owned))
+		if revision == 0 {
+			revision = latestRevision(owned) + 1
+		}
+	}
+	if revision == 0 {
+		revision = 1
+	}
+
+	history[revision] = formatImages(r.template)
+	pruneRevisionHistory(history, r.historyLimit, revision)
+	r.tags, err = ownerTags(r.name, revision, templateHash, history)
+	if err != nil {
+		return err
+	}
+	r.tags[ReplicasTag] = strconv.Itoa(r.replicas)
+	r.tags[StrategyTag] = formatStrategy(r.strategy)
+	if r.source != "" {
+		r.tags[SyncTag] = r.source
+	}
+
+	var old, current []client.ContainerGroup
+	for _, cg := range owned {
+		if cg.Tags[TemplateHashTag] == templateHash {
+			current = append(current, cg)
+		} else {
+			old = append(old, cg)
+		}
+	}
+
+	sortForDeletion(old)
+
+	fmt.Printf("Rolling out revision %d of deployment %s.\n", revision, r.name)
+
+	if r.strategy.Type == v1beta1.RecreateDeploymentStrategyType {
+		err = r.recreate(ctx, old, current)
+	} else {
+		err = r.rollingUpdate(ctx, old, current)
+	}
+	if err == nil {
+		// Replicas kept from an earlier rollout record the former count.
+		err = recordReplicas(ctx, r.aciClient, r.resourceGroup, r.name, r.replicas)
+	}
+	if err != nil {
+		return r.done.interrupted(ctx, err)
+	}
+
+	fmt.Printf("Deployment %s successfully rolled out to revision %d.\n", r.name, revision)
+
+	return nil
+}
+
+// recreate deletes every old replica before creating the new ones.
+func (r *rollout) recreate(ctx context.Context, old, current []client.ContainerGroup) error {
+	if err := r.deleteReplicas(ctx, old); err != nil {
+		return err
+	}
+
+	return r.scaleCurrent(ctx, current)
+}
+
+// rollingUpdate replaces the old replicas in batches, never running more than
+// replicas+maxSurge groups or fewer than replicas-maxUnavailable available ones.
+func (r *rollout) rollingUpdate(ctx context.Context, old, current []client.ContainerGroup) error {
+	maxSurge, maxUnavailable, err := r.resolveFenceposts()
+	if err != nil {
+		return err
+	}
+
+	for len(old) > 0 {
+		total := len(old) + len(current)
+
+		scaleUp := minInt(r.replicas-len(current), r.replicas+maxSurge-total)
+		if scaleUp > 0 {
+			created, err := r.createReplicas(ctx, scaleUp)
+			current = append(current, created...)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// New replicas are only kept once they are available, so everything
+		// above the minimum available count can be removed from the old set.
+		scaleDown := minInt(len(old), total-(r.replicas-maxUnavailable))
+		if scaleDown <= 0 {
+			return fmt.Errorf("Rollout of deployment %s can not make progress with maxSurge %d and maxUnavailable %d", r.name, maxSurge, maxUnavailable)
+		}
+
+		if err := r.deleteReplicas(ctx, old[:scaleDown]); err != nil {
+			return err
+		}
+		old = old[scaleDown:]
+	}
+
+	return r.scaleCurrent(ctx, current)
+}
+
+// scaleCurrent creates or deletes replicas of the new revision until the
+// desired replica count is reached.
+func (r *rollout) scaleCurrent(ctx context.Context, current []client.ContainerGroup) error {
+	if missing := r.replicas - len(current); missing > 0 {
+		_, err := r.createReplicas(ctx, missing)
+		return err
+	}
+
+	sortForDeletion(current)
+
+	return r.deleteReplicas(ctx, current[:len(current)-r.replicas])
+}
+
+// resolveFenceposts returns maxSurge and maxUnavailable as absolute numbers,
+// using the extensions/v1beta1 defaults when they are not set.
+func (r *rollout) resolveFenceposts() (int, int, error) {
+	surge := intstr.FromInt(1)
+	unavailable := intstr.FromInt(1)
+
+	if r.strategy.RollingUpdate != nil {
+		if r.strategy.RollingUpdate.MaxSurge != nil {
+			surge = *r.strategy.RollingUpdate.MaxSurge
+		}
+		if r.strategy.RollingUpdate.MaxUnavailable != nil {
+			unavailable = *r.strategy.RollingUpdate.MaxUnavailable
+		}
+	}
+
+	maxSurge, err := intstr.GetValueFromIntOrPercent(&surge, r.replicas, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid maxSurge: %s", err)
+	}
+
+	maxUnavailable, err := intstr.GetValueFromIntOrPercent(&unavailable, r.replicas, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid maxUnavailable: %s", err)
+	}
+
+	// Like Kubernetes, a rollout with no surge and no unavailability would
+	// never progress, so allow one replica to be unavailable.
+	if maxSurge == 0 && maxUnavailable == 0 {
+		maxUnavailable = 1
+	}
+
+	return maxSurge, maxUnavailable, nil
+}
+
+// createReplicas creates count replicas of the new template and waits for
+// them to become available.
+func (r *rollout) createReplicas(ctx context.Context, count int) ([]client.ContainerGroup, error) {
+	namer, err := newReplicaNamer(ctx, r.aciClient, r.resourceGroup, r.name, r.tags[TemplateHashTag])
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := map[string]client.ContainerGroup{}
+	names := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		cg := *r.template
+		cg.Tags = r.tags
+		cg.Name, err = namer.next()
+		if err != nil {
+			return nil, err
+		}
+
+		replicas[cg.Name] = cg
+		names = append(names, cg.Name)
+	}
+
+	var created []client.ContainerGroup
+	var mu sync.Mutex
+	err = runParallel(ctx, "create", names, &r.done, func(ctx context.Context, name string) error {
+		fmt.Printf("Creating Container Group %s.\n", name)
+
+		if _, err := r.aciClient.CreateContainerGroup(ctx, r.resourceGroup, name, replicas[name]); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		created = append(created, replicas[name])
+		mu.Unlock()
+
+		return nil
+	})
+	if err != nil {
+		return created, err
+	}
+
+	return created, r.waitForReplicas(ctx, created)
+}
+
+// waitForReplicas waits until every container group is running.
+func (r *rollout) waitForReplicas(ctx context.Context, cgs []client.ContainerGroup) error {
+	names := make([]string, 0, len(cgs))
+	for _, cg := range cgs {
+		names = append(names, cg.Name)
+	}
+
+	return waitForContainerGroups(ctx, r.aciClient, r.resourceGroup, names, r.timeout)
+}
+
+// waitForContainerGroups waits until every named container group is running,
+// failing early if one of them fails.
+func waitForContainerGroups(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, names []string, timeout time.Duration) error {
+	pending := map[string]bool{}
+	for _, name := range names {
+		pending[name] = true
+	}
+
+	err := pollImmediate(ctx, rolloutPollInterval, timeout, func() (bool, error) {
+		for name := range pending {
+			cg, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, name)
+			if err != nil {
+				return false, err
+			}
+
+			if isContainerGroupFailed(cg) {
+				return false, fmt.Errorf("Container group %s failed to start", name)
+			}
+
+			if isContainerGroupReady(cg) {
+				delete(pending, name)
+			}
+		}
+
+		return len(pending) == 0, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Timed out after %s waiting for container groups %s to become available", timeout, strings.Join(names, ", "))
+	}
+
+	return err
+}
+
+// waitForDeletion waits until the container group is not found anymore.
+func waitForDeletion(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, name string) error {
+	err := pollImmediate(ctx, rolloutPollInterval, DefaultRolloutTimeout, func() (bool, error) {
+		_, err, status := aciClient.GetContainerGroup(ctx, resourceGroup, name)
+		if status != nil && *status == http.StatusNotFound {
+			return true, nil
+		}
+
+		return false, err
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Timed out after %s waiting for container group %s to be deleted", DefaultRolloutTimeout, name)
+	}
+
+	return err
+}
+
+func (r *rollout) deleteReplicas(ctx context.Context, cgs []client.ContainerGroup) error {
+	return runParallel(ctx, "delete", containerGroupNames(cgs), &r.done, func(ctx context.Context, name string) error {
+		fmt.Printf("Deleting container group %s\n", name)
+		if err := r.aciClient.DeleteContainerGroup(ctx, r.resourceGroup, name); err != nil {
+			return fmt.Errorf("Delete container group error: %w", err)
+		}
+		return nil
+	})
+}
+
+// isContainerGroupReady reports whether the group is provisioned and running.
+func isContainerGroupReady(cg *client.ContainerGroup) bool {
+	return cg.ProvisioningState == "Succeeded" && cg.InstanceView.State == "Running"
+}
+
+// isContainerGroupFailed reports whether the group will never become ready.
+func isContainerGroupFailed(cg *client.ContainerGroup) bool {
+	return cg.ProvisioningState == "Failed" || cg.InstanceView.State == "Failed"
+}
+
+// sortForDeletion orders container groups so that groups that did not
+// provision successfully and groups of older revisions come first.
+func sortForDeletion(cgs []client.ContainerGroup) {
+	sort.SliceStable(cgs, func(i, j int) bool {
+		iProvisioned := cgs[i].ProvisioningState == "Succeeded"
+		jProvisioned := cgs[j].ProvisioningState == "Succeeded"
+		if iProvisioned != jProvisioned {
+			return !iProvisioned
+		}
+
+		return GetRevision(cgs[i]) < GetRevision(cgs[j])
+	})
+}
+
+// pruneRevisionHistory removes the oldest revisions until at most limit
+// revisions besides the current one remain.
+func pruneRevisionHistory(history map[int]string, limit int, current int) {
+	revisions := make([]int, 0, len(history))
+	for revision := range history {
+		if revision != current {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Ints(revisions)
+
+	for len(revisions) > limit {
+		delete(history, revisions[0])
+		revisions = revisions[1:]
+	}
+}
+
+func latestRevision(cgs []client.ContainerGroup) int {
+	latest := 0
+	for _, cg := range cgs {
+		if revision := GetRevision(cg); revision > latest {
+			latest = revision
+		}
+	}
+
+	return latest
+}
+
+// latestContainerGroup returns a container group of the latest revision.
+func latestContainerGroup(cgs []client.ContainerGroup) client.ContainerGroup {
+	latest := cgs[0]
+	for _, cg := range cgs {
+		if GetRevision(cg) > GetRevision(latest) {
+			latest = cg
+		}
+	}
+
+	return latest
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
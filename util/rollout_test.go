@@ -0,0 +1,123 @@
+package util
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/samkreter/acictl/aci/fake"
+)
+
+// strategyManifest returns a deployment of 3 replicas of image with the
+// strategy, given as the YAML of the strategy field.
+func strategyManifest(image string, strategy string) string {
+	return strings.Replace(deploymentManifest("web", 3, image), "  replicas: 3\n", "  replicas: 3\n  strategy:\n"+strategy, 1)
+}
+
+func TestRolloutUndo(t *testing.T) {
+	const rollingUpdate = "    type: RollingUpdate\n    rollingUpdate:\n      maxSurge: 0\n      maxUnavailable: 2\n"
+	const recreate = "    type: Recreate\n"
+
+	tests := []struct {
+		name         string
+		deployment   string
+		strategy     string
+		toRevision   int
+		wantImage    string
+		wantRevision int
+		wantStrategy string
+		wantErr      bool
+	}{
+		{
+			name:         "previous revision",
+			deployment:   "web",
+			strategy:     rollingUpdate,
+			wantImage:    "nginx:1.15",
+			wantRevision: 4,
+			wantStrategy: "RollingUpdate,maxSurge=0,maxUnavailable=2",
+		},
+		{
+			name:         "to revision",
+			deployment:   "web",
+			strategy:     recreate,
+			toRevision:   1,
+			wantImage:    "nginx:1.14",
+			wantRevision: 4,
+			wantStrategy: "Recreate",
+		},
+		{
+			name:       "unknown revision",
+			deployment: "web",
+			strategy:   recreate,
+			toRevision: 7,
+			wantErr:    true,
+		},
+		{
+			name:       "unknown deployment",
+			deployment: "api",
+			strategy:   recreate,
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+			ctx := context.Background()
+			aciClient := fake.NewClient()
+
+			for _, image := range []string{"nginx:1.14", "nginx:1.15", "nginx:1.16"} {
+				if err := Apply(ctx, aciClient, writeManifest(t, strategyManifest(image, test.strategy)), testResourceGroup, "westus", 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := RolloutUndo(ctx, aciClient, test.deployment, "", testResourceGroup, "westus", test.toRevision, 0)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("RolloutUndo succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RolloutUndo failed: %v", err)
+			}
+
+			groups := listGroups(t, aciClient)
+			if want := []string{test.wantImage, test.wantImage, test.wantImage}; !reflect.DeepEqual(images(groups), want) {
+				t.Errorf("RolloutUndo left the images %v, want %v", images(groups), want)
+			}
+
+			for _, cg := range groups {
+				if GetRevision(cg) != test.wantRevision {
+					t.Errorf("Container group %s has revision %d, want %d", cg.Name, GetRevision(cg), test.wantRevision)
+				}
+				if cg.Tags[StrategyTag] != test.wantStrategy {
+					t.Errorf("Container group %s rolled back with the strategy %q, want %q", cg.Name, cg.Tags[StrategyTag], test.wantStrategy)
+				}
+			}
+		})
+	}
+}
+
+func TestStrategyRecord(t *testing.T) {
+	for _, record := range []string{"", "Recreate", "RollingUpdate", "RollingUpdate,maxSurge=25%,maxUnavailable=0", "RollingUpdate,maxUnavailable=1"} {
+		strategy, err := parseStrategy(record)
+		if err != nil {
+			t.Fatalf("parseStrategy(%q) failed: %v", record, err)
+		}
+
+		want := record
+		if want == "" {
+			want = "RollingUpdate"
+		}
+		if got := formatStrategy(strategy); got != want {
+			t.Errorf("formatStrategy(parseStrategy(%q)) = %q, want %q", record, got, want)
+		}
+	}
+
+	if _, err := parseStrategy("RollingUpdate,maxSurge"); err == nil {
+		t.Error("parseStrategy of an invalid record succeeded")
+	}
+}
@@ -0,0 +1,295 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+var (
+	runLogInterval = 2 * time.Second
+
+	// runCleanupTimeout bounds the deletion of the container group of
+	// 'acictl run --rm' after an interruption.
+	runCleanupTimeout = time.Minute
+)
+
+// RunOptions describes the container group created by RunContainer.
+type RunOptions struct {
+	Name  string
+	Image string
+	Ports []int
+	// Env holds KEY=VALUE pairs.
+	Env []string
+	// CPU and Memory are Kubernetes quantities, such as 0.5 and 1.5Gi.
+	CPU    string
+	Memory string
+	// Command replaces the entrypoint of the image, it is split into words
+	// like a shell does.
+	Command       string
+	RestartPolicy string
+	DNSLabel      string
+
+	// Attach streams the logs of the container until it exits, and Remove
+	// deletes the container group then.
+	Attach bool
+	Remove bool
+}
+
+// RunContainer creates a container group running a single container, like a
+// pod created by 'kubectl run'. It is translated from a deployment of one
+// replica, so it carries the same ownership tags as the replicas of
+// deployments. With Attach set, it returns the exit code of the container.
+func RunContainer(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, region string, opts RunOptions) (int32, error) {
+	deployment, err := deploymentFromRunOptions(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	containerGroup, err := ContainerGroupFromDeployment(deployment, region)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.DNSLabel != "" {
+		if containerGroup.IPAddress == nil {
+			return 0, fmt.Errorf("A DNS name label needs a public IP address, expose a port with --port")
+		}
+		containerGroup.IPAddress.DNSNameLabel = opts.DNSLabel
+	}
+
+	templateHash, err := TemplateHash(containerGroup)
+	if err != nil {
+		return 0, err
+	}
+
+	containerGroup.Name = opts.Name
+	containerGroup.Tags, err = ownerTags(opts.Name, 1, templateHash, map[int]string{
+		1: formatImages(containerGroup),
+	})
+	if err != nil {
+		return 0, err
+	}
+	containerGroup.Tags[ReplicasTag] = "1"
+
+	_, err, status := aciClient.GetContainerGroup(ctx, resourceGroup, opts.Name)
+	if err == nil {
+		return 0, fmt.Errorf("Container group %s already exists in resource group %s", opts.Name, resourceGroup)
+	}
+	if status == nil || *status != http.StatusNotFound {
+		return 0, err
+	}
+
+	fmt.Printf("Creating Container Group %s.\n", opts.Name)
+	if _, err := aciClient.CreateContainerGroup(ctx, resourceGroup, opts.Name, *containerGroup); err != nil {
+		return 0, err
+	}
+
+	if !opts.Attach {
+		return 0, nil
+	}
+
+	exitCode, err := streamUntilExit(ctx, aciClient, resourceGroup, opts.Name, containerGroup.Containers[0].Name)
+
+	if opts.Remove {
+		removeCtx := ctx
+		if ctx.Err() != nil {
+			var cancel context.CancelFunc
+			removeCtx, cancel = context.WithTimeout(context.Background(), runCleanupTimeout)
+			defer cancel()
+		}
+
+		fmt.Printf("Deleting container group %s\n", opts.Name)
+		if deleteErr := aciClient.DeleteContainerGroup(removeCtx, resourceGroup, opts.Name); deleteErr != nil && err == nil {
+			err = fmt.Errorf("Delete container group error: %w", deleteErr)
+		}
+	}
+
+	return exitCode, err
+}
+
+// deploymentFromRunOptions builds the deployment of one replica described by
+// the options.
+func deploymentFromRunOptions(opts RunOptions) (*v1beta1.Deployment, error) {
+	if err := ValidateContainerGroupName(opts.Name); err != nil {
+		return nil, err
+	}
+
+	container := v1.Container{
+		Name:  opts.Name,
+		Image: opts.Image,
+		Resources: v1.ResourceRequirements{
+			Requests: v1.ResourceList{},
+			Limits:   v1.ResourceList{},
+		},
+	}
+
+	for _, port := range opts.Ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("Invalid port %d, must be between 1 and 65535", port)
+		}
+		container.Ports = append(container.Ports, v1.ContainerPort{ContainerPort: int32(port), Protocol: v1.ProtocolTCP})
+	}
+
+	for _, pair := range opts.Env {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid environment variable %q, must be KEY=VALUE", pair)
+		}
+		container.Env = append(container.Env, v1.EnvVar{Name: parts[0], Value: parts[1]})
+	}
+
+	for name, value := range map[v1.ResourceName]string{v1.ResourceCPU: opts.CPU, v1.ResourceMemory: opts.Memory} {
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s %q: %v", name, value, err)
+		}
+		container.Resources.Requests[name] = quantity
+		container.Resources.Limits[name] = quantity
+	}
+
+	if opts.Command != "" {
+		command, err := splitCommand(opts.Command)
+		if err != nil {
+			return nil, err
+		}
+		container.Command = command
+	}
+
+	restartPolicy := v1.RestartPolicy(opts.RestartPolicy)
+	switch restartPolicy {
+	case v1.RestartPolicyAlways, v1.RestartPolicyOnFailure, v1.RestartPolicyNever:
+	default:
+		return nil, fmt.Errorf("Unknown restart policy %q, must be Always, OnFailure or Never", opts.RestartPolicy)
+	}
+
+	if (opts.Attach || opts.Remove) && restartPolicy == v1.RestartPolicyAlways {
+		return nil, fmt.Errorf("Attaching to and removing a container need the restart policy Never or OnFailure, a container restarted Always never exits")
+	}
+
+	replicas := int32(1)
+	return &v1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Name},
+		Spec: v1beta1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers:    []v1.Container{container},
+					RestartPolicy: restartPolicy,
+				},
+			},
+		},
+	}, nil
+}
+
+// streamUntilExit prints the logs of the container as they grow until the
+// container group has finished, and returns the exit code of the container.
+func streamUntilExit(ctx context.Context, aciClient aci.ContainerGroupClient, resourceGroup string, name string, containerName string) (int32, error) {
+	printed := ""
+	printLogs := func() {
+		logs, err := aciClient.GetContainerLogs(ctx, resourceGroup, name, containerName, 0)
+		if err != nil {
+			// The logs are not available until the container started.
+			return
+		}
+
+		if strings.HasPrefix(logs.Content, printed) {
+			fmt.Print(logs.Content[len(printed):])
+		} else {
+			fmt.Print(logs.Content)
+		}
+		printed = logs.Content
+	}
+
+	for {
+		cg, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, name)
+		if err != nil && ctx.Err() != nil {
+			return 0, err
+		}
+
+		if err == nil {
+			if cg.ProvisioningState == "Failed" {
+				return 0, fmt.Errorf("Container group %s failed to provision", name)
+			}
+
+			printLogs()
+
+			if isContainerGroupFinished(cg) {
+				return cg.Containers[0].InstanceView.CurrentState.ExitCode, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(runLogInterval):
+		}
+	}
+}
+
+// isContainerGroupFinished reports whether the containers of a container
+// group that is not restarted Always have all exited for good.
+func isContainerGroupFinished(cg *client.ContainerGroup) bool {
+	return cg.InstanceView.State == "Succeeded" || cg.InstanceView.State == "Failed"
+}
+
+// splitCommand splits a command line into words like a shell does, honoring
+// single quotes, double quotes and backslashes.
+func splitCommand(command string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("Unterminated quote or escape in command %q", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
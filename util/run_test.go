@@ -0,0 +1,148 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+func TestRunContainer(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         RunOptions
+		exitCode     int32
+		failing      bool
+		wantExitCode int32
+		wantGroups   int
+		wantErr      bool
+	}{
+		{
+			name:       "detached",
+			opts:       RunOptions{RestartPolicy: "Always"},
+			wantGroups: 1,
+		},
+		{
+			name:         "attached",
+			opts:         RunOptions{RestartPolicy: "Never", Attach: true},
+			exitCode:     3,
+			wantExitCode: 3,
+			wantGroups:   1,
+		},
+		{
+			name:         "attached and removed",
+			opts:         RunOptions{RestartPolicy: "Never", Attach: true, Remove: true},
+			exitCode:     3,
+			wantExitCode: 3,
+		},
+		{
+			name:       "attached to a failed container group",
+			opts:       RunOptions{RestartPolicy: "Never", Attach: true},
+			failing:    true,
+			wantGroups: 1,
+			wantErr:    true,
+		},
+		{
+			name:    "attached to a container restarted always",
+			opts:    RunOptions{RestartPolicy: "Always", Attach: true},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+
+			aciClient := fake.NewClient()
+			aciClient.RunSteps = 2
+			aciClient.ExitCodes["busybox"] = test.exitCode
+			aciClient.FailingImages["busybox"] = test.failing
+
+			opts := test.opts
+			opts.Name = "hello"
+			opts.Image = "busybox"
+			exitCode, err := RunContainer(context.Background(), aciClient, testResourceGroup, "westus", opts)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("RunContainer returned %v, want an error: %t", err, test.wantErr)
+			}
+			if exitCode != test.wantExitCode {
+				t.Errorf("RunContainer returned the exit code %d, want %d", exitCode, test.wantExitCode)
+			}
+
+			groups := listGroups(t, aciClient)
+			if len(groups) != test.wantGroups {
+				t.Fatalf("RunContainer left the container groups %v, want %d", containerGroupNames(groups), test.wantGroups)
+			}
+			for _, cg := range groups {
+				if !IsOwnedBy(cg, "hello") || GetRevision(cg) != 1 {
+					t.Errorf("Container group %s has tags %v, want revision 1 of deployment hello", cg.Name, cg.Tags)
+				}
+			}
+		})
+	}
+}
+
+func TestRunContainerExists(t *testing.T) {
+	aciClient := fake.NewClient()
+	opts := RunOptions{Name: "hello", Image: "busybox", RestartPolicy: "Always"}
+	if _, err := RunContainer(context.Background(), aciClient, testResourceGroup, "westus", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Image = "nginx"
+	if _, err := RunContainer(context.Background(), aciClient, testResourceGroup, "westus", opts); err == nil {
+		t.Fatal("RunContainer replaced an existing container group")
+	}
+	if cg := listGroups(t, aciClient)[0]; cg.Containers[0].Image != "busybox" {
+		t.Errorf("Container group runs %s, want the busybox it was created with", cg.Containers[0].Image)
+	}
+}
+
+// interruptingClient cancels the context of the run once the container group
+// was read reads times, like an interrupt while attached.
+type interruptingClient struct {
+	*fake.Client
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (c *interruptingClient) GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*client.ContainerGroup, error, *int) {
+	if c.reads--; c.reads < 0 {
+		c.cancel()
+	}
+
+	return c.Client.GetContainerGroup(ctx, resourceGroup, containerGroupName)
+}
+
+func TestRunContainerInterrupted(t *testing.T) {
+	tests := []struct {
+		name       string
+		remove     bool
+		wantGroups int
+	}{
+		{name: "removed", remove: true, wantGroups: 0},
+		{name: "kept", remove: false, wantGroups: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The container runs until stopped, the run only ends with the
+			// interrupt.
+			aciClient := &interruptingClient{Client: fake.NewClient(), cancel: cancel, reads: 4}
+			opts := RunOptions{Name: "hello", Image: "busybox", RestartPolicy: "Never", Attach: true, Remove: test.remove}
+			if _, err := RunContainer(ctx, aciClient, testResourceGroup, "westus", opts); err != context.Canceled {
+				t.Fatalf("RunContainer returned %v, want %v", err, context.Canceled)
+			}
+
+			if groups := listGroups(t, aciClient.Client); len(groups) != test.wantGroups {
+				t.Errorf("Interrupted run left the container groups %v, want %d", containerGroupNames(groups), test.wantGroups)
+			}
+		})
+	}
+}
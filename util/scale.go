@@ -0,0 +1,208 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// Scale sets the number of container groups owned by the deployment to
+// replicas. Missing replicas are created from the deployment file when one is
+// given, and from the spec of a live replica of the latest revision otherwise.
+// When currentReplicas is not negative, the deployment must have exactly that
+// many replicas for the scale to happen.
+func Scale(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentName string, deploymentFile string, resourceGroup string, region string, replicas int, currentReplicas int) error {
+	if replicas < 0 {
+		return fmt.Errorf("Replicas must be a non-negative number, got %d", replicas)
+	}
+
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	if currentReplicas >= 0 && len(owned) != currentReplicas {
+		return fmt.Errorf("Expected deployment %q to have %d replicas, found %d", deploymentName, currentReplicas, len(owned))
+	}
+
+	var done progress
+	switch {
+	case replicas > len(owned):
+		template, err := scaleTemplate(ctx, aciClient, owned, deploymentName, deploymentFile, resourceGroup, region)
+		if err != nil {
+			return err
+		}
+		template.Tags[ReplicasTag] = strconv.Itoa(replicas)
+
+		namer, err := newReplicaNamer(ctx, aciClient, resourceGroup, deploymentName, template.Tags[TemplateHashTag])
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, replicas-len(owned))
+		for i := len(owned); i < replicas; i++ {
+			name, err := namer.next()
+			if err != nil {
+				return err
+			}
+			names = append(names, name)
+		}
+
+		err = runParallel(ctx, "create", names, &done, func(ctx context.Context, name string) error {
+			cg := *template
+			cg.Name = name
+
+			fmt.Printf("Creating Container Group %s.\n", cg.Name)
+
+			_, err := aciClient.CreateContainerGroup(ctx, resourceGroup, cg.Name, cg)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	case replicas < len(owned):
+		live := make([]client.ContainerGroup, 0, len(owned))
+		for _, cg := range owned {
+			current, err, _ := aciClient.GetContainerGroup(ctx, resourceGroup, cg.Name)
+			if err != nil {
+				return err
+			}
+			live = append(live, *current)
+		}
+
+		sortForScaleDown(live)
+
+		err = runParallel(ctx, "delete", containerGroupNames(live[:len(live)-replicas]), &done, func(ctx context.Context, name string) error {
+			fmt.Printf("Deleting container group %s\n", name)
+			if err := aciClient.DeleteContainerGroup(ctx, resourceGroup, name); err != nil {
+				return fmt.Errorf("Delete container group error: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := recordReplicas(ctx, aciClient, resourceGroup, deploymentName, replicas); err != nil {
+		return err
+	}
+
+	fmt.Printf("deployment %q scaled to %d replicas\n", deploymentName, replicas)
+
+	return nil
+}
+
+// scaleTemplate returns the container group new replicas are created from,
+// with the ownership tags already set. It is built from the deployment file
+// when one is given, which must then match the latest revision, and copied
+// from the latest live replica otherwise.
+func scaleTemplate(ctx context.Context, aciClient aci.ContainerGroupClient, owned []client.ContainerGroup, deploymentName string, deploymentFile string, resourceGroup string, region string) (*client.ContainerGroup, error) {
+	if deploymentFile != "" {
+		template, strategy, err := manifestTemplate(deploymentName, deploymentFile, region)
+		if err != nil {
+			return nil, err
+		}
+
+		templateHash, err := TemplateHash(template)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(owned) == 0 || latestContainerGroup(owned).Tags == nil {
+			template.Tags, err = ownerTags(deploymentName, 1, templateHash, map[int]string{1: formatImages(template)})
+			if err != nil {
+				return nil, err
+			}
+			template.Tags[StrategyTag] = strategy
+			return template, nil
+		}
+
+		latest := latestContainerGroup(owned)
+		if latest.Tags[TemplateHashTag] != templateHash {
+			return nil, fmt.Errorf("Deployment file %s differs from revision %d of deployment %q, apply it to roll it out", deploymentFile, GetRevision(latest), deploymentName)
+		}
+		template.Tags = copyTags(latest.Tags)
+
+		return template, nil
+	}
+
+	if len(owned) == 0 {
+		return nil, fmt.Errorf("Deployment %q has no replicas to copy the spec from, supply the deployment file with the -f flag", deploymentName)
+	}
+
+	latest := latestContainerGroup(owned)
+	template, err := copyReplica(ctx, aciClient, latest, deploymentName, resourceGroup)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Tags != nil {
+		template.Tags = copyTags(latest.Tags)
+	} else {
+		templateHash, err := TemplateHash(template)
+		if err != nil {
+			return nil, err
+		}
+		template.Tags, err = ownerTags(deploymentName, 1, templateHash, map[int]string{1: formatImages(template)})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return template, nil
+}
+
+// manifestTemplate returns the container group of the deployment file, which
+// must describe the deployment, and its formatted strategy.
+func manifestTemplate(deploymentName string, deploymentFile string, region string) (*client.ContainerGroup, string, error) {
+	deployment, err := GetDeploymentFromFile(deploymentFile)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if deployment.Name != deploymentName {
+		return nil, "", fmt.Errorf("Deployment file %s describes deployment %q, not %q", deploymentFile, deployment.Name, deploymentName)
+	}
+
+	template, err := ContainerGroupFromDeployment(deployment, region)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return template, formatStrategy(deployment.Spec.Strategy), nil
+}
+
+// sortForScaleDown orders container groups so that failed groups come first,
+// followed by the newest ones.
+func sortForScaleDown(cgs []client.ContainerGroup) {
+	sort.SliceStable(cgs, func(i, j int) bool {
+		iFailed := isContainerGroupFailed(&cgs[i])
+		jFailed := isContainerGroupFailed(&cgs[j])
+		if iFailed != jFailed {
+			return iFailed
+		}
+
+		if GetRevision(cgs[i]) != GetRevision(cgs[j]) {
+			return GetRevision(cgs[i]) > GetRevision(cgs[j])
+		}
+
+		return startTime(cgs[i]).After(startTime(cgs[j]))
+	})
+}
+
+// startTime returns the latest start time of the containers in the group.
+func startTime(cg client.ContainerGroup) time.Time {
+	var latest time.Time
+	for _, container := range cg.Containers {
+		if started := time.Time(container.InstanceView.CurrentState.StartTime); started.After(latest) {
+			latest = started
+		}
+	}
+
+	return latest
+}
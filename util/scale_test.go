@@ -0,0 +1,162 @@
+package util
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name            string
+		replicas        int
+		scaleTo         int
+		currentReplicas int
+		withFile        bool
+		wantErr         bool
+	}{
+		{name: "up", replicas: 2, scaleTo: 4, currentReplicas: -1},
+		{name: "down", replicas: 3, scaleTo: 1, currentReplicas: -1},
+		{name: "to zero", replicas: 2, scaleTo: 0, currentReplicas: -1},
+		{name: "from zero with file", replicas: 0, scaleTo: 2, currentReplicas: -1, withFile: true},
+		{name: "from zero without file", replicas: 0, scaleTo: 2, currentReplicas: -1, wantErr: true},
+		{name: "current replicas", replicas: 2, scaleTo: 3, currentReplicas: 2},
+		{name: "current replicas mismatch", replicas: 2, scaleTo: 3, currentReplicas: 1, wantErr: true},
+		{name: "negative", replicas: 2, scaleTo: -1, currentReplicas: -1, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			aciClient := fake.NewClient()
+
+			manifest := writeManifest(t, deploymentManifest("web", test.replicas, "nginx"))
+			if err := Create(ctx, aciClient, manifest, testResourceGroup, "westus", false); err != nil {
+				t.Fatal(err)
+			}
+
+			file := ""
+			if test.withFile {
+				file = manifest
+			}
+
+			err := Scale(ctx, aciClient, "web", file, testResourceGroup, "westus", test.scaleTo, test.currentReplicas)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("Scale succeeded, want an error")
+				}
+				if groups := listGroups(t, aciClient); len(groups) != test.replicas {
+					t.Errorf("Failed Scale left %d container groups, want %d", len(groups), test.replicas)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scale failed: %v", err)
+			}
+
+			groups := listGroups(t, aciClient)
+			if len(groups) != test.scaleTo {
+				t.Fatalf("Scale left %d container groups, want %d", len(groups), test.scaleTo)
+			}
+			for _, cg := range groups {
+				if !IsOwnedBy(cg, "web") || cg.Containers[0].Image != "nginx" {
+					t.Errorf("Container group %s is not a replica of deployment web", cg.Name)
+				}
+			}
+		})
+	}
+}
+
+// createRecorder records the container groups created through it, which the
+// fake client returns without their secrets like ACI.
+type createRecorder struct {
+	*fake.Client
+	created []client.ContainerGroup
+}
+
+func (r *createRecorder) CreateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error) {
+	r.created = append(r.created, containerGroup)
+	return r.Client.CreateContainerGroup(ctx, resourceGroup, containerGroupName, containerGroup)
+}
+
+func TestScaleSecretVolume(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"kustomization.yaml": `resources:
+- deployment.yaml
+secretGenerator:
+- name: credentials
+  literals:
+  - password=hunter2
+generatorOptions:
+  disableNameSuffixHash: true
+`,
+		"deployment.yaml": `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx
+        volumeMounts:
+        - name: credentials
+          mountPath: /credentials
+      volumes:
+      - name: credentials
+        secret:
+          secretName: credentials
+`,
+	})
+
+	source, workloads, manifests, configs := builtSource, builtWorkloads, builtManifests, manifestConfigs
+	defer func() {
+		builtSource, builtWorkloads, builtManifests, manifestConfigs = source, workloads, manifests, configs
+	}()
+
+	ref, err := LoadKustomization(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	aciClient := &createRecorder{Client: fake.NewClient()}
+	if err := Create(ctx, aciClient, ref, testResourceGroup, "westus", false); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Scale(ctx, aciClient, "web", "", testResourceGroup, "westus", 2, -1)
+	if err == nil || !strings.Contains(err.Error(), "-f flag") {
+		t.Errorf("Scale without the deployment file returned %v, want an error asking for it", err)
+	}
+	if groups := listGroups(t, aciClient); len(groups) != 1 {
+		t.Fatalf("Failed Scale left %d container groups, want 1", len(groups))
+	}
+
+	if err := Scale(ctx, aciClient, "web", ref, testResourceGroup, "westus", 2, -1); err != nil {
+		t.Fatalf("Scale with the deployment file failed: %v", err)
+	}
+
+	if len(aciClient.created) != 2 {
+		t.Fatalf("Scale created %d container groups, want 2", len(aciClient.created))
+	}
+	for _, cg := range aciClient.created {
+		want := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+		if got := cg.Volumes[0].Secret["password"]; got != want {
+			t.Errorf("Container group %s was created with the secret file %q, want %q", cg.Name, got, want)
+		}
+	}
+
+	// New replicas are of the live revision, a deployment file describing
+	// another one is refused.
+	changed := writeManifest(t, deploymentManifest("web", 1, "nginx:1.15"))
+	if err := Scale(ctx, aciClient, "web", changed, testResourceGroup, "westus", 3, -1); err == nil {
+		t.Error("Scale with a changed deployment file succeeded, want an error")
+	}
+}
@@ -0,0 +1,583 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// SyncTag records the source of the manifests a container group was synced
+// from, Sync only prunes deployments whose groups carry its own source.
+const SyncTag = "acictl-sync"
+
+// Outcomes of a workload in the sync status.
+const (
+	// SyncInSync means the live replicas already matched the manifest.
+	SyncInSync = "InSync"
+	// SyncCreated means the deployment had no replicas yet.
+	SyncCreated = "Created"
+	// SyncUpdated means the deployment was rolled out to a changed manifest.
+	SyncUpdated = "Updated"
+	// SyncHealed means missing or failed replicas were created again.
+	SyncHealed = "Healed"
+	SyncFailed = "Failed"
+	// SyncPruned means the deployment was deleted because its manifest was
+	// removed, SyncOrphaned that it was kept since pruning is disabled.
+	SyncPruned   = "Pruned"
+	SyncOrphaned = "Orphaned"
+	// SyncSkipped means the manifest holds a kind that is not synced.
+	SyncSkipped = "Skipped"
+)
+
+var (
+	// DefaultSyncDebounce is how long the manifests must stay unchanged
+	// before they are synced, so an editor or a git checkout writing several
+	// files causes a single sync.
+	DefaultSyncDebounce = 2 * time.Second
+	// DefaultSyncInterval is how often the live state is checked again
+	// without changes to the manifests.
+	DefaultSyncInterval = time.Minute
+)
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// Source identifies the manifest directory in the SyncTag of the
+	// container groups, it defaults to the name of the directory.
+	Source string
+	// Watch keeps syncing when the manifests change and every Interval.
+	Watch    bool
+	Debounce time.Duration
+	Interval time.Duration
+	// Prune deletes the deployments synced from Source whose manifest was
+	// removed.
+	Prune bool
+	// StatusFile is where the JSON status of the last sync is written, if set.
+	StatusFile string
+	Timeout    time.Duration
+	// Kustomize builds the directory as a kustomization, and Chart renders it
+	// as a Helm chart, instead of reading its manifests. All of its files are
+	// then watched.
+	Kustomize bool
+	Chart     bool
+}
+
+// SyncStatus is the result of a sync of the manifest directory.
+type SyncStatus struct {
+	Dir            string       `json:"dir"`
+	Source         string       `json:"source"`
+	Trigger        string       `json:"trigger"`
+	StartTime      time.Time    `json:"startTime"`
+	CompletionTime time.Time    `json:"completionTime"`
+	Succeeded      bool         `json:"succeeded"`
+	Workloads      []SyncResult `json:"workloads"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// SyncResult is the outcome of the sync of a workload.
+type SyncResult struct {
+	Name     string `json:"name,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	File     string `json:"file,omitempty"`
+	Status   string `json:"status"`
+	Replicas int    `json:"replicas,omitempty"`
+	Healed   int    `json:"healed,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// syncer reconciles the deployments of a manifest directory.
+type syncer struct {
+	aciClient     aci.ContainerGroupClient
+	resourceGroup string
+	region        string
+	dir           string
+	opts          SyncOptions
+}
+
+// Sync makes the deployments in the resource group match the Deployment
+// manifests in the directory tree, like 'acictl apply' on every manifest.
+// Replicas that were deleted or failed are created again. With Prune set, the
+// deployments synced from the same source whose manifest was removed are
+// deleted.
+//
+// With Watch set, Sync runs again whenever the manifests change and every
+// Interval until the context is cancelled, and failures are only reported in
+// the output and the status file.
+func Sync(ctx context.Context, aciClient aci.ContainerGroupClient, dir string, resourceGroup string, region string, opts SyncOptions) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("Manifest directory %s not found", dir)
+	}
+
+	if opts.Source == "" {
+		opts.Source = filepath.Base(dir)
+	}
+	if opts.StatusFile != "" {
+		if opts.StatusFile, err = filepath.Abs(opts.StatusFile); err != nil {
+			return err
+		}
+	}
+
+	s := &syncer{
+		aciClient:     aciClient,
+		resourceGroup: resourceGroup,
+		region:        region,
+		dir:           dir,
+		opts:          opts,
+	}
+
+	if !opts.Watch {
+		status := s.sync(ctx, "once")
+		switch {
+		case ctx.Err() != nil:
+			return fmt.Errorf("Sync of %s cancelled (%s)", dir, ctx.Err())
+		case !status.Succeeded:
+			return fmt.Errorf("Sync of %s failed, %s", dir, failedWorkloads(status))
+		}
+		return nil
+	}
+
+	// The watcher starts before the first sync, so the changes made during
+	// it are synced afterwards.
+	watcher, err := newDirWatcher(dir, s.watches)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	fmt.Printf("Watching %s for changes.\n", dir)
+	s.sync(ctx, "start")
+
+	var resync <-chan time.Time
+	if opts.Interval > 0 {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		resync = ticker.C
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Sync of %s stopped (%s)", dir, ctx.Err())
+		case <-watcher.Events():
+			debounce = time.After(opts.Debounce)
+		case <-debounce:
+			debounce = nil
+			s.sync(ctx, "change")
+		case <-resync:
+			// A pending change syncs everything soon anyway.
+			if debounce == nil {
+				s.sync(ctx, "interval")
+			}
+		}
+	}
+}
+
+// watches reports whether a change to the file triggers a sync: any file of a
+// kustomization or chart, the manifests otherwise. The status file, and the
+// temporary file it is written through, never do, or every sync would
+// trigger the next one.
+func (s *syncer) watches(path string) bool {
+	return (s.opts.Kustomize || s.opts.Chart || isManifestFile(path)) && !s.isStatusFile(path)
+}
+
+func (s *syncer) isStatusFile(path string) bool {
+	return s.opts.StatusFile != "" && (path == s.opts.StatusFile || path == statusTempFile(s.opts.StatusFile))
+}
+
+// sync reconciles every workload once, prints a summary and writes the
+// status file.
+func (s *syncer) sync(ctx context.Context, trigger string) *SyncStatus {
+	status := &SyncStatus{
+		Dir:       s.dir,
+		Source:    s.opts.Source,
+		Trigger:   trigger,
+		StartTime: time.Now().UTC(),
+	}
+
+	manifests, results, readErr := s.readManifests()
+	status.Workloads = results
+
+	desired := map[string]bool{}
+	for _, manifest := range manifests {
+		desired[manifest.deployment.Name] = true
+		if ctx.Err() != nil {
+			continue
+		}
+		status.Workloads = append(status.Workloads, s.syncDeployment(ctx, manifest))
+	}
+
+	// A manifest that can not be read may be half written, pruning would
+	// delete the deployment it holds.
+	if readErr == nil && ctx.Err() == nil {
+		pruned, err := s.prune(ctx, desired)
+		status.Workloads = append(status.Workloads, pruned...)
+		if err != nil {
+			status.Error = err.Error()
+		}
+	}
+
+	status.CompletionTime = time.Now().UTC()
+	status.Succeeded = status.Error == "" && ctx.Err() == nil
+	counts := map[string]int{}
+	for _, result := range status.Workloads {
+		counts[result.Status]++
+		if result.Status == SyncFailed {
+			status.Succeeded = false
+		}
+	}
+
+	fmt.Printf("Synced %s: %d in sync, %d created, %d updated, %d healed, %d pruned, %d orphaned, %d failed.\n", s.dir,
+		counts[SyncInSync], counts[SyncCreated], counts[SyncUpdated], counts[SyncHealed], counts[SyncPruned], counts[SyncOrphaned], counts[SyncFailed])
+	for _, result := range status.Workloads {
+		if result.Error == "" {
+			continue
+		}
+		if result.Name != "" {
+			fmt.Printf("  %s %s: %s\n", strings.ToLower(result.Kind), result.Name, result.Error)
+		} else {
+			fmt.Printf("  %s: %s\n", result.File, result.Error)
+		}
+	}
+
+	if s.opts.StatusFile != "" {
+		if err := writeSyncStatus(status, s.opts.StatusFile); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	return status
+}
+
+// syncManifest is a Deployment manifest of the synced directory.
+type syncManifest struct {
+	file       string
+	deployment *v1beta1.Deployment
+}
+
+// readManifests reads the Deployment manifests of the directory tree, hidden
+// directories aside. The manifests that can not be read and the other kinds
+// are returned as results, the error reports whether some manifest could not
+// be read.
+func (s *syncer) readManifests() ([]syncManifest, []SyncResult, error) {
+	if s.opts.Kustomize || s.opts.Chart {
+		return s.readBuilt()
+	}
+
+	var manifests []syncManifest
+	var results []SyncResult
+	var readErr error
+	files := map[string]string{}
+
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != s.dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isManifestFile(path) || s.isStatusFile(path) {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(s.dir, path)
+		fail := func(err error) error {
+			readErr = err
+			results = append(results, SyncResult{File: rel, Status: SyncFailed, Error: err.Error()})
+			return nil
+		}
+
+		// Files of other tools, such as values files, and kinds acictl does
+		// not know are skipped, files that do not parse are failures.
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fail(fmt.Errorf("Reading %s failed: %v", rel, err))
+		}
+		if data, err = preprocessManifest(path, data); err != nil {
+			return fail(err)
+		}
+		var typeMeta metav1.TypeMeta
+		if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+			return fail(fmt.Errorf("Parsing %s failed: %v", rel, err))
+		}
+		if typeMeta.Kind != "Deployment" {
+			message := "only Deployments are synced"
+			if typeMeta.Kind == "" {
+				message = "not a Kubernetes manifest"
+			}
+			results = append(results, SyncResult{File: rel, Kind: typeMeta.Kind, Status: SyncSkipped, Message: message})
+			return nil
+		}
+
+		obj, err := decodeManifest(path, data)
+		if err != nil {
+			return fail(err)
+		}
+		deployment, ok := obj.(*v1beta1.Deployment)
+		if !ok {
+			return fail(fmt.Errorf("%s holds a Deployment of the unsupported version %s", rel, typeMeta.APIVersion))
+		}
+
+		if other, ok := files[deployment.Name]; ok {
+			readErr = fmt.Errorf("Deployment %s is defined in both %s and %s", deployment.Name, other, rel)
+			results = append(results, SyncResult{File: rel, Kind: "Deployment", Name: deployment.Name, Status: SyncFailed, Error: readErr.Error()})
+			return nil
+		}
+		files[deployment.Name] = rel
+
+		manifests = append(manifests, syncManifest{file: rel, deployment: deployment})
+		return nil
+	})
+	if err != nil {
+		readErr = err
+		results = append(results, SyncResult{Status: SyncFailed, Error: fmt.Sprintf("Reading %s failed: %v", s.dir, err)})
+	}
+
+	return manifests, results, readErr
+}
+
+// readBuilt builds the kustomization or renders the chart of the directory,
+// and returns its Deployments and the other workloads like readManifests.
+func (s *syncer) readBuilt() ([]syncManifest, []SyncResult, error) {
+	load := LoadKustomization
+	if s.opts.Chart {
+		load = LoadChart
+	}
+
+	if _, err := load(s.dir, ""); err != nil {
+		return nil, []SyncResult{{Status: SyncFailed, Error: err.Error()}}, err
+	}
+
+	var manifests []syncManifest
+	var results []SyncResult
+	var readErr error
+	for _, ref := range builtWorkloads {
+		obj, _, err := readManifest(ref)
+		if err != nil {
+			readErr = err
+			results = append(results, SyncResult{Status: SyncFailed, Error: err.Error()})
+			continue
+		}
+
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		deployment, ok := obj.(*v1beta1.Deployment)
+		switch {
+		case !ok && kind == "Deployment":
+			readErr = fmt.Errorf("%s holds a Deployment of the unsupported version %s", ref, obj.GetObjectKind().GroupVersionKind().GroupVersion())
+			results = append(results, SyncResult{Kind: kind, Status: SyncFailed, Error: readErr.Error()})
+		case !ok:
+			var name string
+			if accessor, ok := obj.(metav1.Object); ok {
+				name = accessor.GetName()
+			}
+			results = append(results, SyncResult{Kind: kind, Name: name, Status: SyncSkipped, Message: "only Deployments are synced"})
+		default:
+			manifests = append(manifests, syncManifest{deployment: deployment})
+		}
+	}
+
+	return manifests, results, readErr
+}
+
+// syncDeployment rolls the deployment out when its live replicas do not
+// match the manifest, after deleting the replicas that failed.
+func (s *syncer) syncDeployment(ctx context.Context, manifest syncManifest) SyncResult {
+	deployment := manifest.deployment
+	result := SyncResult{Name: deployment.Name, Kind: "Deployment", File: manifest.file, Replicas: int(getReplicas(deployment))}
+	fail := func(err error) SyncResult {
+		result.Status = SyncFailed
+		result.Error = err.Error()
+		return result
+	}
+
+	r, err := newRollout(s.aciClient, deployment, s.resourceGroup, s.region, s.opts.Timeout)
+	if err != nil {
+		return fail(err)
+	}
+	r.source = s.opts.Source
+
+	templateHash, err := TemplateHash(r.template)
+	if err != nil {
+		return fail(err)
+	}
+
+	owned, err := ListOwnedContainerGroups(ctx, s.aciClient, s.resourceGroup, deployment.Name)
+	if err != nil {
+		return fail(err)
+	}
+
+	// The list does not hold the instance views, so the replicas of the
+	// template are read one by one to find the failed ones.
+	outdated := 0
+	var running, failed []client.ContainerGroup
+	for _, cg := range owned {
+		if cg.Tags[TemplateHashTag] != templateHash {
+			outdated++
+			continue
+		}
+
+		live, err, status := s.aciClient.GetContainerGroup(ctx, s.resourceGroup, cg.Name)
+		if status != nil && *status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		if isContainerGroupFailed(live) {
+			failed = append(failed, cg)
+		} else {
+			running = append(running, cg)
+		}
+	}
+
+	if outdated == 0 && len(failed) == 0 && len(running) == r.replicas {
+		result.Status = SyncInSync
+		return result
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("Replacing %d failed replicas of deployment %s.\n", len(failed), deployment.Name)
+		if err := r.deleteReplicas(ctx, failed); err != nil {
+			return fail(r.done.interrupted(ctx, err))
+		}
+	}
+
+	if err := r.run(ctx); err != nil {
+		return fail(err)
+	}
+
+	switch {
+	case len(owned) == 0:
+		result.Status = SyncCreated
+	case outdated > 0 || len(running) > r.replicas:
+		result.Status = SyncUpdated
+	default:
+		result.Status = SyncHealed
+		result.Healed = r.replicas - len(running)
+		result.Message = fmt.Sprintf("%d missing and %d failed replicas replaced", r.replicas-len(running)-len(failed), len(failed))
+	}
+
+	return result
+}
+
+// prune deletes, or with Prune unset reports, the deployments synced from the
+// source whose manifest is gone.
+func (s *syncer) prune(ctx context.Context, desired map[string]bool) ([]SyncResult, error) {
+	cgList, err := s.aciClient.ListContainerGroups(ctx, s.resourceGroup)
+	if err != nil {
+		return nil, fmt.Errorf("Container group list error: %w", err)
+	}
+
+	orphans := map[string]bool{}
+	for _, cg := range cgList.Value {
+		name, ok := cg.Tags[DeploymentTag]
+		if ok && cg.Tags[SyncTag] == s.opts.Source && !desired[name] {
+			orphans[name] = true
+		}
+	}
+
+	names := make([]string, 0, len(orphans))
+	for name := range orphans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []SyncResult
+	for _, name := range names {
+		result := SyncResult{Name: name, Kind: "Deployment", Status: SyncOrphaned, Message: "manifest removed, sync with --prune to delete the deployment"}
+		if s.opts.Prune {
+			fmt.Printf("Pruning deployment %s, its manifest was removed.\n", name)
+			result.Status = SyncPruned
+			result.Message = ""
+			if err := deleteTagged(ctx, s.aciClient, s.resourceGroup, DeploymentTag, name, false); err != nil {
+				result.Status = SyncFailed
+				result.Error = err.Error()
+			}
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// isManifestFile reports whether the file may hold a Kubernetes manifest.
+func isManifestFile(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return false
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+
+	return false
+}
+
+// failedWorkloads describes the workloads that failed to sync.
+func failedWorkloads(status *SyncStatus) string {
+	var failed []string
+	for _, result := range status.Workloads {
+		if result.Status != SyncFailed {
+			continue
+		}
+		if result.Name != "" {
+			failed = append(failed, result.Name)
+		} else {
+			failed = append(failed, result.File)
+		}
+	}
+
+	if len(failed) == 0 {
+		return status.Error
+	}
+
+	return fmt.Sprintf("%d workloads failed: %s", len(failed), strings.Join(failed, ", "))
+}
+
+// writeSyncStatus writes the status as indented JSON, replacing the previous
+// status at once so readers never see a partial file.
+func writeSyncStatus(status *SyncStatus, path string) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := statusTempFile(path)
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("Writing sync status %q failed: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("Writing sync status %q failed: %v", path, err)
+	}
+
+	return nil
+}
+
+// statusTempFile returns the file the status file at path is written to
+// before it is renamed over it.
+func statusTempFile(path string) string {
+	return path + ".tmp"
+}
@@ -0,0 +1,341 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/ghodss/yaml"
+)
+
+var (
+	// ManifestValues are the values of the Go templates of manifests, from
+	// the --values files and the --set flags. Manifests are only executed as
+	// templates when it is set.
+	ManifestValues map[string]interface{}
+	// ExpandEnv replaces the ${VAR} and ${VAR:-default} references of
+	// manifests with environment variables. StrictEnv fails on undefined
+	// variables instead of replacing them with the empty string.
+	ExpandEnv bool
+	StrictEnv bool
+
+	// envReference matches ${VAR} and ${VAR:-default}, and $${VAR} which
+	// escapes a literal ${VAR}.
+	envReference = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+	// templateFuncs are the functions of manifest templates, on top of the
+	// builtin ones of text/template.
+	templateFuncs = template.FuncMap{
+		"env": os.Getenv,
+		"default": func(def interface{}, value interface{}) interface{} {
+			if value == nil || value == "" {
+				return def
+			}
+			return value
+		},
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if value == nil || value == "" {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		"quote": func(value interface{}) string {
+			return fmt.Sprintf("%q", fmt.Sprint(value))
+		},
+		"lower":           strings.ToLower,
+		"upper":           strings.ToUpper,
+		"trim":            strings.TrimSpace,
+		optionalValueFunc: optionalValue,
+	}
+
+	// missingTolerantFuncs are the functions that handle values that are not
+	// set, which they receive as nil instead of failing the template.
+	missingTolerantFuncs = map[string]bool{"default": true, "required": true}
+)
+
+// optionalValueFunc is the function the value references of the pipelines
+// of missingTolerantFuncs are rewritten to.
+const optionalValueFunc = "acictlOptionalValue"
+
+// LoadManifestValues merges the values files in order, then sets the values of
+// the key=value pairs, where a dotted key such as image.tag sets a nested
+// value. Like with Helm, true, false, null and integers are typed, other
+// values are strings. It returns nil when there are neither files nor pairs.
+func LoadManifestValues(files []string, pairs []string) (map[string]interface{}, error) {
+	if len(files) == 0 && len(pairs) == 0 {
+		return nil, nil
+	}
+
+	values := map[string]interface{}{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Reading values file %q failed: %v", file, err)
+		}
+
+		var fileValues map[string]interface{}
+		if err := yaml.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("Decoding values file %q failed: %v", file, err)
+		}
+		mergeValues(values, fileValues)
+	}
+
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid value %q, must be key=value", pair)
+		}
+
+		keys := strings.Split(parts[0], ".")
+		parent := values
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+			parent = child
+		}
+		parent[keys[len(keys)-1]] = parseSetValue(parts[1])
+	}
+
+	return values, nil
+}
+
+// parseSetValue returns the value of a --set flag as a bool, nil, an integer
+// or a string.
+func parseSetValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return number
+	}
+
+	return value
+}
+
+// mergeValues merges src into dst, merging nested maps key by key.
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// preprocessManifest executes the manifest as a Go template of the manifest
+// values, with the values as .Values and the environment as .Env, then
+// expands its environment variable references.
+func preprocessManifest(file string, data []byte) ([]byte, error) {
+	if ManifestValues != nil {
+		tmpl, err := template.New(file).Option("missingkey=error").Funcs(templateFuncs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("Parsing the template %s failed: %v", file, err)
+		}
+		for _, t := range tmpl.Templates() {
+			allowMissingValues(t.Tree.Root)
+		}
+
+		env := map[string]string{}
+		for _, pair := range os.Environ() {
+			parts := strings.SplitN(pair, "=", 2)
+			env[parts[0]] = parts[1]
+		}
+
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, map[string]interface{}{"Values": ManifestValues, "Env": env}); err != nil {
+			if strings.Contains(err.Error(), "map has no entry for key") {
+				return nil, fmt.Errorf("The template %s uses a value that is not set, give it with --set or --values, or use the default function: %v", file, err)
+			}
+			return nil, fmt.Errorf("Executing the template %s failed: %v", file, err)
+		}
+		data = out.Bytes()
+	}
+
+	if ExpandEnv || StrictEnv {
+		var err error
+		if data, err = expandEnv(file, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// allowMissingValues rewrites the value references, such as .Values.tag or
+// $.Values.tag, of the pipelines calling one of missingTolerantFuncs, and of
+// the conditions of if, with and range, into calls of optionalValue. The
+// template then fails on the values that are not set everywhere but in those
+// pipelines.
+func allowMissingValues(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			allowMissingValues(child)
+		}
+	case *parse.ActionNode:
+		allowMissingPipe(n.Pipe, false)
+	case *parse.TemplateNode:
+		allowMissingPipe(n.Pipe, false)
+	case *parse.IfNode:
+		allowMissingBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		allowMissingBranch(&n.BranchNode)
+	case *parse.WithNode:
+		allowMissingBranch(&n.BranchNode)
+	case *parse.PipeNode:
+		allowMissingPipe(n, false)
+	}
+}
+
+// allowMissingBranch makes the condition of the branch tolerate values that
+// are not set, which are false.
+func allowMissingBranch(n *parse.BranchNode) {
+	allowMissingPipe(n.Pipe, true)
+	allowMissingValues(n.List)
+	allowMissingValues(n.ElseList)
+}
+
+// allowMissingPipe rewrites the value references of the pipeline when it is
+// tolerant or calls one of missingTolerantFuncs, and those of the pipelines
+// nested in it.
+func allowMissingPipe(pipe *parse.PipeNode, tolerant bool) {
+	if pipe == nil {
+		return
+	}
+
+	for _, cmd := range pipe.Cmds {
+		if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && missingTolerantFuncs[ident.Ident] {
+			tolerant = true
+		}
+	}
+
+	for _, cmd := range pipe.Cmds {
+		for i, arg := range cmd.Args {
+			if tolerant {
+				cmd.Args[i] = optionalReference(arg)
+			}
+			allowMissingValues(cmd.Args[i])
+		}
+	}
+}
+
+// optionalReference returns the call of optionalValue looking up the keys of
+// a field or variable reference, or node itself for other nodes.
+func optionalReference(node parse.Node) parse.Node {
+	var base parse.Node
+	var keys []string
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		base, keys = &parse.DotNode{NodeType: parse.NodeDot, Pos: n.Pos}, n.Ident
+	case *parse.VariableNode:
+		if len(n.Ident) < 2 {
+			return node
+		}
+		base, keys = &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: n.Ident[:1]}, n.Ident[1:]
+	default:
+		return node
+	}
+
+	args := []parse.Node{parse.NewIdentifier(optionalValueFunc).SetPos(node.Position()), base}
+	for _, key := range keys {
+		args = append(args, &parse.StringNode{NodeType: parse.NodeString, Pos: node.Position(), Quoted: strconv.Quote(key), Text: key})
+	}
+
+	return &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Pos:      node.Position(),
+		Cmds:     []*parse.CommandNode{{NodeType: parse.NodeCommand, Pos: node.Position(), Args: args}},
+	}
+}
+
+// optionalValue looks up the keys in the nested maps of base, and returns nil
+// when one of them is not set.
+func optionalValue(base interface{}, keys ...string) interface{} {
+	value := reflect.ValueOf(base)
+	for _, key := range keys {
+		for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr) {
+			if value.IsNil() {
+				return nil
+			}
+			value = value.Elem()
+		}
+
+		if !value.IsValid() || value.Kind() != reflect.Map || value.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+
+		value = value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+		if !value.IsValid() {
+			return nil
+		}
+	}
+
+	if !value.IsValid() {
+		return nil
+	}
+
+	return value.Interface()
+}
+
+// expandEnv replaces the environment variable references of the manifest.
+func expandEnv(file string, data []byte) ([]byte, error) {
+	undefined := map[string]bool{}
+	expanded := envReference.ReplaceAllFunc(data, func(reference []byte) []byte {
+		match := envReference.FindSubmatch(reference)
+		if len(match[1]) > 0 {
+			return reference[1:]
+		}
+
+		name := string(match[2])
+		if value, ok := os.LookupEnv(name); ok && (value != "" || len(match[3]) == 0) {
+			return []byte(value)
+		}
+		if len(match[3]) > 0 {
+			return match[4]
+		}
+
+		undefined[name] = true
+		return nil
+	})
+
+	if len(undefined) == 0 {
+		return expanded, nil
+	}
+
+	names := make([]string, 0, len(undefined))
+	for name := range undefined {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if StrictEnv {
+		return nil, fmt.Errorf("%s references undefined environment variables: %s", file, strings.Join(names, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s references undefined environment variables, replaced with empty strings: %s\n", file, strings.Join(names, ", "))
+
+	return expanded, nil
+}
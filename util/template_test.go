@@ -0,0 +1,109 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPreprocessManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+		wantErr  string
+	}{
+		{
+			name:     "value",
+			manifest: `image: nginx:{{ .Values.image.tag }}`,
+			want:     `image: nginx:1.15`,
+		},
+		{
+			name:     "missing value",
+			manifest: `replicas: {{ .Values.replicas }}`,
+			wantErr:  "uses a value that is not set",
+		},
+		{
+			name:     "missing nested value",
+			manifest: `port: {{ .Values.service.port }}`,
+			wantErr:  "uses a value that is not set",
+		},
+		{
+			name:     "default of a missing value",
+			manifest: `replicas: {{ .Values.replicas | default 1 }}`,
+			want:     `replicas: 1`,
+		},
+		{
+			name:     "default of a missing nested value",
+			manifest: `port: {{ default 80 .Values.service.port }}`,
+			want:     `port: 80`,
+		},
+		{
+			name:     "default of a set value",
+			manifest: `image: nginx:{{ .Values.image.tag | default "latest" }}`,
+			want:     `image: nginx:1.15`,
+		},
+		{
+			name:     "default in a nested pipeline",
+			manifest: `name: {{ quote (.Values.name | default "web") }}`,
+			want:     `name: "web"`,
+		},
+		{
+			name:     "default of a variable",
+			manifest: `{{ with .Values.image }}port: {{ $.Values.port | default 80 }}{{ end }}`,
+			want:     `port: 80`,
+		},
+		{
+			name:     "default in a branch",
+			manifest: `{{ if .Values.image }}replicas: {{ .Values.replicas | default 2 }}{{ end }}`,
+			want:     `replicas: 2`,
+		},
+		{
+			name:     "condition on a missing value",
+			manifest: `{{ if .Values.debug }}debug: true{{ else }}debug: false{{ end }}`,
+			want:     `debug: false`,
+		},
+		{
+			name:     "missing value in a branch",
+			manifest: `{{ if .Values.image }}port: {{ .Values.port }}{{ end }}`,
+			wantErr:  "uses a value that is not set",
+		},
+		{
+			name:     "missing value next to a default",
+			manifest: `{{ .Values.replicas | default 1 }} {{ .Values.port }}`,
+			wantErr:  "uses a value that is not set",
+		},
+		{
+			name:     "required",
+			manifest: `port: {{ required "port is required" .Values.port }}`,
+			wantErr:  "port is required",
+		},
+		{
+			name:     "no value text",
+			manifest: `command: echo "<no value>" {{ .Values.image.tag }}`,
+			want:     `command: echo "<no value>" 1.15`,
+		},
+	}
+
+	values := ManifestValues
+	ManifestValues = map[string]interface{}{"image": map[string]interface{}{"tag": "1.15"}}
+	defer func() { ManifestValues = values }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := preprocessManifest("manifest.yaml", []byte(test.manifest))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("preprocessManifest returned %v, want an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("preprocessManifest failed: %v", err)
+			}
+
+			if string(data) != test.want {
+				t.Errorf("preprocessManifest returned %q, want %q", data, test.want)
+			}
+		})
+	}
+}
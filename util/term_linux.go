@@ -0,0 +1,110 @@
+//go:build linux
+// +build linux
+
+package util
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+// terminalState is the state of a terminal before it was put in raw mode.
+type terminalState struct {
+	termios syscall.Termios
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// isTerminal reports whether the file descriptor is a terminal.
+func isTerminal(fd int) bool {
+	var termios syscall.Termios
+	return ioctl(fd, syscall.TCGETS, unsafe.Pointer(&termios)) == nil
+}
+
+// makeRaw puts the terminal in raw mode so that every key press, including
+// control characters, is passed through to the remote process.
+func makeRaw(fd int) (*terminalState, error) {
+	var state terminalState
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&state.termios)); err != nil {
+		return nil, err
+	}
+
+	raw := state.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// restoreTerminal restores the terminal to the state saved by makeRaw.
+func restoreTerminal(fd int, state *terminalState) error {
+	return ioctl(fd, syscall.TCSETS, unsafe.Pointer(&state.termios))
+}
+
+// getTerminalSize returns the number of rows and columns of the terminal.
+func getTerminalSize(fd int) (int, int, error) {
+	var size struct {
+		rows, cols, xpixel, ypixel uint16
+	}
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+		return 0, 0, err
+	}
+
+	return int(size.rows), int(size.cols), nil
+}
+
+// notifyResize sends the size of the terminal every time it is resized, until
+// stop is called. Sizes not received yet are replaced by newer ones.
+func notifyResize(fd int) (<-chan aci.TerminalSize, func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	sizes := make(chan aci.TerminalSize, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+
+			rows, cols, err := getTerminalSize(fd)
+			if err != nil {
+				continue
+			}
+
+			select {
+			case <-sizes:
+			default:
+			}
+			sizes <- aci.TerminalSize{Rows: rows, Cols: cols}
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(signals)
+		close(done)
+	}
+
+	return sizes, stop
+}
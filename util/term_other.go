@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package util
+
+import (
+	"errors"
+
+	"github.com/samkreter/acictl/aci"
+)
+
+// terminalState is the state of a terminal before it was put in raw mode.
+type terminalState struct{}
+
+var errTerminalNotSupported = errors.New("Terminal handling is only supported on Linux")
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errTerminalNotSupported
+}
+
+func restoreTerminal(fd int, state *terminalState) error {
+	return errTerminalNotSupported
+}
+
+func getTerminalSize(fd int) (int, int, error) {
+	return 0, 0, errTerminalNotSupported
+}
+
+// notifyResize never sends, terminals can not be resized without SIGWINCH.
+func notifyResize(fd int) (<-chan aci.TerminalSize, func()) {
+	return nil, func() {}
+}
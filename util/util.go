@@ -1,17 +1,23 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
+	"strconv"
 	"strings"
 
+	"github.com/ghodss/yaml"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	"k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 
 	kirix "github.com/samkreter/Kirix/providers/aci"
+	"github.com/samkreter/acictl/aci"
 	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
 )
 
@@ -43,100 +49,178 @@ func GenerateArmTemplate(cg *client.ContainerGroup) *ArmTemplate {
 	}
 }
 
-func Delete(deploymentFile string, resourceGroup string) error {
-	deployment, err := GetDeploymentFromFile(deploymentFile)
+// Delete deletes the container groups owned by the deployment or job. With
+// wait set, it returns once every deletion has finished and the container
+// groups are gone.
+func Delete(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentFile string, resourceGroup string, wait bool) error {
+	obj, _, err := readManifest(deploymentFile)
 	if err != nil {
 		return fmt.Errorf("Parse deployment error: %s", err)
 	}
 
-	aciClient, err := kirix.CreateACIClient()
+	switch obj := obj.(type) {
+	case *batchv1.Job:
+		return DeleteJob(ctx, aciClient, obj.Name, resourceGroup, wait)
+	case *batchv1beta1.CronJob:
+		return DeleteCronJob(ctx, aciClient, obj.Name, resourceGroup, wait)
+	}
+
+	deployment, err := asDeployment(obj, deploymentFile)
 	if err != nil {
-		return err
+		return fmt.Errorf("Parse deployment error: %s", err)
 	}
 
-	cgList, err := aciClient.ListContainerGroups(resourceGroup)
+	owned, err := ListOwnedContainerGroups(ctx, aciClient, resourceGroup, deployment.Name)
 	if err != nil {
-		return fmt.Errorf("Container group list error: %s", err)
+		return err
 	}
 
-	for _, cg := range cgList.Value {
-		if strings.Contains(cg.Name, deployment.Name) {
-			fmt.Printf("Deleting container group %s\n", cg.Name)
-			err := aciClient.DeleteContainerGroup(resourceGroup, cg.Name)
-			if err != nil {
-				return fmt.Errorf("Delete container group error: %s", err)
-			}
-		}
+	if wait {
+		ctx = aci.WithOperationWait(ctx)
 	}
 
-	return nil
+	var done progress
+	return runParallel(ctx, "delete", containerGroupNames(owned), &done, func(ctx context.Context, name string) error {
+		fmt.Printf("Deleting container group %s\n", name)
+		if err := aciClient.DeleteContainerGroup(ctx, resourceGroup, name); err != nil {
+			return fmt.Errorf("Delete container group error: %w", err)
+		}
+
+		if wait {
+			return waitForDeletion(ctx, aciClient, resourceGroup, name)
+		}
+		return nil
+	})
 }
 
-func Create(deploymentFile string, resourceGroup string, region string) error {
+// Create creates the container groups of the deployment. With wait set, it
+// returns once every container group has finished provisioning. A job is run
+// until it has finished.
+func Create(ctx context.Context, aciClient aci.ContainerGroupClient, deploymentFile string, resourceGroup string, region string, wait bool) error {
 
-	deployment, err := GetDeploymentFromFile(deploymentFile)
+	obj, data, err := readManifest(deploymentFile)
 	if err != nil {
 		return err
 	}
 
-	pod := &v1.Pod{
-		Spec: deployment.Spec.Template.Spec,
+	switch obj := obj.(type) {
+	case *batchv1.Job:
+		return RunJob(ctx, aciClient, jobFromManifest(obj, data), resourceGroup, region)
+	case *batchv1beta1.CronJob:
+		return fmt.Errorf("Cron job %s runs on its schedule with 'acictl cron run -f %s'", obj.Name, deploymentFile)
 	}
 
-	pod.Name = deployment.GetName()
+	deployment, err := asDeployment(obj, deploymentFile)
+	if err != nil {
+		return err
+	}
 
-	containerGroup, err := kirix.GetACIFromK8sPod(pod, region, "Linux")
+	containerGroup, err := ContainerGroupFromDeployment(deployment, region)
 	if err != nil {
 		return err
 	}
 
-	aciClient, err := kirix.CreateACIClient()
+	templateHash, err := TemplateHash(containerGroup)
 	if err != nil {
 		return err
 	}
 
-	replicas := *deployment.Spec.Replicas
-	for i := int32(0); i < replicas; i++ {
-		containerGroup.Name = pod.Name + "-" + randSeq(RandStringLength)
+	replicas := int(getReplicas(deployment))
+	containerGroup.Tags, err = ownerTags(deployment.Name, 1, templateHash, map[int]string{
+		1: formatImages(containerGroup),
+	})
+	if err != nil {
+		return err
+	}
+	containerGroup.Tags[ReplicasTag] = strconv.Itoa(replicas)
+	containerGroup.Tags[StrategyTag] = formatStrategy(deployment.Spec.Strategy)
 
-		fmt.Printf("Creating Container Group %s.\n", containerGroup.Name)
+	namer, err := newReplicaNamer(ctx, aciClient, resourceGroup, deployment.Name, templateHash)
+	if err != nil {
+		return err
+	}
 
-		_, err = aciClient.CreateContainerGroup(
-			resourceGroup,
-			containerGroup.Name,
-			*containerGroup,
-		)
+	names := make([]string, 0, replicas)
+	for i := 0; i < replicas; i++ {
+		name, err := namer.next()
 		if err != nil {
 			return err
 		}
+		names = append(names, name)
 	}
 
-	return nil
-}
-
-func randSeq(n int) string {
-	randChars := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ123456789")
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = randChars[rand.Intn(len(randChars))]
+	if wait {
+		ctx = aci.WithOperationWait(ctx)
 	}
-	return string(b)
+
+	var done progress
+	return runParallel(ctx, "create", names, &done, func(ctx context.Context, name string) error {
+		cg := *containerGroup
+		cg.Name = name
+
+		fmt.Printf("Creating Container Group %s.\n", cg.Name)
+
+		_, err := aciClient.CreateContainerGroup(ctx, resourceGroup, cg.Name, cg)
+		return err
+	})
 }
 
-func Convert(deploymentFile string, resourceGroup string, region string) error {
+// ContainerGroupFromDeployment translates the pod template of the deployment
+// into the container group used for each of its replicas.
+func ContainerGroupFromDeployment(deployment *v1beta1.Deployment, region string) (*client.ContainerGroup, error) {
+	return containerGroupFromPodSpec(deployment.GetName(), deployment.Spec.Template.Spec, region)
+}
 
-	deployment, err := GetDeploymentFromFile(deploymentFile)
+// containerGroupFromPodSpec translates a pod template into a container group.
+func containerGroupFromPodSpec(name string, spec v1.PodSpec, region string) (*client.ContainerGroup, error) {
+	spec, configVolumes, err := resolveConfigReferences(spec)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%s: %v", name, err)
 	}
 
 	pod := &v1.Pod{
-		Spec: deployment.Spec.Template.Spec,
+		Spec: spec,
 	}
 
-	pod.Name = deployment.GetName()
+	pod.Name = name
 
 	cg, err := kirix.GetACIFromK8sPod(pod, region, "Linux")
+	if err != nil {
+		return nil, err
+	}
+	cg.Volumes = append(cg.Volumes, configVolumes...)
+
+	return cg, nil
+}
+
+// getReplicas returns the desired replica count, defaulting to one like
+// the Kubernetes API server does.
+func getReplicas(deployment *v1beta1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+
+	return *deployment.Spec.Replicas
+}
+
+func Convert(deploymentFile string, resourceGroup string, region string) error {
+
+	obj, _, err := readManifest(deploymentFile)
+	if err != nil {
+		return err
+	}
+
+	var cg *client.ContainerGroup
+	switch obj := obj.(type) {
+	case *v1beta1.Deployment:
+		cg, err = ContainerGroupFromDeployment(obj, region)
+	case *batchv1.Job:
+		cg, err = containerGroupFromPodSpec(obj.Name, obj.Spec.Template.Spec, region)
+	case *batchv1beta1.CronJob:
+		cg, err = containerGroupFromPodSpec(obj.Name, obj.Spec.JobTemplate.Spec.Template.Spec, region)
+	default:
+		_, err = asDeployment(obj, deploymentFile)
+	}
 	if err != nil {
 		return err
 	}
@@ -154,19 +238,73 @@ func Convert(deploymentFile string, resourceGroup string, region string) error {
 }
 
 func GetDeploymentFromFile(deploymentFile string) (*v1beta1.Deployment, error) {
-	deploymentData, err := ioutil.ReadFile(deploymentFile)
+	obj, _, err := readManifest(deploymentFile)
 	if err != nil {
-		return &v1beta1.Deployment{}, fmt.Errorf("Could not find deployment file: %s", deploymentFile)
+		return &v1beta1.Deployment{}, err
 	}
 
+	return asDeployment(obj, deploymentFile)
+}
+
+// readManifest decodes the Kubernetes object in the file, or built from a
+// kustomization or chart under the reference, and returns it with the content
+// of the file once its templates and variables are expanded.
+func readManifest(file string) (runtime.Object, []byte, error) {
+	data, ok := builtManifests[file]
+	if !ok {
+		if file == builtSource && builtSource != "" {
+			return nil, nil, fmt.Errorf("%s builds several workloads, select one by name with -f: %s", file, strings.Join(builtWorkloads, ", "))
+		}
+
+		var err error
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return nil, nil, fmt.Errorf("Could not find deployment file: %s", file)
+		}
+
+		if data, err = preprocessManifest(file, data); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	obj, err := decodeManifest(file, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return obj, data, nil
+}
+
+// decodeManifest decodes the preprocessed manifest read from the file.
+func decodeManifest(file string, data []byte) (runtime.Object, error) {
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 
-	obj, _, err := decode(deploymentData, nil, nil)
+	obj, _, err := decode(data, nil, nil)
 	if err != nil {
-		fmt.Printf("%#v", err)
+		return nil, fmt.Errorf("Decoding %s failed: %v", file, err)
 	}
 
-	deployment := obj.(*v1beta1.Deployment)
+	return obj, nil
+}
+
+// asDeployment returns the object read from the file as a Deployment.
+func asDeployment(obj runtime.Object, file string) (*v1beta1.Deployment, error) {
+	deployment, ok := obj.(*v1beta1.Deployment)
+	if !ok {
+		return &v1beta1.Deployment{}, fmt.Errorf("%s does not hold a Deployment, a Job or a CronJob but a %s", file, obj.GetObjectKind().GroupVersionKind().Kind)
+	}
 
 	return deployment, nil
 }
+
+// jobFromManifest adds the fields of the manifest missing from the vendored
+// Job type.
+func jobFromManifest(job *batchv1.Job, data []byte) *Job {
+	var extra struct {
+		Spec struct {
+			TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished"`
+		} `json:"spec"`
+	}
+	yaml.Unmarshal(data, &extra)
+
+	return &Job{Job: job, TTLSecondsAfterFinished: extra.Spec.TTLSecondsAfterFinished}
+}
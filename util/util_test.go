@@ -0,0 +1,209 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samkreter/acictl/aci"
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+const testResourceGroup = "rg"
+
+// deploymentManifest returns an extensions/v1beta1 Deployment of nginx.
+func deploymentManifest(name string, replicas int, image string) string {
+	return fmt.Sprintf(`apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: %s
+spec:
+  replicas: %d
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: %s
+`, name, replicas, image)
+}
+
+// writeManifest writes the manifest to a file of a temporary directory.
+func writeManifest(t *testing.T, manifest string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := ioutil.WriteFile(file, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// fastPolling makes the commands poll without waiting for the duration of
+// the test.
+func fastPolling(t *testing.T) {
+	rollout, job, work, run := rolloutPollInterval, jobPollInterval, workPollInterval, runLogInterval
+	rolloutPollInterval, jobPollInterval, workPollInterval, runLogInterval = time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond
+	t.Cleanup(func() {
+		rolloutPollInterval, jobPollInterval, workPollInterval, runLogInterval = rollout, job, work, run
+	})
+}
+
+// listGroups returns the container groups of the test resource group, sorted
+// by name.
+func listGroups(t *testing.T, aciClient aci.ContainerGroupClient) []client.ContainerGroup {
+	t.Helper()
+
+	list, err := aciClient.ListContainerGroups(context.Background(), testResourceGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(list.Value, func(i, j int) bool {
+		return list.Value[i].Name < list.Value[j].Name
+	})
+
+	return list.Value
+}
+
+// images returns the image of the first container of every container group.
+func images(cgs []client.ContainerGroup) []string {
+	images := make([]string, 0, len(cgs))
+	for _, cg := range cgs {
+		images = append(images, cg.Containers[0].Image)
+	}
+
+	return images
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		manifest   string
+		quota      int
+		failing    string
+		wait       bool
+		wantGroups int
+		wantClass  aci.ErrorClass
+		wantErr    bool
+	}{
+		{
+			name:       "replicas",
+			manifest:   deploymentManifest("web", 3, "nginx"),
+			wantGroups: 3,
+		},
+		{
+			name:       "wait",
+			manifest:   deploymentManifest("web", 2, "nginx"),
+			wait:       true,
+			wantGroups: 2,
+		},
+		{
+			name:       "quota",
+			manifest:   deploymentManifest("web", 3, "nginx"),
+			quota:      2,
+			wantGroups: 2,
+			wantClass:  aci.ErrorClassQuota,
+			wantErr:    true,
+		},
+		{
+			name:       "inaccessible image",
+			manifest:   deploymentManifest("web", 1, "nginx:missing"),
+			failing:    "nginx:missing",
+			wait:       true,
+			wantGroups: 1,
+			wantClass:  aci.ErrorClassImage,
+			wantErr:    true,
+		},
+		{
+			name:     "images too long to record",
+			manifest: deploymentManifest("web", 2, "registry.example.com/"+strings.Repeat("a", 250)),
+			wantErr:  true,
+		},
+		{
+			name:     "not a deployment",
+			manifest: "apiVersion: v1\nkind: Service\nmetadata:\n  name: web\n",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aciClient := fake.NewClient()
+			aciClient.Quota = test.quota
+			if test.failing != "" {
+				aciClient.FailingImages[test.failing] = true
+			}
+
+			err := Create(context.Background(), aciClient, writeManifest(t, test.manifest), testResourceGroup, "westus", test.wait)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Create returned %v, want an error: %t", err, test.wantErr)
+			}
+			if class := aci.ClassifyError(err); err != nil && test.wantClass != aci.ErrorClassUnknown && class != test.wantClass {
+				t.Errorf("Create error %v has class %d, want %d", err, class, test.wantClass)
+			}
+
+			groups := listGroups(t, aciClient)
+			if len(groups) != test.wantGroups {
+				t.Fatalf("Create left %d container groups, want %d", len(groups), test.wantGroups)
+			}
+
+			for _, cg := range groups {
+				if !IsOwnedBy(cg, "web") || GetRevision(cg) != 1 {
+					t.Errorf("Container group %s has tags %v, want revision 1 of deployment web", cg.Name, cg.Tags)
+				}
+				if test.wait && !test.wantErr && cg.ProvisioningState != "Succeeded" {
+					t.Errorf("Container group %s is %s after waiting, want Succeeded", cg.Name, cg.ProvisioningState)
+				}
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int
+		others   int
+		wait     bool
+	}{
+		{name: "replicas", replicas: 3, others: 1},
+		{name: "wait", replicas: 2, wait: true},
+		{name: "no replicas", replicas: 0, others: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			aciClient := fake.NewClient()
+
+			web := writeManifest(t, deploymentManifest("web", test.replicas, "nginx"))
+			if err := Create(ctx, aciClient, web, testResourceGroup, "westus", false); err != nil {
+				t.Fatal(err)
+			}
+			if err := Create(ctx, aciClient, writeManifest(t, deploymentManifest("api", test.others, "nginx")), testResourceGroup, "westus", false); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Delete(ctx, aciClient, web, testResourceGroup, test.wait); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+
+			groups := listGroups(t, aciClient)
+			if len(groups) != test.others {
+				t.Fatalf("Delete left %d container groups, want the %d of the other deployment", len(groups), test.others)
+			}
+			for _, cg := range groups {
+				if IsOwnedBy(cg, "web") {
+					t.Errorf("Delete left container group %s of the deployment", cg.Name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+var watchPollInterval = 2 * time.Second
+
+// dirWatcher reports changes to the files of a directory tree. Changes are
+// coalesced, a receive from Events means at least one matching file was
+// created, written, renamed or removed since the previous receive.
+type dirWatcher interface {
+	Events() <-chan struct{}
+	Close() error
+}
+
+// newDirWatcher watches the directory tree with fsnotify, or polls it when
+// that fails, for example when the inotify watch limit is reached.
+func newDirWatcher(dir string, match func(path string) bool) (dirWatcher, error) {
+	w, err := newNotifyWatcher(dir, match)
+	if err != nil {
+		fmt.Printf("Watching %s failed, polling it every %s: %v\n", dir, watchPollInterval, err)
+		return newPollWatcher(dir, match), nil
+	}
+
+	return w, nil
+}
+
+// notifyWatcher watches every directory of a tree with fsnotify, adding the
+// directories created after it started.
+type notifyWatcher struct {
+	watcher *fsnotify.Watcher
+	match   func(path string) bool
+	dirs    map[string]bool
+	events  chan struct{}
+}
+
+func newNotifyWatcher(dir string, match func(path string) bool) (*notifyWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &notifyWatcher{
+		watcher: watcher,
+		match:   match,
+		dirs:    map[string]bool{},
+		events:  make(chan struct{}, 1),
+	}
+
+	if err := w.addTree(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *notifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *notifyWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// addTree watches the directory and its subdirectories.
+func (w *notifyWatcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("Watching %s failed: %v", path, err)
+		}
+		w.dirs[path] = true
+
+		return nil
+	})
+}
+
+func (w *notifyWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+
+			// A directory moved in brings its files along, a directory
+			// moved out takes them away.
+			switch {
+			case w.dirs[event.Name] && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				delete(w.dirs, event.Name)
+				notify(w.events)
+			case event.Has(fsnotify.Create) && isDir(event.Name):
+				w.addTree(event.Name)
+				notify(w.events)
+			case w.match(event.Name):
+				notify(w.events)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events were dropped, for example on a queue overflow.
+			if err == fsnotify.ErrEventOverflow {
+				notify(w.events)
+			}
+		}
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
+
+// pollWatcher is the dirWatcher used when fsnotify can not watch the
+// directory, it compares the size and modification time of the files at an
+// interval.
+type pollWatcher struct {
+	dir    string
+	match  func(path string) bool
+	events chan struct{}
+	stop   chan struct{}
+}
+
+func newPollWatcher(dir string, match func(path string) bool) *pollWatcher {
+	w := &pollWatcher{
+		dir:    dir,
+		match:  match,
+		events: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	go w.run()
+
+	return w
+}
+
+func (w *pollWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	close(w.stop)
+	return nil
+}
+
+func (w *pollWatcher) run() {
+	last := w.snapshot()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(watchPollInterval):
+		}
+
+		current := w.snapshot()
+		if !sameSnapshot(last, current) {
+			notify(w.events)
+		}
+		last = current
+	}
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshot returns the stamp of every matching file under the directory.
+func (w *pollWatcher) snapshot() map[string]fileStamp {
+	files := map[string]fileStamp{}
+	filepath.Walk(w.dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && w.match(path) {
+			files[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+
+	return files
+}
+
+func sameSnapshot(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		if other, ok := b[path]; !ok || other != stamp {
+			return false
+		}
+	}
+
+	return true
+}
+
+// notify sends on a channel buffered for one value without blocking, so
+// pending notifications are coalesced.
+func notify(events chan struct{}) {
+	select {
+	case events <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyWatcher(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := newNotifyWatcher(dir, func(path string) bool {
+		return strings.HasSuffix(path, ".yaml")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// expect waits for a change to be reported, or for none when want is
+	// false.
+	expect := func(change string, want bool) {
+		t.Helper()
+
+		timeout := 5 * time.Second
+		if !want {
+			timeout = 100 * time.Millisecond
+		}
+		select {
+		case <-w.Events():
+			if !want {
+				t.Errorf("Watcher reported a change after %s", change)
+			}
+		case <-time.After(timeout):
+			if want {
+				t.Errorf("Watcher reported no change after %s", change)
+			}
+		}
+	}
+	write := func(path string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte("kind: Deployment\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("deployment.yaml")
+	expect("writing a manifest", true)
+
+	// A write is reported by several events, those left of the previous
+	// write are drained.
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-w.Events():
+	default:
+	}
+
+	write("notes.txt")
+	expect("writing another file", false)
+
+	if err := os.Mkdir(filepath.Join(dir, "new"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expect("creating a directory", true)
+
+	write("new/deployment.yaml")
+	expect("writing a manifest in a new directory", true)
+
+	if err := os.Remove(filepath.Join(dir, "old")); err != nil {
+		t.Fatal(err)
+	}
+	expect("removing a directory", true)
+}
+
+func TestSyncWatchIgnoresStatusFile(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SyncOptions
+	}{
+		{name: "manifests"},
+		{name: "kustomization", opts: SyncOptions{Kustomize: true}},
+		{name: "chart", opts: SyncOptions{Chart: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &syncer{dir: dir, opts: test.opts}
+			s.opts.StatusFile = filepath.Join(dir, "status.json")
+
+			w, err := newNotifyWatcher(dir, s.watches)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			if err := writeSyncStatus(&SyncStatus{Dir: dir}, s.opts.StatusFile); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-w.Events():
+				t.Fatal("Watcher reported a change after writing the status file")
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if err := ioutil.WriteFile(filepath.Join(dir, "deployment.yaml"), []byte("kind: Deployment\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-w.Events():
+			case <-time.After(5 * time.Second):
+				t.Error("Watcher reported no change after writing a manifest")
+			}
+		})
+	}
+}
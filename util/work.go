@@ -0,0 +1,389 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	kirix "github.com/samkreter/Kirix/providers/aci"
+	"github.com/samkreter/acictl/aci"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Tags acictl sets on the container groups running work items.
+const (
+	WorkTag     = "acictl-work"
+	WorkItemTag = "acictl-work-item"
+)
+
+// Outcomes of a work item in the work report.
+const (
+	WorkSucceeded = "Succeeded"
+	WorkFailed    = "Failed"
+	WorkPending   = "Pending"
+)
+
+// DefaultWorkTimeout is the time an attempt of a work item may run for.
+const DefaultWorkTimeout = 30 * time.Minute
+
+var (
+	workPollInterval = 5 * time.Second
+
+	// workGetAttempts is the number of consecutive failed reads of a work
+	// item's container group after which its attempt fails.
+	workGetAttempts = 5
+)
+
+// WorkOptions configures RunWork.
+type WorkOptions struct {
+	// Name prefixes the names of the container groups and identifies them
+	// in their tags.
+	Name  string
+	Image string
+	// Retries is the number of times a failed work item is run again.
+	Retries int
+	// Timeout bounds every attempt of a work item, from the creation of its
+	// container group until its container exited, DefaultWorkTimeout when
+	// zero. Attempts running longer fail.
+	Timeout time.Duration
+	// ReportFile is where the JSON report is written.
+	ReportFile string
+}
+
+// WorkReport is the summary of a RunWork call.
+type WorkReport struct {
+	Name      string       `json:"name"`
+	Image     string       `json:"image"`
+	Total     int          `json:"total"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Pending   int          `json:"pending"`
+	Items     []WorkResult `json:"items"`
+}
+
+// WorkResult is the outcome of a work item, from its last attempt.
+type WorkResult struct {
+	Index          int    `json:"index"`
+	Work           string `json:"work"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ContainerGroup string `json:"containerGroup,omitempty"`
+	ExitCode       *int32 `json:"exitCode,omitempty"`
+	Logs           string `json:"logs,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// ReadWorkFile returns the non-empty lines of the file, each a work item.
+func ReadWorkFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Reading work file %q failed: %v", path, err)
+	}
+	defer file.Close()
+
+	var items []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if item := strings.TrimSpace(scanner.Text()); item != "" {
+			items = append(items, item)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Reading work file %q failed: %v", path, err)
+	}
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("Work file %q has no work items", path)
+	}
+
+	return items, nil
+}
+
+// RunWork runs a container group of the image for every work item, passing
+// the item in the KIRIX_WORK environment variable, with at most Parallelism
+// of them at a time. A work item succeeds when its container exits with 0,
+// failed items are run again up to Retries times. The exit code and logs of
+// every item are written to the JSON report, and the container groups are
+// deleted once their logs are collected.
+func RunWork(ctx context.Context, aciClient aci.ContainerGroupClient, items []string, resourceGroup string, region string, opts WorkOptions) error {
+	template, err := kirix.GetSingleImageContainerGroup(opts.Image, region, "Linux")
+	if err != nil {
+		return err
+	}
+	if len(template.Containers) == 0 {
+		return fmt.Errorf("Container group template of image %s has no containers", opts.Image)
+	}
+	template.RestartPolicy = client.Never
+	template.Tags = map[string]string{WorkTag: opts.Name}
+
+	namer, err := newReplicaNamer(ctx, aciClient, resourceGroup, opts.Name, "")
+	if err != nil {
+		return err
+	}
+
+	report := &WorkReport{Name: opts.Name, Image: opts.Image, Total: len(items), Items: make([]WorkResult, len(items))}
+	for i, item := range items {
+		report.Items[i] = WorkResult{Index: i, Work: item, Status: WorkPending}
+	}
+
+	w := &worker{
+		aciClient:     aciClient,
+		resourceGroup: resourceGroup,
+		template:      template,
+		namer:         namer,
+		retries:       opts.Retries,
+		timeout:       opts.Timeout,
+	}
+	if w.timeout == 0 {
+		w.timeout = DefaultWorkTimeout
+	}
+
+	workers := Parallelism
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	var mu sync.Mutex
+	finished := 0
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for index := range indexes {
+				result := w.run(ctx, index, items[index])
+
+				mu.Lock()
+				report.Items[index] = result
+				if result.Status != WorkPending {
+					finished++
+					fmt.Printf("Work item %d %s after %d attempts (%d/%d)\n", index, strings.ToLower(result.Status), result.Attempts, finished, len(items))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+dispatch:
+	for index := range items {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, result := range report.Items {
+		switch result.Status {
+		case WorkSucceeded:
+			report.Succeeded++
+		case WorkFailed:
+			report.Failed++
+		default:
+			report.Pending++
+		}
+	}
+
+	if err := writeWorkReport(report, opts.ReportFile); err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d work items succeeded, %d failed, %d not run. Report written to %s.\n", report.Succeeded, report.Total, report.Failed, report.Pending, opts.ReportFile)
+
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("Work cancelled (%s), %d work items were not run", ctx.Err(), report.Pending)
+	case report.Failed > 0:
+		return fmt.Errorf("%d of %d work items failed, see %s", report.Failed, report.Total, opts.ReportFile)
+	}
+
+	return nil
+}
+
+// worker runs work items in container groups.
+type worker struct {
+	aciClient     aci.ContainerGroupClient
+	resourceGroup string
+	template      *client.ContainerGroup
+	retries       int
+	timeout       time.Duration
+
+	mu    sync.Mutex
+	namer *replicaNamer
+}
+
+// run runs the work item until it succeeds or has no retries left.
+func (w *worker) run(ctx context.Context, index int, item string) WorkResult {
+	result := WorkResult{Index: index, Work: item, Status: WorkPending}
+	for attempt := 1; attempt <= w.retries+1 && ctx.Err() == nil; attempt++ {
+		result = w.attempt(ctx, index, item)
+		result.Attempts = attempt
+		if result.Status == WorkSucceeded || ctx.Err() != nil || attempt > w.retries {
+			break
+		}
+
+		fmt.Printf("Work item %d failed on attempt %d, retrying: %s\n", index, attempt, result.Error)
+	}
+
+	return result
+}
+
+// attempt runs the work item once in a new container group, and deletes it
+// after collecting its exit code and logs.
+func (w *worker) attempt(ctx context.Context, index int, item string) WorkResult {
+	result := WorkResult{Index: index, Work: item, Status: WorkFailed}
+
+	w.mu.Lock()
+	name, err := w.namer.next()
+	w.mu.Unlock()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ContainerGroup = name
+
+	cg := *w.template
+	cg.Name = name
+	cg.Tags = map[string]string{WorkItemTag: strconv.Itoa(index)}
+	for key, value := range w.template.Tags {
+		cg.Tags[key] = value
+	}
+	if err := setWork(&cg, item); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if _, err := w.aciClient.CreateContainerGroup(ctx, w.resourceGroup, name, cg); err != nil {
+		result.Error = fmt.Sprintf("Create container group error: %s", err)
+		if ctx.Err() != nil {
+			result.Status = WorkPending
+		}
+		return result
+	}
+
+	exitCode, err := w.waitForExit(ctx, name)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if ctx.Err() != nil {
+		result.Status = WorkPending
+		return result
+	}
+	result.ExitCode = exitCode
+
+	if len(cg.Containers) > 0 {
+		container := cg.Containers[0].Name
+		if logs, err := w.aciClient.GetContainerLogs(ctx, w.resourceGroup, name, container, 0); err == nil {
+			result.Logs = logs.Content
+		}
+	}
+
+	if err := w.aciClient.DeleteContainerGroup(ctx, w.resourceGroup, name); err != nil {
+		fmt.Printf("Failed to delete container group %s of work item %d: %s\n", name, index, err)
+	}
+
+	switch {
+	case exitCode != nil && *exitCode == 0:
+		result.Status = WorkSucceeded
+	case exitCode != nil && result.Error == "":
+		result.Error = fmt.Sprintf("Container exited with code %d", *exitCode)
+	}
+
+	return result
+}
+
+// waitForExit waits until the container of the container group has exited,
+// and returns its exit code. The exit code is nil if the container group
+// failed before its container ran. It fails once the timeout of the worker
+// expired, or when the container group could not be read workGetAttempts
+// times in a row.
+func (w *worker) waitForExit(ctx context.Context, name string) (*int32, error) {
+	var exitCode *int32
+	failedGets := 0
+	err := pollImmediate(ctx, workPollInterval, w.timeout, func() (bool, error) {
+		cg, err, status := w.aciClient.GetContainerGroup(ctx, w.resourceGroup, name)
+		if status != nil && *status == http.StatusNotFound {
+			return false, fmt.Errorf("Container group %s was deleted", name)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			if failedGets++; failedGets >= workGetAttempts {
+				return false, fmt.Errorf("Getting container group %s failed %d times: %v", name, failedGets, err)
+			}
+			return false, nil
+		}
+		failedGets = 0
+
+		if cg.ProvisioningState == "Failed" {
+			return false, fmt.Errorf("Container group %s failed to provision", name)
+		}
+		if len(cg.Containers) == 0 {
+			return false, nil
+		}
+
+		if state := cg.Containers[0].InstanceView.CurrentState; state.State == "Terminated" {
+			code := state.ExitCode
+			exitCode = &code
+			return true, nil
+		}
+
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("Timed out after %s waiting for the container of container group %s to exit", w.timeout, name)
+	}
+
+	return exitCode, err
+}
+
+// setWork sets the KIRIX_WORK environment variable of the container group's
+// container, like the AddWork method of Kirix.
+func setWork(cg *client.ContainerGroup, item string) error {
+	containers := make([]client.Container, len(cg.Containers))
+	copy(containers, cg.Containers)
+	cg.Containers = containers
+
+	for i, container := range containers {
+		env := make([]client.EnvironmentVariable, len(container.EnvironmentVariables))
+		copy(env, container.EnvironmentVariables)
+		containers[i].EnvironmentVariables = env
+
+		for j := range env {
+			if env[j].Name == kirix.WorkEnvVarName {
+				env[j].Value = item
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("Could not find Env Variable: %s to add work.", kirix.WorkEnvVarName)
+}
+
+// writeWorkReport writes the report as indented JSON.
+func writeWorkReport(report *WorkReport, path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("Writing work report %q failed: %v", path, err)
+	}
+
+	return nil
+}
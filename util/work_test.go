@@ -0,0 +1,242 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kirix "github.com/samkreter/Kirix/providers/aci"
+	"github.com/samkreter/acictl/aci/fake"
+	client "github.com/virtual-kubelet/virtual-kubelet/providers/azure/client/aci"
+)
+
+// workClient runs the work items in the fake client, logging the item. The
+// first failures[item] attempts of an item run the image "fail", which exits
+// with 1. It records the most work items running at once.
+type workClient struct {
+	*fake.Client
+	failures map[string]int
+
+	mu         sync.Mutex
+	running    int
+	maxRunning int
+}
+
+func newWorkClient(failures map[string]int) *workClient {
+	c := &workClient{Client: fake.NewClient(), failures: failures}
+	c.RunSteps = 2
+	c.ExitCodes["fail"] = 1
+
+	return c
+}
+
+func (c *workClient) CreateContainerGroup(ctx context.Context, resourceGroup, containerGroupName string, containerGroup client.ContainerGroup) (*client.ContainerGroup, error) {
+	item := workItem(containerGroup)
+
+	c.mu.Lock()
+	if c.failures[item] > 0 {
+		c.failures[item]--
+		containerGroup.Containers[0].Image = "fail"
+	}
+	if c.running++; c.running > c.maxRunning {
+		c.maxRunning = c.running
+	}
+	c.mu.Unlock()
+
+	cg, err := c.Client.CreateContainerGroup(ctx, resourceGroup, containerGroupName, containerGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	return cg, c.SetLogs(resourceGroup, containerGroupName, containerGroup.Containers[0].Name, "work "+item+"\n")
+}
+
+func (c *workClient) DeleteContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) error {
+	c.mu.Lock()
+	c.running--
+	c.mu.Unlock()
+
+	return c.Client.DeleteContainerGroup(ctx, resourceGroup, containerGroupName)
+}
+
+// workItem returns the work item of a container group.
+func workItem(cg client.ContainerGroup) string {
+	for _, env := range cg.Containers[0].EnvironmentVariables {
+		if env.Name == kirix.WorkEnvVarName {
+			return env.Value
+		}
+	}
+
+	return ""
+}
+
+// runTestWork runs the items and returns the error and the report of RunWork.
+func runTestWork(t *testing.T, aciClient *workClient, items []string, opts WorkOptions) (*WorkReport, error) {
+	t.Helper()
+	fastPolling(t)
+
+	opts.Name = "work"
+	opts.Image = "worker"
+	opts.ReportFile = filepath.Join(t.TempDir(), "report.json")
+	err := RunWork(context.Background(), aciClient, items, testResourceGroup, "westus", opts)
+
+	data, readErr := ioutil.ReadFile(opts.ReportFile)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	var report WorkReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if groups := listGroups(t, aciClient); len(groups) != 0 {
+		t.Errorf("RunWork left the container groups %v", containerGroupNames(groups))
+	}
+
+	return &report, err
+}
+
+func TestRunWorkFanOut(t *testing.T) {
+	parallelism := Parallelism
+	Parallelism = 3
+	defer func() { Parallelism = parallelism }()
+
+	items := []string{"a", "b", "c", "d", "e", "f", "g"}
+	aciClient := newWorkClient(nil)
+	report, err := runTestWork(t, aciClient, items, WorkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aciClient.maxRunning != Parallelism {
+		t.Errorf("RunWork ran up to %d work items at once, want %d", aciClient.maxRunning, Parallelism)
+	}
+	if report.Total != len(items) || report.Succeeded != len(items) || report.Failed != 0 || report.Pending != 0 {
+		t.Errorf("Report counts %d total, %d succeeded, %d failed and %d pending, want %d succeeded", report.Total, report.Succeeded, report.Failed, report.Pending, len(items))
+	}
+
+	groups := map[string]bool{}
+	for i, result := range report.Items {
+		if result.Index != i || result.Work != items[i] || result.Status != WorkSucceeded || result.Attempts != 1 {
+			t.Errorf("Item %d is %+v, want work %q succeeded after 1 attempt", i, result, items[i])
+		}
+		if result.ExitCode == nil || *result.ExitCode != 0 || !strings.HasPrefix(result.Logs, "work "+items[i]+"\n") {
+			t.Errorf("Item %d has the exit code %v and logs %q, want 0 and the logs of its work", i, result.ExitCode, result.Logs)
+		}
+		if groups[result.ContainerGroup] {
+			t.Errorf("Item %d ran in the container group %s of another item", i, result.ContainerGroup)
+		}
+		groups[result.ContainerGroup] = true
+	}
+}
+
+func TestRunWorkRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retries      int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "succeeds first", failures: 0, retries: 2, wantStatus: WorkSucceeded, wantAttempts: 1},
+		{name: "succeeds on retry", failures: 2, retries: 2, wantStatus: WorkSucceeded, wantAttempts: 3},
+		{name: "out of retries", failures: 3, retries: 2, wantStatus: WorkFailed, wantAttempts: 3},
+		{name: "no retries", failures: 1, retries: 0, wantStatus: WorkFailed, wantAttempts: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			aciClient := newWorkClient(map[string]int{"flaky": test.failures})
+			report, err := runTestWork(t, aciClient, []string{"stable", "flaky"}, WorkOptions{Retries: test.retries})
+			if (test.wantStatus == WorkFailed) != (err != nil) {
+				t.Fatalf("RunWork returned %v, want an error: %t", err, test.wantStatus == WorkFailed)
+			}
+
+			if stable := report.Items[0]; stable.Status != WorkSucceeded || stable.Attempts != 1 {
+				t.Errorf("Stable item %s after %d attempts, want succeeded after 1", stable.Status, stable.Attempts)
+			}
+
+			flaky := report.Items[1]
+			if flaky.Status != test.wantStatus || flaky.Attempts != test.wantAttempts {
+				t.Errorf("Flaky item %s after %d attempts, want %s after %d", flaky.Status, flaky.Attempts, test.wantStatus, test.wantAttempts)
+			}
+			if test.wantStatus == WorkFailed && (flaky.ExitCode == nil || *flaky.ExitCode != 1 || flaky.Error != "Container exited with code 1") {
+				t.Errorf("Failed item has the exit code %v and error %q, want 1", flaky.ExitCode, flaky.Error)
+			}
+		})
+	}
+}
+
+// unreadableClient fails to read the container groups.
+type unreadableClient struct {
+	*workClient
+}
+
+func (c *unreadableClient) GetContainerGroup(ctx context.Context, resourceGroup, containerGroupName string) (*client.ContainerGroup, error, *int) {
+	return nil, errors.New("connection reset by peer"), nil
+}
+
+func TestRunWorkBoundedWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		runSteps   int
+		timeout    time.Duration
+		unreadable bool
+		wantError  string
+	}{
+		{
+			name:      "container never exits",
+			timeout:   50 * time.Millisecond,
+			wantError: "Timed out after 50ms waiting for the container of container group work-0 to exit",
+		},
+		{
+			name:       "container group unreadable",
+			runSteps:   2,
+			unreadable: true,
+			wantError:  "Getting container group work-0 failed 5 times: connection reset by peer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fastPolling(t)
+
+			aciClient := newWorkClient(nil)
+			aciClient.RunSteps = test.runSteps
+
+			opts := WorkOptions{Name: "work", Image: "worker", Timeout: test.timeout, ReportFile: filepath.Join(t.TempDir(), "report.json")}
+			var err error
+			if test.unreadable {
+				err = RunWork(context.Background(), &unreadableClient{aciClient}, []string{"a"}, testResourceGroup, "westus", opts)
+			} else {
+				err = RunWork(context.Background(), aciClient, []string{"a"}, testResourceGroup, "westus", opts)
+			}
+			if err == nil || !strings.Contains(err.Error(), "1 of 1 work items failed") {
+				t.Fatalf("RunWork returned %v, want the failed work item", err)
+			}
+
+			data, err := ioutil.ReadFile(opts.ReportFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var report WorkReport
+			if err := json.Unmarshal(data, &report); err != nil {
+				t.Fatal(err)
+			}
+
+			result := report.Items[0]
+			if result.Status != WorkFailed || result.ExitCode != nil || result.Error != test.wantError {
+				t.Errorf("Item is %s with exit code %v and error %q, want failed with %q", result.Status, result.ExitCode, result.Error, test.wantError)
+			}
+			if groups := listGroups(t, aciClient); len(groups) != 0 {
+				t.Errorf("RunWork left the container groups %v", containerGroupNames(groups))
+			}
+		})
+	}
+}